@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+// RoleAdmin the role users need to use the admin API, it is granted with the CLI
+const RoleAdmin = "admin"
+
+// AdminResource admin resource, its routes act on any user so they are limited to users
+// with the admin role
+type AdminResource struct {
+	store      users.UserStore
+	authFilter restful.FilterFunction
+	history    history.LoginHistoryStore
+}
+
+// NewAdminResource create a new admin resource
+func NewAdminResource(store users.UserStore, authFilter restful.FilterFunction, historyStore history.LoginHistoryStore) *AdminResource {
+	return &AdminResource{store, authFilter, historyStore}
+}
+
+// Register register the admin resource with the container
+func (ad AdminResource) Register(container *restful.Container) {
+	ws := new(restful.WebService)
+
+	ws.Path("/admin").
+		Doc("Admin services").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("/users/{user_id}/login_history").Filter(ad.authFilter).Filter(requireFullAccess).Filter(ad.requireAdmin).To(ad.listLoginHistory).
+		Doc("List the recent sign in attempts of a user").
+		Param(ws.PathParameter("user_id", "identifier of the user").DataType("string")).
+		Operation("adminListLoginHistory").Returns(http.StatusOK, "OK", []models.LoginAttempt{}))
+
+	container.Add(ws)
+}
+
+// requireAdmin reject requests from users without the admin role, it must follow the
+// authentication filter
+func (ad AdminResource) requireAdmin(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	userid, _ := req.Attribute("user_id").(string)
+
+	usr, err := ad.store.GetByID(ctx, userid)
+
+	if err != nil && err != users.ErrUserNotFound {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	if err == nil {
+		for _, role := range usr.Roles {
+			if role == RoleAdmin {
+				chain.ProcessFilter(req, resp)
+				return
+			}
+		}
+	}
+
+	resp.WriteErrorString(http.StatusForbidden, "403: Admin Role Required")
+}
+
+func (ad AdminResource) listLoginHistory(req *restful.Request, resp *restful.Response) {
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	userid := req.PathParameter("user_id")
+
+	_, err := ad.store.GetByID(ctx, userid)
+
+	if err == users.ErrUserNotFound {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
+		return
+	}
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	list, err := ad.history.ListByUser(userid)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	resp.WriteEntity(list)
+}
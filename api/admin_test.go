@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+func TestAdminListLoginHistory(t *testing.T) {
+
+	store := users.NewUserStoreLocal()
+	store.Create(context.Background(), NewUser())
+
+	admin := &models.User{ID: models.String("456"), Login: models.String("admin"), Email: models.String("admin@wolfe.id.au"), Roles: []string{RoleAdmin}}
+	store.Create(context.Background(), admin)
+
+	historyStore := history.NewLoginHistoryStoreLocal()
+	historyStore.Record(&models.LoginAttempt{UserID: models.String("123"), Success: true, IP: models.String("127.0.0.1")})
+
+	// the user the request is authenticated as is passed in a header
+	authFilter := func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		req.SetAttribute("user_id", req.Request.Header.Get("X-User-ID"))
+		chain.ProcessFilter(req, resp)
+	}
+
+	container := restful.NewContainer()
+	NewAdminResource(store, authFilter, historyStore).Register(container)
+
+	testCases := []struct {
+		userID   string
+		target   string
+		expected int
+	}{
+		{userID: "456", target: "123", expected: 200},
+		{userID: "123", target: "123", expected: 403},
+		{userID: "456", target: "789", expected: 404},
+	}
+
+	for _, tc := range testCases {
+		req, _ := http.NewRequest("GET", "http://api.his.com/admin/users/"+tc.target+"/login_history", nil)
+		req.Header.Set("X-User-ID", tc.userID)
+
+		recorder, _ := newResponse()
+
+		container.ServeHTTP(recorder, req)
+
+		if recorder.Code != tc.expected {
+			t.Errorf("expected %d got %d %s", tc.expected, recorder.Code, recorder.Body.String())
+			continue
+		}
+
+		if tc.expected != 200 {
+			continue
+		}
+
+		list := []*models.LoginAttempt{}
+
+		err := json.Unmarshal(recorder.Body.Bytes(), &list)
+		if err != nil {
+			t.Fatalf("error decoding login history %v", err)
+		}
+
+		if len(list) != 1 || models.StringValue(list[0].IP) != "127.0.0.1" {
+			t.Errorf("unexpected login history %v", list)
+		}
+	}
+}
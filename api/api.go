@@ -1,5 +1,20 @@
 package api
 
+import (
+	"context"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// MIMEZip ZIP archive
+const MIMEZip = "application/zip"
+
+var (
+	// RequestTimeout the maximum time a handler will wait on the stores
+	RequestTimeout = 10 * time.Second
+)
+
 func errorMsg(msg string) map[string]string {
 	return map[string]string{"msg": msg}
 }
@@ -7,3 +22,9 @@ func errorMsg(msg string) map[string]string {
 func validationErrors(msg, allErrs interface{}) map[string]interface{} {
 	return map[string]interface{}{"msg": msg, "errors": allErrs}
 }
+
+// requestContext derive a context for store calls from the client request, it is
+// cancelled when the client disconnects or RequestTimeout is exceeded.
+func requestContext(req *restful.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(req.Request.Context(), RequestTimeout)
+}
@@ -1,30 +1,48 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/emicklei/go-restful"
 	"github.com/gorilla/schema"
 	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/metrics"
 	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/tokens"
 	"github.com/wolfeidau/authinator/store/users"
 	"github.com/wolfeidau/authinator/util"
 )
 
 var decoder = schema.NewDecoder()
 
+var (
+	// SessionTouchInterval how often the last seen time of a session is updated
+	SessionTouchInterval = time.Minute
+)
+
 // AuthResource user resource
 type AuthResource struct {
 	store      users.UserStore
 	certs      *auth.Certs
 	authFilter restful.FilterFunction
+	cookies    *CookieSessions
+	sessions   sessions.SessionStore
+	history    history.LoginHistoryStore
 }
 
-// NewAuthResource create a new user resource
-func NewAuthResource(store users.UserStore, authFilter restful.FilterFunction, certs *auth.Certs) *AuthResource {
-	return &AuthResource{store, certs, authFilter}
+// NewAuthResource create a new user resource, if cookies is nil tokens are only
+// returned in the Authorization header, if sessions is nil sign ins aren't recorded
+// as sessions and if history is nil sign in attempts aren't recorded.
+func NewAuthResource(store users.UserStore, authFilter restful.FilterFunction, certs *auth.Certs, cookies *CookieSessions, sessionStore sessions.SessionStore, historyStore history.LoginHistoryStore) *AuthResource {
+	return &AuthResource{store, certs, authFilter, cookies, sessionStore, historyStore}
 }
 
 // Register register the user resource with the rest container.
@@ -39,11 +57,17 @@ func (ar AuthResource) Register(container *restful.Container) {
 	ws.Route(ws.POST("/sign_in").Consumes("application/x-www-form-urlencoded").
 		To(ar.authenticateUser).Doc("Get the current user").Operation("authenicateUser"))
 
+	ws.Route(ws.POST("/sign_out").Filter(ar.authFilter).
+		To(ar.signOut).Doc("Revoke the current session and clear the session cookies").Operation("signOut"))
+
 	container.Add(ws)
 }
 
 func (ar AuthResource) authenticateUser(req *restful.Request, resp *restful.Response) {
 
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
 	err := req.Request.ParseForm()
 	if err != nil {
 		resp.WriteErrorString(http.StatusBadRequest, err.Error())
@@ -57,72 +81,379 @@ func (ar AuthResource) authenticateUser(req *restful.Request, resp *restful.Resp
 		return
 	}
 
-	phash, err := ar.store.GetPasswordByLogin(creds.Login)
+	phash, err := ar.store.GetPasswordByLogin(ctx, creds.Login)
 	if err != nil {
 		if err == users.ErrUserNotFound {
+			metrics.SignIn(false, "unknown_user")
 			resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
 			return
 		}
 
+		metrics.SignIn(false, "error")
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
 		return
 	}
 
 	ok, err := util.CompareHashPassword(creds.Password, phash)
 	if err != nil {
+		metrics.SignIn(false, "error")
 		resp.WriteErrorString(http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if !ok {
+		metrics.SignIn(false, "bad_password")
+
+		usr, err := ar.store.GetByLogin(ctx, creds.Login)
+		if err == nil {
+			err = ar.recordAttempt(req, usr, false, "bad_password")
+		}
+
+		if err != nil && err != users.ErrUserNotFound {
+			resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+			return
+		}
+
 		resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
 		return
 	}
 
-	usr, err := ar.store.GetByLogin(creds.Login)
+	usr, err := ar.store.GetByLogin(ctx, creds.Login)
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
 		return
 	}
 
-	tok, err := auth.GenerateClaim(ar.certs, usr)
+	// imported password hashes are replaced once the password has been verified
+	if util.NeedsRehash(phash) {
+		err = ar.rehashPassword(ctx, models.StringValue(usr.ID), creds.Password)
+		if err != nil {
+			log.Printf("rehashing password of user %s failed: %s", models.StringValue(usr.ID), err)
+		}
+	}
+
+	ar.signIn(ctx, req, resp, usr)
+}
+
+// rehashPassword store the password hashed in the current format
+func (ar AuthResource) rehashPassword(ctx context.Context, userID, password string) error {
+	pass, err := util.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return ar.store.Update(ctx, &models.User{
+		ID:       models.String(userID),
+		Password: models.String(pass),
+	}, []string{users.FieldPassword})
+}
+
+func (ar AuthResource) signOut(req *restful.Request, resp *restful.Response) {
+
+	sessionID, ok := req.Attribute("session_id").(string)
+
+	if ar.sessions != nil && ok && sessionID != "" {
+		err := ar.sessions.Delete(sessionID)
+		if err != nil && err != sessions.ErrSessionNotFound {
+			resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+			return
+		}
+	}
+
+	if ar.cookies != nil {
+		ar.cookies.clearSession(resp)
+	}
+
+	resp.WriteHeader(http.StatusOK)
+}
+
+// signIn record a session and issue a token for the authenticated user and return it
+// to the client, in session mode the token is also stored in a cookie.
+func (ar AuthResource) signIn(ctx context.Context, req *restful.Request, resp *restful.Response, usr *models.User) {
+
+	if usr.DisabledAt != nil {
+		metrics.SignIn(false, "disabled")
+
+		err := ar.recordAttempt(req, usr, false, "disabled")
+		if err != nil {
+			resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+			return
+		}
+
+		resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+		return
+	}
+
+	var sessionID string
+
+	if ar.sessions != nil {
+		now := time.Now()
+
+		session, err := ar.sessions.Create(&models.Session{
+			UserID:     usr.ID,
+			CreatedAt:  now,
+			LastSeenAt: now,
+			IP:         models.String(remoteIP(req)),
+			UserAgent:  models.String(req.Request.UserAgent()),
+		})
+		if err != nil {
+			resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+			return
+		}
+
+		sessionID = models.StringValue(session.ID)
+	}
+
+	tok, err := auth.GenerateSessionClaim(ar.certs, usr, sessionID)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	err = ar.store.RecordLogin(ctx, models.StringValue(usr.ID), time.Now(), remoteIP(req))
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	err = ar.recordAttempt(req, usr, true, "")
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
 		return
 	}
 
+	if ar.cookies != nil {
+		err = ar.cookies.setSession(resp, tok)
+		if err != nil {
+			resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+			return
+		}
+	}
+
+	metrics.SignIn(true, "")
+	metrics.TokenIssued("session")
+
 	resp.AddHeader("Authorization", fmt.Sprintf("Bearer %s", tok))
 
 	resp.WriteHeader(http.StatusOK)
 }
 
-// BuildJWTAuthFunc build the JWT authentication filter function
-func BuildJWTAuthFunc(store users.UserStore, certs *auth.Certs) restful.FilterFunction {
+// recordAttempt add the sign in attempt to the users login history
+func (ar AuthResource) recordAttempt(req *restful.Request, usr *models.User, success bool, reason string) error {
+
+	if ar.history == nil {
+		return nil
+	}
+
+	attempt := &models.LoginAttempt{
+		UserID:    usr.ID,
+		Success:   success,
+		IP:        models.String(remoteIP(req)),
+		UserAgent: models.String(req.Request.UserAgent()),
+		CreatedAt: time.Now(),
+	}
+
+	if reason != "" {
+		attempt.Reason = models.String(reason)
+	}
+
+	return ar.history.Record(attempt)
+}
+
+// BuildJWTAuthFunc build the JWT authentication filter function, the token is read from
+// the Authorization header or, if cookies is not nil, the session cookie. If sessions is
+// not nil tokens must be bound to a session which hasn't been revoked. If tokenStore is
+// not nil personal access tokens are also accepted in the Authorization header. Tokens of
+// users who have been disabled are rejected. The scopes the token is restricted to, if
+// any, are set in the scopes attribute for the routes to check.
+func BuildJWTAuthFunc(store users.UserStore, certs *auth.Certs, cookies *CookieSessions, sessionStore sessions.SessionStore, tokenStore tokens.AccessTokenStore) restful.FilterFunction {
 	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
 		encoded := req.Request.Header.Get("Authorization")
 
-		if len(encoded) == 0 {
+		var token string
+
+		switch {
+		case len(encoded) != 0:
+			if !strings.HasPrefix(encoded, "Bearer ") {
+				metrics.TokenRejected("malformed")
+				resp.WriteErrorString(401, "401: Not Authorized")
+				return
+			}
+
+			parts := strings.Split(encoded, " ")
+			token = parts[1]
+
+			if tokenStore != nil && auth.IsAccessToken(token) {
+				authenticateAccessToken(store, tokenStore, token, req, resp, chain)
+				return
+			}
+
+		case cookies != nil && cookies.token(req) != "":
+			// cookies are sent automatically by the browser so require the CSRF token
+			if !cookies.validCSRF(req) {
+				metrics.TokenRejected("bad_csrf")
+				resp.WriteErrorString(403, "403: Invalid CSRF Token")
+				return
+			}
+
+			token = cookies.token(req)
+
+		default:
+			metrics.TokenRejected("missing")
 			resp.WriteErrorString(401, "401: Not Authorized")
 			return
 		}
 
-		if !strings.HasPrefix(encoded, "Bearer ") {
+		usr, sessionID, scopes, err := auth.ValidateScopedClaim(certs, token)
+
+		if err != nil {
+			metrics.TokenRejected(tokenRejectReason(err))
 			resp.WriteErrorString(401, "401: Not Authorized")
 			return
 		}
 
-		tokens := strings.Split(encoded, " ")
+		if sessionStore != nil {
+			if sessionID == "" {
+				metrics.TokenRejected("no_session")
+				resp.WriteErrorString(401, "401: Not Authorized")
+				return
+			}
 
-		usr, err := auth.ValidateClaim(certs, tokens[1])
+			session, err := sessionStore.GetByID(sessionID)
+			if err != nil {
+				if err == sessions.ErrSessionNotFound {
+					metrics.TokenRejected("revoked_session")
+					resp.WriteErrorString(401, "401: Not Authorized")
+					return
+				}
 
-		if err != nil {
-			resp.WriteErrorString(401, "401: Not Authorized")
+				resp.WriteErrorString(500, "500: Server Error")
+				return
+			}
+
+			if models.StringValue(session.UserID) != models.StringValue(usr.ID) {
+				metrics.TokenRejected("session_mismatch")
+				resp.WriteErrorString(401, "401: Not Authorized")
+				return
+			}
+
+			// avoid a write on every request
+			if now := time.Now(); now.Sub(session.LastSeenAt) > SessionTouchInterval {
+				err = sessionStore.Touch(sessionID, now)
+				if err != nil && err != sessions.ErrSessionNotFound {
+					resp.WriteErrorString(500, "500: Server Error")
+					return
+				}
+			}
+		}
+
+		if !checkUserEnabled(store, models.StringValue(usr.ID), req, resp) {
 			return
 		}
 
-		// Extract the user_id
+		// Extract the user_id and session_id
 		req.SetAttribute("user_id", models.StringValue(usr.ID))
+		req.SetAttribute("session_id", sessionID)
+		req.SetAttribute("scopes", scopes)
 
 		chain.ProcessFilter(req, resp)
 	}
 }
+
+// remoteIP return the IP address of the client without the port
+func remoteIP(req *restful.Request) string {
+	host, _, err := net.SplitHostPort(req.Request.RemoteAddr)
+	if err != nil {
+		return req.Request.RemoteAddr
+	}
+	return host
+}
+
+// authenticateAccessToken authenticate the request using a personal access token
+func authenticateAccessToken(store users.UserStore, tokenStore tokens.AccessTokenStore, token string, req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+	pat, err := tokenStore.GetByHash(auth.HashAccessToken(token))
+	if err != nil {
+		if err == tokens.ErrAccessTokenNotFound {
+			metrics.TokenRejected("unknown_access_token")
+			resp.WriteErrorString(401, "401: Not Authorized")
+			return
+		}
+
+		resp.WriteErrorString(500, "500: Server Error")
+		return
+	}
+
+	now := time.Now()
+
+	if pat.ExpiresAt != nil && now.After(*pat.ExpiresAt) {
+		metrics.TokenRejected("expired_access_token")
+		resp.WriteErrorString(401, "401: Not Authorized")
+		return
+	}
+
+	// avoid a write on every request
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) > SessionTouchInterval {
+		err = tokenStore.Touch(models.StringValue(pat.ID), now)
+		if err != nil && err != tokens.ErrAccessTokenNotFound {
+			resp.WriteErrorString(500, "500: Server Error")
+			return
+		}
+	}
+
+	if !checkUserEnabled(store, models.StringValue(pat.UserID), req, resp) {
+		return
+	}
+
+	req.SetAttribute("user_id", models.StringValue(pat.UserID))
+	req.SetAttribute("token_id", models.StringValue(pat.ID))
+	req.SetAttribute("scopes", pat.Scopes)
+
+	chain.ProcessFilter(req, resp)
+}
+
+// checkUserEnabled reject the request if the user has been disabled or can't be found,
+// which includes users who have been deleted, purged or erased.
+func checkUserEnabled(store users.UserStore, userID string, req *restful.Request, resp *restful.Response) bool {
+
+	usr, err := store.GetByID(req.Request.Context(), userID)
+	if err == users.ErrUserNotFound {
+		metrics.TokenRejected("unknown_user")
+		resp.WriteErrorString(401, "401: Not Authorized")
+		return false
+	}
+	if err != nil {
+		resp.WriteErrorString(500, "500: Server Error")
+		return false
+	}
+
+	if usr.DisabledAt != nil {
+		metrics.TokenRejected("disabled_user")
+		resp.WriteErrorString(401, "401: Not Authorized")
+		return false
+	}
+
+	return true
+}
+
+// tokenRejectReason the reason a token failed validation, used to label metrics
+func tokenRejectReason(err error) string {
+	switch err {
+	case auth.ErrTokenExpired:
+		return "expired"
+	case auth.ErrBadSignature:
+		return "bad_signature"
+	case auth.ErrWrongAlgorithm:
+		return "wrong_algorithm"
+	case auth.ErrUnknownKeyID:
+		return "unknown_key"
+	case auth.ErrWrongIssuer:
+		return "wrong_issuer"
+	case auth.ErrMalformedToken:
+		return "malformed"
+	case auth.ErrInvalidTokenType:
+		return "wrong_type"
+	}
+
+	return "invalid"
+}
@@ -2,10 +2,17 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/emicklei/go-restful"
 	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/history"
 	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/util"
 )
 
 var userHash = "LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP"
@@ -19,9 +26,9 @@ func TestAuthenticateUser(t *testing.T) {
 
 	store := users.NewUserStoreLocal()
 
-	store.Create(NewUser())
+	store.Create(context.Background(), NewUser())
 
-	ws := NewAuthResource(store, nil, certs)
+	ws := NewAuthResource(store, nil, certs, nil, nil, nil)
 
 	req := newFormRequest("POST", "http://api.his.com/users", bytes.NewBufferString("login=wolfeidau&password=Somewh3r3 there is a cow!"))
 
@@ -38,3 +45,136 @@ func TestAuthenticateUser(t *testing.T) {
 	}
 
 }
+
+func TestAuthenticateUserRehashesImportedPassword(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Errorf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	usr := NewUser()
+	usr.Password = models.String("$apr1$saltsalt$JlxKsEGK5mnlqk8yvMql4/")
+
+	store.Create(context.Background(), usr)
+
+	ws := NewAuthResource(store, nil, certs, nil, nil, nil)
+
+	for i := 0; i < 2; i++ {
+		req := newFormRequest("POST", "http://api.his.com/auth/sign_in", bytes.NewBufferString("login=wolfeidau&password=Somewh3r3 there is a cow!"))
+
+		recorder, resp := newResponse()
+
+		ws.authenticateUser(req, resp)
+
+		if recorder.Code != 200 {
+			t.Errorf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+		}
+
+		phash, _ := store.GetPasswordByLogin(context.Background(), "wolfeidau")
+
+		if util.NeedsRehash(phash) {
+			t.Errorf("expected the password to be rehashed got %s", phash)
+		}
+	}
+}
+
+func TestAuthenticateDisabledUser(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Errorf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	tok, err := auth.GenerateSessionClaim(certs, NewUser(), "")
+	if err != nil {
+		t.Fatalf("error generating token %v", err)
+	}
+
+	now := time.Now()
+
+	store.Update(context.Background(), &models.User{ID: models.String("123"), DisabledAt: &now}, []string{users.FieldDisabledAt})
+
+	ws := NewAuthResource(store, nil, certs, nil, nil, nil)
+
+	req := newFormRequest("POST", "http://api.his.com/auth/sign_in", bytes.NewBufferString("login=wolfeidau&password=Somewh3r3 there is a cow!"))
+
+	recorder, resp := newResponse()
+
+	ws.authenticateUser(req, resp)
+
+	if recorder.Code != 403 {
+		t.Errorf("expected 403 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// tokens issued before the user was disabled are rejected
+	req = newRequest("GET", "http://api.his.com/users", nil)
+	req.Request.Header.Set("Authorization", "Bearer "+tok)
+
+	recorder, resp = newResponse()
+
+	BuildJWTAuthFunc(store, certs, nil, nil, nil)(req, resp, &restful.FilterChain{Target: func(req *restful.Request, resp *restful.Response) {
+		resp.WriteHeader(http.StatusOK)
+	}})
+
+	if recorder.Code != 401 {
+		t.Errorf("expected 401 got %d", recorder.Code)
+	}
+}
+
+func TestAuthenticateUserRecordsHistory(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Errorf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	historyStore := history.NewLoginHistoryStoreLocal()
+
+	ws := NewAuthResource(store, nil, certs, nil, nil, historyStore)
+
+	for _, password := range []string{"wrong", "Somewh3r3 there is a cow!"} {
+		req := newFormRequest("POST", "http://api.his.com/auth/sign_in", bytes.NewBufferString("login=wolfeidau&password="+password))
+		req.Request.RemoteAddr = "10.0.0.1:1234"
+
+		_, resp := newResponse()
+
+		ws.authenticateUser(req, resp)
+	}
+
+	list, err := historyStore.ListByUser("123")
+	if err != nil {
+		t.Fatalf("error listing history %v", err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("expected 2 attempts got %d", len(list))
+	}
+
+	if !list[0].Success || list[1].Success {
+		t.Errorf("expected most recent attempt to succeed and the first to fail")
+	}
+
+	if models.StringValue(list[1].Reason) != "bad_password" {
+		t.Errorf("expected bad_password got %s", models.StringValue(list[1].Reason))
+	}
+
+	usr, err := store.GetByID(context.Background(), "123")
+	if err != nil {
+		t.Fatalf("error getting user %v", err)
+	}
+
+	if usr.LastLoginAt == nil || models.StringValue(usr.LastLoginIP) != "10.0.0.1" {
+		t.Errorf("expected last login to be recorded")
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/tlsconfig"
+)
+
+// ClientIdentity who a client certificate authenticates as, either a user or a service
+// client
+type ClientIdentity struct {
+	// User the ID or login of the user
+	User string
+
+	// Client the name of the service client
+	Client string
+}
+
+// ClientCertAuth authenticates requests using the identities in verified TLS client
+// certificates, as an alternative to tokens.
+type ClientCertAuth struct {
+	store      users.UserStore
+	identities map[string]ClientIdentity
+}
+
+// NewClientCertAuth create client certificate authentication from mappings of the form
+// IDENTITY=user:LOGIN or IDENTITY=client:NAME, where IDENTITY is one of those returned by
+// tlsconfig.Identities such as cn:ops or uri:spiffe://example.org/ci.
+func NewClientCertAuth(store users.UserStore, mappings []string) (*ClientCertAuth, error) {
+
+	cca := &ClientCertAuth{store: store, identities: make(map[string]ClientIdentity)}
+
+	for _, mapping := range mappings {
+		i := strings.LastIndex(mapping, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("client identity %q must be IDENTITY=user:LOGIN or IDENTITY=client:NAME", mapping)
+		}
+
+		id, target := mapping[:i], mapping[i+1:]
+
+		if !strings.HasPrefix(id, "cn:") && !strings.HasPrefix(id, "dns:") && !strings.HasPrefix(id, "email:") && !strings.HasPrefix(id, "uri:") {
+			return nil, fmt.Errorf("client identity %q must start with cn:, dns:, email: or uri:", id)
+		}
+
+		switch {
+		case strings.HasPrefix(target, "user:") && len(target) > len("user:"):
+			cca.identities[id] = ClientIdentity{User: strings.TrimPrefix(target, "user:")}
+		case strings.HasPrefix(target, "client:") && len(target) > len("client:"):
+			cca.identities[id] = ClientIdentity{Client: strings.TrimPrefix(target, "client:")}
+		default:
+			return nil, fmt.Errorf("client identity %q must map to user:LOGIN or client:NAME, not %q", id, target)
+		}
+	}
+
+	return cca, nil
+}
+
+// Identify return who the verified client certificate of the request authenticates as,
+// the first identity of the certificate which is mapped is used.
+func (cca *ClientCertAuth) Identify(req *restful.Request) (ClientIdentity, bool) {
+
+	tls := req.Request.TLS
+	if tls == nil || len(tls.VerifiedChains) == 0 {
+		return ClientIdentity{}, false
+	}
+
+	for _, id := range tlsconfig.Identities(tls.VerifiedChains[0][0]) {
+		if ident, ok := cca.identities[id]; ok {
+			return ident, true
+		}
+	}
+
+	return ClientIdentity{}, false
+}
+
+// Wrap build an authentication filter which accepts client certificates mapped to users,
+// requests with an Authorization header or without a mapped certificate are passed to
+// next. The routes using the filter act on the current user so service clients are
+// rejected.
+func (cca *ClientCertAuth) Wrap(next restful.FilterFunction) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+		ident, ok := cca.Identify(req)
+		if !ok || req.Request.Header.Get("Authorization") != "" {
+			next(req, resp, chain)
+			return
+		}
+
+		if ident.Client != "" {
+			resp.WriteErrorString(403, "403: Service Clients Can't Access Users")
+			return
+		}
+
+		ctx := req.Request.Context()
+
+		usr, err := cca.store.GetByID(ctx, ident.User)
+		if err == users.ErrUserNotFound {
+			usr, err = cca.store.GetByLogin(ctx, ident.User)
+		}
+
+		if err != nil {
+			if err == users.ErrUserNotFound {
+				resp.WriteErrorString(401, "401: Not Authorized")
+				return
+			}
+
+			resp.WriteErrorString(500, "500: Server Error")
+			return
+		}
+
+		if usr.DisabledAt != nil {
+			resp.WriteErrorString(401, "401: Not Authorized")
+			return
+		}
+
+		req.SetAttribute("user_id", models.StringValue(usr.ID))
+		req.SetAttribute("client_cert", true)
+
+		chain.ProcessFilter(req, resp)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+func TestClientCertAuth(t *testing.T) {
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	cca, err := NewClientCertAuth(store, []string{
+		"cn:ops=user:wolfeidau",
+		"dns:ci.example.org=client:ci",
+		"cn:ghost=user:nobody",
+	})
+	if err != nil {
+		t.Fatalf("error creating client cert auth %v", err)
+	}
+
+	next := func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		resp.WriteErrorString(401, "401: Not Authorized")
+	}
+
+	testCases := []struct {
+		cert          *x509.Certificate
+		authorization string
+		expected      int
+	}{
+		{cert: &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}, expected: 200},
+		{cert: &x509.Certificate{DNSNames: []string{"ci.example.org"}}, expected: 403},
+		{cert: &x509.Certificate{Subject: pkix.Name{CommonName: "ghost"}}, expected: 401},
+		{cert: &x509.Certificate{Subject: pkix.Name{CommonName: "unmapped"}}, expected: 401},
+		{cert: &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}, authorization: "Bearer abc", expected: 401},
+		{expected: 401},
+	}
+
+	for _, tc := range testCases {
+		req := newRequest("GET", "https://api.his.com/users", nil)
+
+		if tc.cert != nil {
+			req.Request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tc.cert}}}
+		}
+
+		if tc.authorization != "" {
+			req.Request.Header.Set("Authorization", tc.authorization)
+		}
+
+		recorder, resp := newResponse()
+
+		cca.Wrap(next)(req, resp, &restful.FilterChain{Target: func(req *restful.Request, resp *restful.Response) {
+			if req.Attribute("user_id") != "123" {
+				t.Errorf("expected user_id 123 got %v", req.Attribute("user_id"))
+			}
+			resp.WriteHeader(http.StatusOK)
+		}})
+
+		if recorder.Code != tc.expected {
+			t.Errorf("expected %d got %d %s", tc.expected, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	for _, mapping := range []string{"ops=user:wolfeidau", "cn:ops=wolfeidau", "cn:ops=user:", "cn:ops"} {
+		if _, err := NewClientCertAuth(store, []string{mapping}); err == nil {
+			t.Errorf("expected error for mapping %q", mapping)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// CookieSessions configures the optional browser session mode, when enabled the token
+// is stored in a HttpOnly cookie and state changing requests authenticated by that
+// cookie must supply a matching double submit CSRF token in a header.
+type CookieSessions struct {
+	Name       string
+	CSRFName   string
+	CSRFHeader string
+	Domain     string
+	Path       string
+	Secure     bool
+	SameSite   http.SameSite
+	MaxAge     time.Duration
+}
+
+// NewCookieSessions create cookie session configuration with the default settings
+func NewCookieSessions(domain string, secure bool) *CookieSessions {
+	return &CookieSessions{
+		Name:       "authinator_session",
+		CSRFName:   "authinator_csrf",
+		CSRFHeader: "X-CSRF-Token",
+		Domain:     domain,
+		Path:       "/",
+		Secure:     secure,
+		SameSite:   http.SameSiteLaxMode,
+		MaxAge:     24 * time.Hour,
+	}
+}
+
+// setSession store the token in the session cookie and issue a new CSRF token
+func (cs *CookieSessions) setSession(resp *restful.Response, tok string) error {
+
+	csrf, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(resp, cs.cookie(cs.Name, tok, true))
+
+	// the CSRF cookie must be readable by javascript so it can be echoed in a header
+	http.SetCookie(resp, cs.cookie(cs.CSRFName, csrf, false))
+
+	return nil
+}
+
+// clearSession expire both the session and CSRF cookies
+func (cs *CookieSessions) clearSession(resp *restful.Response) {
+
+	for _, name := range []string{cs.Name, cs.CSRFName} {
+		c := cs.cookie(name, "", name == cs.Name)
+		c.MaxAge = -1
+		http.SetCookie(resp, c)
+	}
+}
+
+// token return the token stored in the session cookie
+func (cs *CookieSessions) token(req *restful.Request) string {
+	c, err := req.Request.Cookie(cs.Name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// validCSRF check the CSRF header matches the CSRF cookie, safe methods don't require it
+func (cs *CookieSessions) validCSRF(req *restful.Request) bool {
+
+	switch req.Request.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+
+	c, err := req.Request.Cookie(cs.CSRFName)
+	if err != nil || c.Value == "" {
+		return false
+	}
+
+	hdr := req.Request.Header.Get(cs.CSRFHeader)
+
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(hdr)) == 1
+}
+
+func (cs *CookieSessions) cookie(name, value string, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   cs.Domain,
+		Path:     cs.Path,
+		MaxAge:   int(cs.MaxAge.Seconds()),
+		Secure:   cs.Secure,
+		HttpOnly: httpOnly,
+		SameSite: cs.SameSite,
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+func TestCookieSessionSignIn(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	cookies := NewCookieSessions("", true)
+
+	ar := NewAuthResource(store, nil, certs, cookies, nil, nil)
+
+	req := newFormRequest("POST", "http://api.his.com/auth/sign_in", bytes.NewBufferString("login=wolfeidau&password=Somewh3r3 there is a cow!"))
+	recorder, resp := newResponse()
+
+	ar.authenticateUser(req, resp)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	session, csrf := sessionCookies(recorder.Header(), cookies)
+
+	if session == nil || csrf == nil {
+		t.Fatalf("expected session and csrf cookies to be set")
+	}
+
+	if !session.HttpOnly || !session.Secure {
+		t.Errorf("expected session cookie to be HttpOnly and Secure")
+	}
+
+	if csrf.HttpOnly {
+		t.Errorf("expected csrf cookie to be readable by javascript")
+	}
+
+	filter := BuildJWTAuthFunc(store, certs, cookies, nil, nil)
+
+	testCases := []struct {
+		method   string
+		csrf     string
+		expected int
+	}{
+		{method: "GET", expected: 200},
+		{method: "PUT", expected: 403},
+		{method: "PUT", csrf: "wrong", expected: 403},
+		{method: "PUT", csrf: csrf.Value, expected: 200},
+	}
+
+	for _, testCase := range testCases {
+		req := newRequest(testCase.method, "http://api.his.com/users", nil)
+		req.Request.AddCookie(session)
+		req.Request.AddCookie(csrf)
+
+		if testCase.csrf != "" {
+			req.Request.Header.Set(cookies.CSRFHeader, testCase.csrf)
+		}
+
+		recorder, resp := newResponse()
+
+		filter(req, resp, &restful.FilterChain{Target: func(req *restful.Request, resp *restful.Response) {
+			resp.WriteHeader(http.StatusOK)
+		}})
+
+		if recorder.Code != testCase.expected {
+			t.Errorf("%s with csrf %q expected %d got %d", testCase.method, testCase.csrf, testCase.expected, recorder.Code)
+		}
+	}
+}
+
+func sessionCookies(header http.Header, cookies *CookieSessions) (session, csrf *http.Cookie) {
+	for _, c := range (&http.Response{Header: header}).Cookies() {
+		switch c.Name {
+		case cookies.Name:
+			session = c
+		case cookies.CSRFName:
+			csrf = c
+		}
+	}
+	return session, csrf
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"regexp"
+
+	"github.com/emicklei/go-restful"
+)
+
+// EnableCORS allow browsers on the origins to call the API, an origin of * allows any
+// origin. If cookies is not nil the session cookie is sent with cross origin requests and
+// the CSRF header is allowed.
+func EnableCORS(container *restful.Container, origins []string, cookies *CookieSessions) {
+
+	cors := restful.CrossOriginResourceSharing{
+		ExposeHeaders:  []string{"Authorization", "ETag"},
+		AllowedHeaders: []string{"Content-Type", "Accept", "Authorization", "If-Match"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		MaxAge:         3600,
+		Container:      container,
+	}
+
+	if cookies != nil {
+		cors.AllowedHeaders = append(cors.AllowedHeaders, cookies.CSRFHeader)
+		cors.CookiesAllowed = true
+	}
+
+	// go-restful matches the allowed domains as unanchored regular expressions, so quote
+	// them to stop https://example.com matching https://example.com.evil.net
+	for _, origin := range origins {
+		if origin == "*" {
+			cors.AllowedDomains = nil
+			break
+		}
+		cors.AllowedDomains = append(cors.AllowedDomains, "^"+regexp.QuoteMeta(origin)+"$")
+	}
+
+	container.Filter(cors.Filter)
+	container.Filter(container.OPTIONSFilter)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+)
+
+func TestEnableCORS(t *testing.T) {
+
+	container := restful.NewContainer()
+
+	ws := new(restful.WebService)
+	ws.Path("/users")
+	ws.Route(ws.GET("").To(func(req *restful.Request, resp *restful.Response) {}))
+	container.Add(ws)
+
+	EnableCORS(container, []string{"https://app.example.com"}, NewCookieSessions("", true))
+
+	testCases := []struct {
+		method string
+		origin string
+		allow  string
+	}{
+		{method: "GET", origin: "https://app.example.com", allow: "https://app.example.com"},
+		{method: "GET", origin: "https://app.example.com.evil.net", allow: ""},
+		{method: "GET", origin: "https://appxexample.com", allow: ""},
+		{method: "OPTIONS", origin: "https://app.example.com", allow: "https://app.example.com"},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, "http://api.his.com/users", nil)
+		req.Header.Set("Origin", tc.origin)
+
+		if tc.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+			req.Header.Set("Access-Control-Request-Headers", "X-CSRF-Token")
+		}
+
+		recorder := httptest.NewRecorder()
+		container.ServeHTTP(recorder, req)
+
+		if allow := recorder.Header().Get("Access-Control-Allow-Origin"); allow != tc.allow {
+			t.Errorf("%s from %s expected allowed origin %q got %q", tc.method, tc.origin, tc.allow, allow)
+		}
+
+		if tc.method == "OPTIONS" && recorder.Code != http.StatusOK {
+			t.Errorf("expected preflight to return 200 got %d", recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+// userETag the entity tag of the user, this changes whenever the user is updated
+func userETag(usr *models.User) string {
+	return fmt.Sprintf(`"%d"`, models.Int64Value(usr.Version))
+}
+
+// ifMatch check the If-Match header against the current user, weak tags never match
+// as If-Match requires a strong comparison.
+func ifMatch(header string, usr *models.User) bool {
+
+	etag := userETag(usr)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/util"
+)
+
+const (
+	// StatusOK the component is working
+	StatusOK = "ok"
+
+	// StatusUnavailable the component isn't working so the server isn't ready
+	StatusUnavailable = "unavailable"
+)
+
+var (
+	// ReadinessTimeout the maximum time the readiness check waits on the store
+	ReadinessTimeout = 2 * time.Second
+)
+
+// ComponentStatus the status of one component checked by the readiness endpoint
+type ComponentStatus struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Detail map[string]interface{} `json:"detail,omitempty"`
+}
+
+// Readiness the status of the server and each of the components it depends on, the server
+// isn't ready while it is draining requests to shut down.
+type Readiness struct {
+	Status     string                     `json:"status"`
+	Draining   bool                       `json:"draining,omitempty"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// HealthResource the liveness and readiness endpoints used by orchestrators
+type HealthResource struct {
+	store    users.UserStore
+	certs    *auth.Certs
+	draining *int32
+}
+
+// NewHealthResource create the health resource which checks the store and signing keys
+func NewHealthResource(store users.UserStore, certs *auth.Certs) *HealthResource {
+	return &HealthResource{store, certs, new(int32)}
+}
+
+// Drain report the server isn't ready from now on, this is called when it starts shutting
+// down so load balancers stop sending it requests.
+func (hr HealthResource) Drain() {
+	atomic.StoreInt32(hr.draining, 1)
+}
+
+// Register register the resource with the container
+func (hr HealthResource) Register(container *restful.Container) {
+	ws := new(restful.WebService)
+
+	ws.Path("/").
+		Doc("Health checks").Produces(restful.MIME_JSON)
+
+	ws.Route(ws.GET("/healthz").To(hr.healthz).
+		Doc("Check the process is alive").Operation("healthz"))
+
+	ws.Route(ws.GET("/readyz").To(hr.readyz).
+		Doc("Check the server can handle requests, with the status of each component").Operation("readyz").
+		Writes(Readiness{}))
+
+	container.Add(ws)
+}
+
+func (hr HealthResource) healthz(req *restful.Request, resp *restful.Response) {
+	resp.WriteEntity(map[string]string{"status": StatusOK})
+}
+
+func (hr HealthResource) readyz(req *restful.Request, resp *restful.Response) {
+
+	ctx, cancel := context.WithTimeout(req.Request.Context(), ReadinessTimeout)
+	defer cancel()
+
+	rd := hr.Check(ctx)
+
+	if rd.Status != StatusOK {
+		resp.WriteHeaderAndEntity(http.StatusServiceUnavailable, rd)
+		return
+	}
+
+	resp.WriteEntity(rd)
+}
+
+// Check the store can be reached, the signing keys are loaded and the password hashing
+// pool isn't saturated, the server is ready if they all are ok and it isn't draining.
+func (hr HealthResource) Check(ctx context.Context) Readiness {
+
+	rd := Readiness{
+		Status:   StatusOK,
+		Draining: atomic.LoadInt32(hr.draining) != 0,
+		Components: map[string]ComponentStatus{
+			"store":        hr.checkStore(ctx),
+			"signing_keys": hr.checkSigningKeys(),
+			"hash_pool":    checkHashPool(),
+		},
+	}
+
+	if rd.Draining {
+		rd.Status = StatusUnavailable
+	}
+
+	for _, cs := range rd.Components {
+		if cs.Status != StatusOK {
+			rd.Status = StatusUnavailable
+		}
+	}
+
+	return rd
+}
+
+func (hr HealthResource) checkStore(ctx context.Context) ComponentStatus {
+
+	start := time.Now()
+
+	err := hr.store.Ping(ctx)
+
+	cs := ComponentStatus{
+		Status: StatusOK,
+		Detail: map[string]interface{}{"latency_ms": float64(time.Since(start).Microseconds()) / 1000},
+	}
+
+	// readyz isn't authenticated so the detail, which may name hosts, is only logged
+	if err != nil {
+		log.Printf("readiness check of the store failed: %s", err)
+		cs.Status = StatusUnavailable
+		cs.Error = "store unreachable"
+	}
+
+	return cs
+}
+
+func (hr HealthResource) checkSigningKeys() ComponentStatus {
+
+	if hr.certs == nil || hr.certs.PrivateKey == nil || hr.certs.PublicKey == nil {
+		return ComponentStatus{Status: StatusUnavailable, Error: "signing keys aren't loaded"}
+	}
+
+	return ComponentStatus{Status: StatusOK, Detail: map[string]interface{}{"key_id": hr.certs.KeyID()}}
+}
+
+func checkHashPool() ComponentStatus {
+
+	stats := util.HashPoolUsage()
+
+	cs := ComponentStatus{
+		Status: StatusOK,
+		Detail: map[string]interface{}{"size": stats.Size, "in_use": stats.InUse, "waiting": stats.Waiting},
+	}
+
+	if stats.Saturated() {
+		cs.Status = StatusUnavailable
+		cs.Error = "too many passwords are waiting to be hashed"
+	}
+
+	return cs
+}
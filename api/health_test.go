@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+// unreachableStore a user store whose backend can't be reached
+type unreachableStore struct {
+	users.UserStore
+}
+
+func (unreachableStore) Ping(ctx context.Context) error {
+	return context.DeadlineExceeded
+}
+
+func TestHealthReadyz(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	draining := NewHealthResource(store, certs)
+	draining.Drain()
+
+	testCases := []struct {
+		hr       *HealthResource
+		expected int
+		failed   string
+	}{
+		{hr: NewHealthResource(store, certs), expected: 200},
+		{hr: NewHealthResource(unreachableStore{store}, certs), expected: 503, failed: "store"},
+		{hr: NewHealthResource(store, nil), expected: 503, failed: "signing_keys"},
+		{hr: draining, expected: 503},
+	}
+
+	for _, tc := range testCases {
+		container := restful.NewContainer()
+		tc.hr.Register(container)
+
+		req, _ := http.NewRequest("GET", "http://api.his.com/readyz", nil)
+		recorder, _ := newResponse()
+
+		container.ServeHTTP(recorder, req)
+
+		if recorder.Code != tc.expected {
+			t.Errorf("expected %d got %d %s", tc.expected, recorder.Code, recorder.Body.String())
+		}
+
+		var rd Readiness
+		if err := json.Unmarshal(recorder.Body.Bytes(), &rd); err != nil {
+			t.Fatalf("error decoding readiness %v", err)
+		}
+
+		for name, cs := range rd.Components {
+			if (name == tc.failed) != (cs.Status == StatusUnavailable) {
+				t.Errorf("unexpected status %s for %s", cs.Status, name)
+			}
+		}
+
+		if cs := rd.Components["store"]; tc.failed == "store" && cs.Error != "store unreachable" {
+			t.Errorf("expected a generic store error got %q", cs.Error)
+		}
+
+		if rd.Draining != (tc.hr == draining) {
+			t.Errorf("unexpected draining %v", rd.Draining)
+		}
+
+		if len(rd.Components) != 3 {
+			t.Errorf("expected 3 components got %v", rd.Components)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://api.his.com/healthz", nil)
+	recorder, _ := newResponse()
+
+	container := restful.NewContainer()
+	NewHealthResource(unreachableStore{store}, certs).Register(container)
+	container.ServeHTTP(recorder, req)
+
+	if recorder.Code != 200 {
+		t.Errorf("expected healthz to be 200 while the store is unreachable got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/mailer"
+	"github.com/wolfeidau/authinator/metrics"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/magiclinks"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+const (
+	magicLinkPath        = "/auth/magic_link"
+	magicLinkNonceCookie = "authinator_magic_nonce"
+)
+
+var (
+	// MagicLinkTTL how long a magic link remains valid after it is issued
+	MagicLinkTTL = 15 * time.Minute
+)
+
+// MagicLinkResource passwordless sign in resource
+type MagicLinkResource struct {
+	ar      *AuthResource
+	store   users.UserStore
+	links   magiclinks.MagicLinkStore
+	mailer  mailer.Mailer
+	certs   *auth.Certs
+	baseURL string
+}
+
+// NewMagicLinkResource create a new magic link resource which signs users in using the
+// auth resource, the base URL is used to build the links which are emailed to users.
+func NewMagicLinkResource(ar *AuthResource, links magiclinks.MagicLinkStore, mailer mailer.Mailer, baseURL string) *MagicLinkResource {
+	return &MagicLinkResource{ar, ar.store, links, mailer, ar.certs, strings.TrimSuffix(baseURL, "/")}
+}
+
+// Register register the magic link resource with the rest container.
+func (mr MagicLinkResource) Register(container *restful.Container) {
+	ws := new(restful.WebService)
+
+	ws.Path(magicLinkPath).
+		Doc("Passwordless sign in services").Produces(restful.MIME_JSON)
+
+	ws.Route(ws.POST("/").Consumes("application/x-www-form-urlencoded").
+		To(mr.requestMagicLink).Doc("Email a sign in link to the user").Operation("requestMagicLink"))
+
+	ws.Route(ws.GET("/callback").
+		Param(ws.QueryParameter("token", "magic link token").DataType("string")).
+		To(mr.signInMagicLink).Doc("Sign in using a magic link").Operation("signInMagicLink"))
+
+	container.Add(ws)
+}
+
+func (mr MagicLinkResource) requestMagicLink(req *restful.Request, resp *restful.Response) {
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	err := req.Request.ParseForm()
+	if err != nil {
+		resp.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mlreq := new(models.MagicLinkRequest)
+	err = decoder.Decode(mlreq, req.Request.PostForm)
+	if err != nil {
+		resp.WriteErrorString(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if mlreq.Login == "" {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errorMsg("bad request missing login"))
+		return
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	// the nonce cookie binds the link to this browser
+	http.SetCookie(resp, &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Value:    nonce,
+		Path:     magicLinkPath,
+		MaxAge:   int(MagicLinkTTL.Seconds()),
+		Secure:   strings.HasPrefix(mr.baseURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	usr, err := mr.store.GetByLogin(ctx, mlreq.Login)
+	if err != nil {
+		// don't reveal whether or not the user exists
+		if err == users.ErrUserNotFound {
+			resp.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	// disabled users can't sign in so don't send them a link
+	if usr.DisabledAt != nil {
+		resp.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	link, err := mr.links.Create(&models.MagicLink{
+		UserID:    usr.ID,
+		ExpiresAt: time.Now().Add(MagicLinkTTL),
+	})
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	tok, err := auth.GenerateMagicLinkClaim(mr.certs, link, hashNonce(nonce))
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	body := fmt.Sprintf("Follow this link to sign in, it expires in %s.\n\n%s%s/callback?token=%s\n",
+		MagicLinkTTL, mr.baseURL, magicLinkPath, url.QueryEscape(tok))
+
+	err = mr.mailer.Send(models.StringValue(usr.Email), "Your sign in link", body)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	metrics.TokenIssued("magic_link")
+
+	resp.WriteHeader(http.StatusAccepted)
+}
+
+func (mr MagicLinkResource) signInMagicLink(req *restful.Request, resp *restful.Response) {
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	token := req.QueryParameter("token")
+
+	if token == "" {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errorMsg("bad request missing token"))
+		return
+	}
+
+	claim, err := auth.ValidateMagicLinkClaim(mr.certs, token)
+	if err != nil {
+		metrics.SignIn(false, "magic_link_"+tokenRejectReason(err))
+		resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+		return
+	}
+
+	cookie, err := req.Request.Cookie(magicLinkNonceCookie)
+	if err != nil {
+		metrics.SignIn(false, "magic_link_nonce")
+		resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashNonce(cookie.Value)), []byte(claim.NonceHash)) != 1 {
+		metrics.SignIn(false, "magic_link_nonce")
+		resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+		return
+	}
+
+	link, err := mr.links.Consume(claim.LinkID)
+	if err != nil {
+		if err == magiclinks.ErrMagicLinkNotFound {
+			metrics.SignIn(false, "magic_link_used")
+			resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+			return
+		}
+
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	if models.StringValue(link.UserID) != claim.UserID || time.Now().After(link.ExpiresAt) {
+		metrics.SignIn(false, "magic_link_expired")
+		resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+		return
+	}
+
+	usr, err := mr.store.GetByID(ctx, claim.UserID)
+	if err != nil {
+		if err == users.ErrUserNotFound {
+			metrics.SignIn(false, "unknown_user")
+			resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+			return
+		}
+
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	// the link has been used so the nonce is no longer required
+	http.SetCookie(resp, &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Path:     magicLinkPath,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	mr.ar.signIn(ctx, req, resp, usr)
+}
+
+func newNonce() (string, error) {
+	buf := make([]byte, 32)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
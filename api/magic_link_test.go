@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/store/magiclinks"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+type testMailer struct {
+	to   string
+	body string
+}
+
+func (tm *testMailer) Send(to, subject, body string) error {
+	tm.to = to
+	tm.body = body
+	return nil
+}
+
+func TestMagicLinkSignIn(t *testing.T) {
+
+	mr, mailer := setupMagicLinkResource(t)
+
+	token, nonce := requestMagicLink(t, mr, mailer)
+
+	if mailer.to != "mark@wolfe.id.au" {
+		t.Errorf("expected link mailed to mark@wolfe.id.au got %s", mailer.to)
+	}
+
+	req := newRequest("GET", "http://api.his.com/auth/magic_link/callback?token="+url.QueryEscape(token), nil)
+	req.Request.AddCookie(nonce)
+
+	recorder, resp := newResponse()
+
+	mr.signInMagicLink(req, resp)
+
+	if recorder.Code != 200 {
+		t.Errorf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder.Header().Get("Authorization") == "" {
+		t.Errorf("expected authorization header to exist")
+	}
+
+	// links are single use
+	req = newRequest("GET", "http://api.his.com/auth/magic_link/callback?token="+url.QueryEscape(token), nil)
+	req.Request.AddCookie(nonce)
+
+	recorder, resp = newResponse()
+
+	mr.signInMagicLink(req, resp)
+
+	if recorder.Code != 403 {
+		t.Errorf("expected 403 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestMagicLinkSignInWrongBrowser(t *testing.T) {
+
+	mr, mailer := setupMagicLinkResource(t)
+
+	token, _ := requestMagicLink(t, mr, mailer)
+
+	req := newRequest("GET", "http://api.his.com/auth/magic_link/callback?token="+url.QueryEscape(token), nil)
+	req.Request.AddCookie(&http.Cookie{Name: magicLinkNonceCookie, Value: "notthenonce"})
+
+	recorder, resp := newResponse()
+
+	mr.signInMagicLink(req, resp)
+
+	if recorder.Code != 403 {
+		t.Errorf("expected 403 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestMagicLinkUnknownUser(t *testing.T) {
+
+	mr, mailer := setupMagicLinkResource(t)
+
+	req := newFormRequest("POST", "http://api.his.com/auth/magic_link", bytes.NewBufferString("login=nothere"))
+	recorder, resp := newResponse()
+
+	mr.requestMagicLink(req, resp)
+
+	if recorder.Code != 202 {
+		t.Errorf("expected 202 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if mailer.to != "" {
+		t.Errorf("expected no mail to be sent got %s", mailer.to)
+	}
+}
+
+func setupMagicLinkResource(t *testing.T) (*MagicLinkResource, *testMailer) {
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	mailer := new(testMailer)
+
+	ar := NewAuthResource(store, nil, certs, nil, nil, nil)
+
+	return NewMagicLinkResource(ar, magiclinks.NewMagicLinkStoreLocal(), mailer, "http://api.his.com"), mailer
+}
+
+func requestMagicLink(t *testing.T, mr *MagicLinkResource, mailer *testMailer) (string, *http.Cookie) {
+	req := newFormRequest("POST", "http://api.his.com/auth/magic_link", bytes.NewBufferString("login=wolfeidau"))
+	recorder, resp := newResponse()
+
+	mr.requestMagicLink(req, resp)
+
+	if recorder.Code != 202 {
+		t.Fatalf("expected 202 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	cookies := (&http.Response{Header: recorder.Header()}).Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected nonce cookie to be set")
+	}
+
+	lines := strings.Split(strings.TrimSpace(mailer.body), "\n")
+
+	u, err := url.Parse(lines[len(lines)-1])
+	if err != nil {
+		t.Fatalf("error parsing link %v", err)
+	}
+
+	return u.Query().Get("token"), cookies[0]
+}
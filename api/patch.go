@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/evanphx/json-patch"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+const (
+	// MIMEMergePatch JSON Merge Patch, RFC 7396
+	MIMEMergePatch = "application/merge-patch+json"
+	// MIMEJSONPatch JSON Patch, RFC 6902
+	MIMEJSONPatch = "application/json-patch+json"
+)
+
+var errUnsupportedPatch = errors.New("Unsupported patch type.")
+
+// patchUser apply the patch to the JSON representation of the user, the patch type is
+// selected using the content type.
+func patchUser(usr *models.User, contentType string, patch []byte) (*models.User, error) {
+
+	doc, err := json.Marshal(usr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.TrimSpace(strings.Split(contentType, ";")[0]) {
+	case MIMEMergePatch:
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	case MIMEJSONPatch:
+		var ops jsonpatch.Patch
+
+		ops, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			doc, err = ops.Apply(doc)
+		}
+	default:
+		return nil, errUnsupportedPatch
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	patched := new(models.User)
+
+	err = json.Unmarshal(doc, patched)
+	if err != nil {
+		return nil, err
+	}
+
+	return patched, nil
+}
+
+// diffUser return a user holding only the fields which differ between patched and
+// current, along with an update mask naming the changed fields which can be updated.
+// Both users should have been through the same JSON encoding so times compare equal.
+func diffUser(patched, current *models.User) (*models.User, []string) {
+
+	changes := new(models.User)
+
+	var mask []string
+
+	pv := reflect.ValueOf(patched).Elem()
+	cv := reflect.ValueOf(current).Elem()
+	dv := reflect.ValueOf(changes).Elem()
+
+	for i := 0; i < pv.NumField(); i++ {
+		if reflect.DeepEqual(pv.Field(i).Interface(), cv.Field(i).Interface()) {
+			continue
+		}
+
+		dv.Field(i).Set(pv.Field(i))
+
+		name := strings.Split(pv.Type().Field(i).Tag.Get("json"), ",")[0]
+
+		for _, f := range users.UpdatableFields {
+			if f == name {
+				mask = append(mask, name)
+			}
+		}
+	}
+
+	return changes, mask
+}
+
+// userMask the update mask naming the fields which were supplied in the user
+func userMask(usr *models.User) []string {
+
+	var mask []string
+
+	for _, f := range users.UpdatableFields {
+		v := reflect.ValueOf(usr).Elem().FieldByNameFunc(func(name string) bool {
+			return strings.EqualFold(name, f)
+		})
+
+		if !v.IsNil() {
+			mask = append(mask, f)
+		}
+	}
+
+	return mask
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+)
+
+// requireScope build a filter which rejects requests authenticated with a token which is
+// restricted to other scopes, it must follow the authentication filter.
+func requireScope(scope string) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+		scopes, _ := req.Attribute("scopes").([]string)
+
+		if !auth.HasScope(scopes, scope) {
+			resp.WriteErrorString(403, "403: Token Lacks Scope "+scope)
+			return
+		}
+
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// requireFullAccess reject requests authenticated with a personal access token or a
+// token restricted to scopes, so a leaked token can't be used to take over the user by
+// changing their password or minting new tokens.
+func requireFullAccess(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+	tokenID, _ := req.Attribute("token_id").(string)
+	scopes, _ := req.Attribute("scopes").([]string)
+
+	if tokenID != "" || len(scopes) != 0 {
+		resp.WriteErrorString(403, "403: Not Allowed With An Access Token")
+		return
+	}
+
+	chain.ProcessFilter(req, resp)
+}
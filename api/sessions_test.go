@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+func TestListAndRevokeSessions(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	sessionStore := sessions.NewSessionStoreLocal()
+
+	ar := NewAuthResource(store, nil, certs, nil, sessionStore, nil)
+	ur := NewUserResource(store, nil, sessionStore, nil, nil)
+	filter := BuildJWTAuthFunc(store, certs, nil, sessionStore, nil)
+
+	req := newFormRequest("POST", "http://api.his.com/auth/sign_in", bytes.NewBufferString("login=wolfeidau&password=Somewh3r3 there is a cow!"))
+	req.Request.Header.Set("User-Agent", "test-agent")
+	recorder, resp := newResponse()
+
+	ar.authenticateUser(req, resp)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	authorization := recorder.Header().Get("Authorization")
+
+	recorder = filterRequest(filter, "GET", authorization, ur.listSessions)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	list := []*models.Session{}
+
+	err = json.Unmarshal(recorder.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatalf("error decoding sessions %v", err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("expected 1 session got %d", len(list))
+	}
+
+	if !list[0].Current || models.StringValue(list[0].UserAgent) != "test-agent" {
+		t.Errorf("expected current session with user agent got %s", recorder.Body.String())
+	}
+
+	req = newRequest("DELETE", "http://api.his.com/users/sessions/"+models.StringValue(list[0].ID), nil)
+	req.SetAttribute("user_id", "123")
+	req.PathParameters()["session_id"] = models.StringValue(list[0].ID)
+	recorder, resp = newResponse()
+
+	ur.revokeSession(req, resp)
+
+	if recorder.Code != 204 {
+		t.Fatalf("expected 204 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// the token is now bound to a revoked session
+	recorder = filterRequest(filter, "GET", authorization, ur.listSessions)
+
+	if recorder.Code != 401 {
+		t.Errorf("expected 401 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+
+	sessionStore := sessions.NewSessionStoreLocal()
+
+	session, _ := sessionStore.Create(&models.Session{UserID: models.String("456")})
+
+	ur := NewUserResource(users.NewUserStoreLocal(), nil, sessionStore, nil, nil)
+
+	req := newRequest("DELETE", "http://api.his.com/users/sessions/"+models.StringValue(session.ID), nil)
+	req.SetAttribute("user_id", "123")
+	req.PathParameters()["session_id"] = models.StringValue(session.ID)
+	recorder, resp := newResponse()
+
+	ur.revokeSession(req, resp)
+
+	if recorder.Code != 404 {
+		t.Errorf("expected 404 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func filterRequest(filter restful.FilterFunction, method, authorization string, target restful.RouteFunction) *httptest.ResponseRecorder {
+	req := newRequest(method, "http://api.his.com/users", strings.NewReader(""))
+	req.Request.Header.Set("Authorization", authorization)
+
+	recorder, resp := newResponse()
+
+	filter(req, resp, &restful.FilterChain{Target: target})
+
+	return recorder
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/tokens"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+const createTokenJSON = `{"name":"ci","scopes":["users:read"]}`
+
+func TestCreateAndUseAccessToken(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	tokenStore := tokens.NewAccessTokenStoreLocal()
+
+	ur := NewUserResource(store, nil, nil, nil, tokenStore)
+	filter := BuildJWTAuthFunc(store, certs, nil, nil, tokenStore)
+
+	req := newRequest("POST", "http://api.his.com/users/tokens", bytes.NewBufferString(createTokenJSON))
+	req.SetAttribute("user_id", "123")
+	recorder, resp := newResponse()
+
+	ur.createToken(req, resp)
+
+	if recorder.Code != 201 {
+		t.Fatalf("expected 201 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	pat := new(models.AccessToken)
+
+	err = json.Unmarshal(recorder.Body.Bytes(), pat)
+	if err != nil {
+		t.Fatalf("error decoding token %v", err)
+	}
+
+	if !auth.IsAccessToken(models.StringValue(pat.Token)) {
+		t.Fatalf("expected a personal access token got %s", models.StringValue(pat.Token))
+	}
+
+	recorder = filterRequest(filter, "GET", "Bearer "+models.StringValue(pat.Token), ur.listTokens)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	list := []*models.AccessToken{}
+
+	err = json.Unmarshal(recorder.Body.Bytes(), &list)
+	if err != nil {
+		t.Fatalf("error decoding tokens %v", err)
+	}
+
+	if len(list) != 1 || list[0].Token != nil || list[0].LastUsedAt == nil {
+		t.Errorf("expected one token without the secret which has been used got %s", recorder.Body.String())
+	}
+
+	req = newRequest("DELETE", "http://api.his.com/users/tokens/"+models.StringValue(pat.ID), nil)
+	req.SetAttribute("user_id", "123")
+	req.PathParameters()["token_id"] = models.StringValue(pat.ID)
+	recorder, resp = newResponse()
+
+	ur.revokeToken(req, resp)
+
+	if recorder.Code != 204 {
+		t.Fatalf("expected 204 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = filterRequest(filter, "GET", "Bearer "+models.StringValue(pat.Token), ur.listTokens)
+
+	if recorder.Code != 401 {
+		t.Errorf("expected 401 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestExpiredAccessToken(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	tokenStore := tokens.NewAccessTokenStoreLocal()
+
+	token, hash, _ := auth.GenerateAccessToken()
+	expired := time.Now().Add(-time.Minute)
+
+	tokenStore.Create(&models.AccessToken{UserID: models.String("123"), Hash: models.String(hash), ExpiresAt: &expired})
+
+	ur := NewUserResource(users.NewUserStoreLocal(), nil, nil, nil, tokenStore)
+	filter := BuildJWTAuthFunc(users.NewUserStoreLocal(), certs, nil, nil, tokenStore)
+
+	recorder := filterRequest(filter, "GET", "Bearer "+token, ur.listTokens)
+
+	if recorder.Code != 401 {
+		t.Errorf("expected 401 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	usr, _ := store.Create(context.Background(), NewUser())
+
+	tokenStore := tokens.NewAccessTokenStoreLocal()
+
+	scoped, hash, _ := auth.GenerateAccessToken()
+	tokenStore.Create(&models.AccessToken{UserID: models.String("123"), Hash: models.String(hash), Scopes: []string{auth.ScopeUsersRead}})
+
+	unscoped, hash, _ := auth.GenerateAccessToken()
+	tokenStore.Create(&models.AccessToken{UserID: models.String("123"), Hash: models.String(hash)})
+
+	scopedJWT, _ := auth.GenerateClaimWithOptions(certs, usr, auth.ClaimOptions{Scopes: []string{auth.ScopeUsersRead}})
+
+	filter := BuildJWTAuthFunc(store, certs, nil, nil, tokenStore)
+
+	container := restful.NewContainer()
+	NewUserResource(store, filter, nil, nil, tokenStore).Register(container)
+
+	testCases := []struct {
+		token    string
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{token: scoped, method: "GET", path: "/users/", expected: 200},
+		{token: scoped, method: "GET", path: "/users/export", expected: 200},
+		{token: scoped, method: "PUT", path: "/users/", body: `{"name":"Someone Else"}`, expected: 403},
+		{token: scoped, method: "PATCH", path: "/users/", body: `{"name":"Someone Else"}`, expected: 403},
+		{token: scoped, method: "GET", path: "/users/tokens", expected: 403},
+		{token: scoped, method: "PUT", path: "/users/password", body: `{"password":"stolen"}`, expected: 403},
+		{token: scoped, method: "DELETE", path: "/users/", body: `{"password":"stolen"}`, expected: 403},
+		{token: scoped, method: "POST", path: "/users/tokens", body: `{"name":"escalate"}`, expected: 403},
+		{token: scopedJWT, method: "GET", path: "/users/", expected: 200},
+		{token: scopedJWT, method: "PUT", path: "/users/", body: `{"name":"Someone Else"}`, expected: 403},
+		{token: scopedJWT, method: "POST", path: "/users/tokens", body: `{"name":"escalate"}`, expected: 403},
+		{token: unscoped, method: "GET", path: "/users/tokens", expected: 200},
+		{token: unscoped, method: "POST", path: "/users/tokens", body: `{"name":"escalate"}`, expected: 403},
+		{token: unscoped, method: "DELETE", path: "/users/tokens/1", expected: 403},
+		{token: unscoped, method: "PUT", path: "/users/password", body: `{"password":"stolen"}`, expected: 403},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, "http://api.his.com"+tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", restful.MIME_JSON)
+		if tc.method == "PATCH" {
+			req.Header.Set("Content-Type", MIMEMergePatch)
+		}
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+
+		recorder := httptest.NewRecorder()
+
+		container.ServeHTTP(recorder, req)
+
+		if recorder.Code != tc.expected {
+			t.Errorf("%s %s expected %d got %d %s", tc.method, tc.path, tc.expected, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestAccessTokenOfDeletedUser(t *testing.T) {
+
+	certs, err := auth.GenerateTestCerts()
+	if err != nil {
+		t.Fatalf("error generating test certs %v", err)
+	}
+
+	store := users.NewUserStoreLocal()
+
+	store.Create(context.Background(), NewUser())
+
+	tokenStore := tokens.NewAccessTokenStoreLocal()
+
+	token, hash, _ := auth.GenerateAccessToken()
+	tokenStore.Create(&models.AccessToken{UserID: models.String("123"), Hash: models.String(hash)})
+
+	ur := NewUserResource(store, nil, nil, nil, tokenStore)
+	filter := BuildJWTAuthFunc(store, certs, nil, nil, tokenStore)
+
+	recorder := filterRequest(filter, "GET", "Bearer "+token, ur.listTokens)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// deleted directly in the store, as the admin commands and purger do
+	err = store.Delete(context.Background(), "123")
+	if err != nil {
+		t.Fatalf("error deleting user %v", err)
+	}
+
+	recorder = filterRequest(filter, "GET", "Bearer "+token, ur.listTokens)
+
+	if recorder.Code != 401 {
+		t.Errorf("expected 401 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -1,10 +1,21 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/emicklei/go-restful"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/metrics"
 	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/privacy"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/tokens"
 	"github.com/wolfeidau/authinator/store/users"
 	"github.com/wolfeidau/authinator/util"
 	"github.com/wolfeidau/authinator/validation"
@@ -14,11 +25,15 @@ import (
 type UserResource struct {
 	store      users.UserStore
 	authFilter restful.FilterFunction
+	sessions   sessions.SessionStore
+	history    history.LoginHistoryStore
+	tokens     tokens.AccessTokenStore
 }
 
-// NewUserResource create a new user resource
-func NewUserResource(store users.UserStore, authFilter restful.FilterFunction) *UserResource {
-	return &UserResource{store, authFilter}
+// NewUserResource create a new user resource, if sessions, history or tokens are nil the
+// related routes aren't registered.
+func NewUserResource(store users.UserStore, authFilter restful.FilterFunction, sessionStore sessions.SessionStore, historyStore history.LoginHistoryStore, tokenStore tokens.AccessTokenStore) *UserResource {
+	return &UserResource{store, authFilter, sessionStore, historyStore, tokenStore}
 }
 
 // Register register the user resource with the rest container.
@@ -30,27 +45,77 @@ func (ur UserResource) Register(container *restful.Container) {
 	ws.Path("/users").
 		Doc("User services").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
 
-	ws.Route(ws.GET("/").Filter(ur.authFilter).To(ur.getUser).
+	ws.Route(ws.GET("/").Filter(ur.authFilter).Filter(requireScope(auth.ScopeUsersRead)).To(ur.getUser).
 		Doc("Get the current user").
 		Operation("getUser").Reads(models.User{}))
 
-	ws.Route(ws.PUT("/").Filter(ur.authFilter).To(ur.updateUser).
+	ws.Route(ws.PUT("/").Filter(ur.authFilter).Filter(requireScope(auth.ScopeUsersWrite)).To(ur.updateUser).
 		Doc("Update your user information").
 		Operation("updateUser").Writes(models.User{}))
 
+	ws.Route(ws.PATCH("/").Filter(ur.authFilter).Filter(requireScope(auth.ScopeUsersWrite)).To(ur.patchUser).
+		Consumes(MIMEMergePatch, MIMEJSONPatch).
+		Doc("Patch your user information using a JSON Merge Patch or JSON Patch").
+		Operation("patchUser").Writes(models.User{}))
+
 	ws.Route(ws.POST("/").To(ur.createUser).
 		Doc("Register a new user").
 		Operation("createUser").Writes(models.User{}))
 
-	ws.Route(ws.PUT("/password").Filter(ur.authFilter).To(ur.updatePassword).
+	ws.Route(ws.PUT("/password").Filter(ur.authFilter).Filter(requireFullAccess).To(ur.updatePassword).
 		Doc("Update the current users password").
 		Operation("updatePassword").Writes(models.User{}))
 
+	ws.Route(ws.GET("/export").Filter(ur.authFilter).Filter(requireScope(auth.ScopeUsersRead)).To(ur.exportUser).
+		Produces(restful.MIME_JSON, MIMEZip).
+		Param(ws.QueryParameter("format", "json or zip, defaults to json").DataType("string")).
+		Doc("Export everything stored about the current user").
+		Operation("exportUser").Returns(http.StatusOK, "OK", models.UserExport{}))
+
+	ws.Route(ws.DELETE("/").Filter(ur.authFilter).Filter(requireFullAccess).To(ur.deleteUser).
+		Doc("Delete the current user, the password must be supplied to confirm").
+		Operation("deleteUser"))
+
+	if ur.sessions != nil {
+		ws.Route(ws.GET("/sessions").Filter(ur.authFilter).Filter(requireScope(auth.ScopeSessionsRead)).To(ur.listSessions).
+			Doc("List the current users active sessions").
+			Operation("listSessions").Returns(http.StatusOK, "OK", []models.Session{}))
+
+		ws.Route(ws.DELETE("/sessions/{session_id}").Filter(ur.authFilter).Filter(requireScope(auth.ScopeSessionsWrite)).To(ur.revokeSession).
+			Doc("Revoke one of the current users sessions").
+			Param(ws.PathParameter("session_id", "identifier of the session").DataType("string")).
+			Operation("revokeSession"))
+	}
+
+	if ur.history != nil {
+		ws.Route(ws.GET("/login_history").Filter(ur.authFilter).Filter(requireScope(auth.ScopeHistoryRead)).To(ur.listLoginHistory).
+			Doc("List the current users recent sign in attempts").
+			Operation("listLoginHistory").Returns(http.StatusOK, "OK", []models.LoginAttempt{}))
+	}
+
+	if ur.tokens != nil {
+		ws.Route(ws.POST("/tokens").Filter(ur.authFilter).Filter(requireFullAccess).To(ur.createToken).
+			Doc("Create a personal access token, the token is only returned once").
+			Operation("createToken").Reads(models.AccessToken{}).Returns(http.StatusCreated, "Created", models.AccessToken{}))
+
+		ws.Route(ws.GET("/tokens").Filter(ur.authFilter).Filter(requireScope(auth.ScopeTokensRead)).To(ur.listTokens).
+			Doc("List the current users personal access tokens").
+			Operation("listTokens").Returns(http.StatusOK, "OK", []models.AccessToken{}))
+
+		ws.Route(ws.DELETE("/tokens/{token_id}").Filter(ur.authFilter).Filter(requireFullAccess).To(ur.revokeToken).
+			Doc("Revoke one of the current users personal access tokens").
+			Param(ws.PathParameter("token_id", "identifier of the token").DataType("string")).
+			Operation("revokeToken"))
+	}
+
 	container.Add(ws)
 }
 
 func (ur UserResource) getUser(req *restful.Request, resp *restful.Response) {
 
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
 	userid, ok := req.Attribute("user_id").(string)
 
 	if !ok {
@@ -58,18 +123,23 @@ func (ur UserResource) getUser(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	usr, err := ur.store.GetByID(userid)
+	usr, err := ur.store.GetByID(ctx, userid)
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
 		return
 	}
 
+	resp.AddHeader("ETag", userETag(usr))
+
 	resp.WriteEntity(usr)
 }
 
 func (ur UserResource) updateUser(req *restful.Request, resp *restful.Response) {
 
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
 	userid, ok := req.Attribute("user_id").(string)
 
 	if !ok {
@@ -77,7 +147,7 @@ func (ur UserResource) updateUser(req *restful.Request, resp *restful.Response)
 		return
 	}
 
-	cusr, err := ur.store.GetByID(userid)
+	cusr, err := ur.store.GetByID(ctx, userid)
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
@@ -101,7 +171,93 @@ func (ur UserResource) updateUser(req *restful.Request, resp *restful.Response)
 		return
 	}
 
-	err = ur.store.Update(usr)
+	ur.saveUser(ctx, req, resp, cusr, usr, userMask(usr))
+}
+
+func (ur UserResource) patchUser(req *restful.Request, resp *restful.Response) {
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	cusr, err := ur.store.GetByID(ctx, userid)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
+		return
+	}
+
+	patch, err := ioutil.ReadAll(req.Request.Body)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errorMsg("Bad request."))
+		return
+	}
+
+	// round trip the current user through JSON so it compares equal to the patched user
+	current, err := patchUser(cusr, MIMEMergePatch, []byte("{}"))
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	patched, err := patchUser(cusr, req.HeaderParameter("Content-Type"), patch)
+	if err == errUnsupportedPatch {
+		resp.WriteHeaderAndEntity(http.StatusUnsupportedMediaType, errorMsg("Unsupported patch type."))
+		return
+	}
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errorMsg(fmt.Sprintf("Invalid patch: %s", err)))
+		return
+	}
+
+	changes, mask := diffUser(patched, current)
+
+	allErrs := validation.ValidateUserPatch(changes, patched, current)
+
+	if len(allErrs) != 0 {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, validationErrors("validation failed", allErrs))
+		return
+	}
+
+	// the patch was applied to the version which was read
+	patched.Version = cusr.Version
+
+	ur.saveUser(ctx, req, resp, cusr, patched, mask)
+}
+
+// saveUser update the masked fields of the user and return it, the If-Match header
+// is checked against the current user.
+func (ur UserResource) saveUser(ctx context.Context, req *restful.Request, resp *restful.Response, cusr, usr *models.User, mask []string) {
+
+	// the store rejects the update if the user changes after the precondition is checked
+	match := req.HeaderParameter("If-Match")
+	if match != "" {
+		if !ifMatch(match, cusr) {
+			resp.WriteHeaderAndEntity(http.StatusPreconditionFailed, errorMsg("User has been modified."))
+			return
+		}
+
+		usr.Version = cusr.Version
+	}
+
+	err := ur.store.Update(ctx, usr, mask)
+	if err == users.ErrConflict {
+		if match != "" {
+			resp.WriteHeaderAndEntity(http.StatusPreconditionFailed, errorMsg("User has been modified."))
+			return
+		}
+
+		resp.WriteHeaderAndEntity(http.StatusConflict, errorMsg("User has been modified."))
+		return
+	}
+
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
 		return
@@ -109,11 +265,16 @@ func (ur UserResource) updateUser(req *restful.Request, resp *restful.Response)
 
 	usr.Password = nil
 
+	resp.AddHeader("ETag", userETag(usr))
+
 	resp.WriteEntity(usr)
 }
 
 func (ur UserResource) createUser(req *restful.Request, resp *restful.Response) {
 
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
 	usr := new(models.User)
 	err := req.ReadEntity(usr)
 
@@ -129,7 +290,7 @@ func (ur UserResource) createUser(req *restful.Request, resp *restful.Response)
 		return
 	}
 
-	exists, err := ur.store.Exists(models.StringValue(usr.Login))
+	exists, err := ur.store.Exists(ctx, models.StringValue(usr.Login))
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
@@ -153,7 +314,12 @@ func (ur UserResource) createUser(req *restful.Request, resp *restful.Response)
 
 	usr.Password = models.String(pass)
 
-	nusr, err := ur.store.Create(usr)
+	nusr, err := ur.store.Create(ctx, usr)
+
+	if err == users.ErrUserAlreadyExists {
+		resp.WriteHeaderAndEntity(http.StatusConflict, errorMsg("User already exists."))
+		return
+	}
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
@@ -167,6 +333,9 @@ func (ur UserResource) createUser(req *restful.Request, resp *restful.Response)
 
 func (ur UserResource) updatePassword(req *restful.Request, resp *restful.Response) {
 
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
 	userid, ok := req.Attribute("user_id").(string)
 
 	if !ok {
@@ -174,7 +343,7 @@ func (ur UserResource) updatePassword(req *restful.Request, resp *restful.Respon
 		return
 	}
 
-	cusr, err := ur.store.GetByID(userid)
+	cusr, err := ur.store.GetByID(ctx, userid)
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
@@ -206,7 +375,22 @@ func (ur UserResource) updatePassword(req *restful.Request, resp *restful.Respon
 
 	cusr.Password = models.String(pass)
 
-	err = ur.store.Update(cusr)
+	err = ur.store.Update(ctx, cusr, []string{users.FieldPassword})
+
+	if err == users.ErrConflict {
+		resp.WriteHeaderAndEntity(http.StatusConflict, errorMsg("User has been modified."))
+		return
+	}
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	// sign out everywhere else in case the old password was stolen
+	current, _ := req.Attribute("session_id").(string)
+
+	err = ur.revokeSessions(userid, current)
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
@@ -215,3 +399,344 @@ func (ur UserResource) updatePassword(req *restful.Request, resp *restful.Respon
 
 	resp.WriteHeader(http.StatusOK)
 }
+
+func (ur UserResource) exportUser(req *restful.Request, resp *restful.Response) {
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	export, err := privacy.NewService(ur.store, ur.sessions, ur.history, ur.tokens).Export(ctx, userid)
+
+	if err == users.ErrUserNotFound {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
+		return
+	}
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	if req.QueryParameter("format") != "zip" {
+		resp.WriteEntity(export)
+		return
+	}
+
+	resp.AddHeader("Content-Type", MIMEZip)
+	resp.AddHeader("Content-Disposition", `attachment; filename="authinator-export.zip"`)
+
+	err = privacy.WriteZip(resp, export)
+
+	if err != nil {
+		log.Printf("writing user export failed: %s", err)
+	}
+}
+
+func (ur UserResource) deleteUser(req *restful.Request, resp *restful.Response) {
+
+	ctx, cancel := requestContext(req)
+	defer cancel()
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	cusr, err := ur.store.GetByID(ctx, userid)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
+		return
+	}
+
+	data := make(map[string]string)
+	err = req.ReadEntity(&data)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errorMsg("bad request missing password"))
+		return
+	}
+
+	password, ok := data["password"]
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errorMsg("bad request missing password"))
+		return
+	}
+
+	// confirm the deletion by checking the password again
+	phash, err := ur.store.GetPasswordByLogin(ctx, models.StringValue(cusr.Login))
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	ok, err = util.CompareHashPassword(password, phash)
+
+	if err != nil || !ok {
+		resp.WriteHeaderAndEntity(http.StatusForbidden, errorMsg("Auth failed."))
+		return
+	}
+
+	err = ur.store.Delete(ctx, userid)
+
+	if err == users.ErrUserNotFound {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("User not found."))
+		return
+	}
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	err = ur.revokeAll(userid)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	resp.WriteHeader(http.StatusOK)
+}
+
+// revokeAll revoke every session and personal access token of the user
+func (ur UserResource) revokeAll(userID string) error {
+
+	err := ur.revokeSessions(userID, "")
+	if err != nil {
+		return err
+	}
+
+	if ur.tokens != nil {
+		list, err := ur.tokens.ListByUser(userID)
+		if err != nil {
+			return err
+		}
+
+		for _, token := range list {
+			err = ur.tokens.Delete(models.StringValue(token.ID))
+			if err != nil && err != tokens.ErrAccessTokenNotFound {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// revokeSessions revoke the sessions of the user other than the one given
+func (ur UserResource) revokeSessions(userID, except string) error {
+
+	if ur.sessions == nil {
+		return nil
+	}
+
+	list, err := ur.sessions.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range list {
+		if models.StringValue(session.ID) == except {
+			continue
+		}
+
+		err = ur.sessions.Delete(models.StringValue(session.ID))
+		if err != nil && err != sessions.ErrSessionNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ur UserResource) listSessions(req *restful.Request, resp *restful.Response) {
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	list, err := ur.sessions.ListByUser(userid)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	current, _ := req.Attribute("session_id").(string)
+
+	for _, session := range list {
+		session.Current = models.StringValue(session.ID) == current
+	}
+
+	resp.WriteEntity(list)
+}
+
+func (ur UserResource) revokeSession(req *restful.Request, resp *restful.Response) {
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	sessionID := req.PathParameter("session_id")
+
+	session, err := ur.sessions.GetByID(sessionID)
+
+	// don't reveal sessions belonging to other users
+	if err == sessions.ErrSessionNotFound || (err == nil && models.StringValue(session.UserID) != userid) {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("Session not found."))
+		return
+	}
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	err = ur.sessions.Delete(sessionID)
+
+	if err != nil && err != sessions.ErrSessionNotFound {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+func (ur UserResource) listLoginHistory(req *restful.Request, resp *restful.Response) {
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	list, err := ur.history.ListByUser(userid)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	resp.WriteEntity(list)
+}
+
+func (ur UserResource) createToken(req *restful.Request, resp *restful.Response) {
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	pat := new(models.AccessToken)
+	err := req.ReadEntity(pat)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errorMsg("bad request invalid token"))
+		return
+	}
+
+	allErrs := validation.ValidateAccessTokenCreate(pat)
+
+	if len(allErrs) != 0 {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, validationErrors("validation failed", allErrs))
+		return
+	}
+
+	token, hash, err := auth.GenerateAccessToken()
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	now := time.Now()
+
+	pat.UserID = models.String(userid)
+	pat.Hash = models.String(hash)
+	pat.CreatedAt = &now
+
+	pat, err = ur.tokens.Create(pat)
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	metrics.TokenIssued("access_token")
+
+	// this is the only time the token is returned
+	pat.Token = models.String(token)
+
+	resp.WriteHeaderAndEntity(http.StatusCreated, pat)
+}
+
+func (ur UserResource) listTokens(req *restful.Request, resp *restful.Response) {
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	list, err := ur.tokens.ListByUser(userid)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	resp.WriteEntity(list)
+}
+
+func (ur UserResource) revokeToken(req *restful.Request, resp *restful.Response) {
+
+	userid, ok := req.Attribute("user_id").(string)
+
+	if !ok {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	tokenID := req.PathParameter("token_id")
+
+	pat, err := ur.tokens.GetByID(tokenID)
+
+	// don't reveal tokens belonging to other users
+	if err == tokens.ErrAccessTokenNotFound || (err == nil && models.StringValue(pat.UserID) != userid) {
+		resp.WriteHeaderAndEntity(http.StatusNotFound, errorMsg("Access token not found."))
+		return
+	}
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	err = ur.tokens.Delete(tokenID)
+
+	if err != nil && err != tokens.ErrAccessTokenNotFound {
+		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errorMsg("Server error."))
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
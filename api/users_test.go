@@ -2,13 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/emicklei/go-restful"
 	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/sessions"
 	"github.com/wolfeidau/authinator/store/users"
 )
 
@@ -39,7 +42,7 @@ func TestGetUser(t *testing.T) {
 
 func TestCreateUser(t *testing.T) {
 
-	ws := NewUserResource(users.NewUserStoreLocal(), nil)
+	ws := NewUserResource(users.NewUserStoreLocal(), nil, nil, nil, nil)
 
 	req := newRequest("POST", "http://api.his.com/users", bytes.NewBufferString(newUserJSON))
 	recorder, resp := newResponse()
@@ -69,6 +72,93 @@ func TestUpdateUser(t *testing.T) {
 	}
 }
 
+func TestUpdateUserIfMatch(t *testing.T) {
+
+	_, ws := setupResourceAndStore()
+
+	req := newRequest("GET", "http://api.his.com/users", nil)
+	req.SetAttribute("user_id", "123")
+
+	recorder, resp := newResponse()
+
+	ws.getUser(req, resp)
+
+	etag := recorder.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\" got %q", etag)
+	}
+
+	req = newRequest("PUT", "http://api.his.com/users", bytes.NewBufferString(updateUserJSON))
+	req.Request.Header.Set("If-Match", etag)
+	req.SetAttribute("user_id", "123")
+
+	recorder, resp = newResponse()
+
+	ws.updateUser(req, resp)
+
+	if recorder.Code != 200 {
+		t.Errorf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder.Header().Get("ETag") != `"2"` {
+		t.Errorf("expected ETag \"2\" got %q", recorder.Header().Get("ETag"))
+	}
+
+	// the original ETag is now stale
+	req = newRequest("PUT", "http://api.his.com/users", bytes.NewBufferString(updateUserJSON))
+	req.Request.Header.Set("If-Match", etag)
+	req.SetAttribute("user_id", "123")
+
+	recorder, resp = newResponse()
+
+	ws.updateUser(req, resp)
+
+	if recorder.Code != 412 {
+		t.Errorf("expected 412 got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+
+	testCases := []struct {
+		contentType string
+		patch       string
+		code        int
+		name        string
+	}{
+		{MIMEMergePatch, `{"name":"Mark Wolf"}`, 200, "Mark Wolf"},
+		{MIMEMergePatch, `{"name":null}`, 200, ""},
+		{MIMEJSONPatch, `[{"op":"replace","path":"/name","value":"Mark Wolf"}]`, 200, "Mark Wolf"},
+		{MIMEJSONPatch, `[{"op":"test","path":"/name","value":"Someone"}]`, 400, "Mark Wolfe"},
+		{MIMEMergePatch, `{"login":"markw"}`, 400, "Mark Wolfe"},
+		{MIMEMergePatch, `{"email":null}`, 400, "Mark Wolfe"},
+		{MIMEMergePatch, `{"password":"Somewh3r3 there is a cow!"}`, 400, "Mark Wolfe"},
+		{restful.MIME_JSON, `{"name":"Mark Wolf"}`, 415, "Mark Wolfe"},
+	}
+
+	for _, tc := range testCases {
+		store, ws := setupResourceAndStore()
+
+		req := newRequest("PATCH", "http://api.his.com/users", bytes.NewBufferString(tc.patch))
+		req.Request.Header.Set("Content-Type", tc.contentType)
+		req.SetAttribute("user_id", "123")
+
+		recorder, resp := newResponse()
+
+		ws.patchUser(req, resp)
+
+		if recorder.Code != tc.code {
+			t.Errorf("%s expected %d got %d %s", tc.patch, tc.code, recorder.Code, recorder.Body.String())
+		}
+
+		usr, _ := store.GetByID(context.Background(), "123")
+
+		if models.StringValue(usr.Name) != tc.name {
+			t.Errorf("%s expected name %q got %q", tc.patch, tc.name, models.StringValue(usr.Name))
+		}
+	}
+}
+
 func TestUpdatePassword(t *testing.T) {
 
 	_, ws := setupResourceAndStore()
@@ -87,12 +177,130 @@ func TestUpdatePassword(t *testing.T) {
 	}
 }
 
+func TestUpdatePasswordRevokesOtherSessions(t *testing.T) {
+
+	store := users.NewUserStoreLocal()
+	store.Create(context.Background(), NewUser())
+
+	sessionStore := sessions.NewSessionStoreLocal()
+	current, _ := sessionStore.Create(&models.Session{UserID: models.String("123")})
+	other, _ := sessionStore.Create(&models.Session{UserID: models.String("123")})
+	another, _ := sessionStore.Create(&models.Session{UserID: models.String("456")})
+
+	ws := NewUserResource(store, nil, sessionStore, nil, nil)
+
+	req := newRequest("PUT", "http://api.his.com/users/password", bytes.NewBufferString(updatePasswordJSON))
+	req.SetAttribute("user_id", "123")
+	req.SetAttribute("session_id", models.StringValue(current.ID))
+
+	recorder, resp := newResponse()
+
+	ws.updatePassword(req, resp)
+
+	if recorder.Code != 200 {
+		t.Errorf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	_, err := sessionStore.GetByID(models.StringValue(current.ID))
+	if err != nil {
+		t.Errorf("expected the current session to be kept got %v", err)
+	}
+
+	_, err = sessionStore.GetByID(models.StringValue(other.ID))
+	if err != sessions.ErrSessionNotFound {
+		t.Errorf("expected the other session to be revoked got %v", err)
+	}
+
+	_, err = sessionStore.GetByID(models.StringValue(another.ID))
+	if err != nil {
+		t.Errorf("expected another user's session to be kept got %v", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+
+	store := users.NewUserStoreLocal()
+	store.Create(context.Background(), NewUser())
+
+	sessionStore := sessions.NewSessionStoreLocal()
+	session, _ := sessionStore.Create(&models.Session{UserID: models.String("123")})
+
+	ws := NewUserResource(store, nil, sessionStore, nil, nil)
+
+	req := newRequest("DELETE", "http://api.his.com/users", bytes.NewBufferString(`{"password":"wrong"}`))
+	req.SetAttribute("user_id", "123")
+
+	recorder, resp := newResponse()
+
+	ws.deleteUser(req, resp)
+
+	if recorder.Code != 403 {
+		t.Errorf("expected 403 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	req = newRequest("DELETE", "http://api.his.com/users", bytes.NewBufferString(updatePasswordJSON))
+	req.SetAttribute("user_id", "123")
+
+	recorder, resp = newResponse()
+
+	ws.deleteUser(req, resp)
+
+	if recorder.Code != 200 {
+		t.Errorf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	_, err := store.GetByID(context.Background(), "123")
+	if err != users.ErrUserNotFound {
+		t.Errorf("expected the user to be deleted got %v", err)
+	}
+
+	_, err = sessionStore.GetByID(models.StringValue(session.ID))
+	if err != sessions.ErrSessionNotFound {
+		t.Errorf("expected the session to be revoked got %v", err)
+	}
+}
+
+func TestExportUser(t *testing.T) {
+
+	_, ws := setupResourceAndStore()
+
+	req := newRequest("GET", "http://api.his.com/users/export", nil)
+	req.SetAttribute("user_id", "123")
+
+	recorder, resp := newResponse()
+
+	ws.exportUser(req, resp)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected 200 got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if !strings.Contains(recorder.Body.String(), `"login": "wolfeidau"`) {
+		t.Errorf("expected the export to contain the user got %s", recorder.Body.String())
+	}
+
+	req = newRequest("GET", "http://api.his.com/users/export?format=zip", nil)
+	req.SetAttribute("user_id", "123")
+
+	recorder, resp = newResponse()
+
+	ws.exportUser(req, resp)
+
+	if ct := recorder.Header().Get("Content-Type"); ct != MIMEZip {
+		t.Errorf("expected %s got %s", MIMEZip, ct)
+	}
+
+	if !bytes.HasPrefix(recorder.Body.Bytes(), []byte("PK")) {
+		t.Errorf("expected a zip archive")
+	}
+}
+
 func setupResourceAndStore() (users.UserStore, *UserResource) {
 	store := users.NewUserStoreLocal()
 
-	store.Create(NewUser())
+	store.Create(context.Background(), NewUser())
 
-	ws := NewUserResource(store, nil)
+	ws := NewUserResource(store, nil, nil, nil, nil)
 
 	return store, ws
 }
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// AccessTokenPrefix is prepended to personal access tokens so they are easy to
+	// recognise, for example by secret scanners.
+	AccessTokenPrefix = "authinator_pat_"
+)
+
+// GenerateAccessToken generate a new random personal access token and the hash
+// which should be stored.
+func GenerateAccessToken() (string, string, error) {
+	buf := make([]byte, 32)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	return token, HashAccessToken(token), nil
+}
+
+// HashAccessToken hash the personal access token, as the tokens are random and long
+// a fast hash is sufficient and enables lookups by hash.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAccessToken check if the token is a personal access token rather than a JWT
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateAccessToken(t *testing.T) {
+
+	token, hash, err := GenerateAccessToken()
+	if assert.NoError(t, err) {
+		assert.True(t, IsAccessToken(token))
+		assert.Equal(t, hash, HashAccessToken(token))
+		assert.NotContains(t, hash, AccessTokenPrefix)
+	}
+
+	assert.False(t, IsAccessToken("eyJhbGciOiJSUzUxMiJ9.e30.sig"))
+}
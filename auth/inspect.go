@@ -0,0 +1,149 @@
+package auth
+
+import (
+	gocrypto "crypto"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SermoDigital/jose/crypto"
+)
+
+var (
+	// ErrMalformedToken returned when the token isn't a compact JWT
+	ErrMalformedToken = errors.New("JWT token is malformed")
+
+	// ErrWrongAlgorithm returned when the token isn't signed with RS512
+	ErrWrongAlgorithm = errors.New("JWT token is signed with the wrong algorithm")
+
+	// ErrUnknownKeyID returned when the token names a key other than the signing key
+	ErrUnknownKeyID = errors.New("JWT token is signed by an unknown key")
+
+	// ErrBadSignature returned when the signature doesn't match the token
+	ErrBadSignature = errors.New("JWT token has a bad signature")
+
+	// ErrWrongIssuer returned when the token was issued by another issuer
+	ErrWrongIssuer = errors.New("JWT token was issued by another issuer")
+)
+
+// Token the header and claims of a JWT token
+type Token struct {
+	Header map[string]interface{}
+	Claims map[string]interface{}
+
+	signed    string
+	signature []byte
+}
+
+// Algorithm the signing algorithm from the alg header
+func (t *Token) Algorithm() string {
+	alg, _ := t.Header["alg"].(string)
+	return alg
+}
+
+// KeyID the signing key from the kid header, empty for tokens issued without one
+func (t *Token) KeyID() string {
+	kid, _ := t.Header["kid"].(string)
+	return kid
+}
+
+// Expiration the time the token expires from the exp claim
+func (t *Token) Expiration() (time.Time, bool) {
+	exp, ok := t.Claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+// Issuer the issuer from the iss claim, empty for tokens issued without one
+func (t *Token) Issuer() string {
+	iss, _ := t.Claims["iss"].(string)
+	return iss
+}
+
+// Scopes the scopes from the scopes claim, empty for tokens which aren't restricted
+func (t *Token) Scopes() []string {
+	list, _ := t.Claims["scopes"].([]interface{})
+
+	var scopes []string
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// DecodeToken decode the header and claims of the token without verifying it
+func DecodeToken(token string) (*Token, error) {
+
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	t := &Token{signed: parts[0] + "." + parts[1]}
+
+	for i, v := range []*map[string]interface{}{&t.Header, &t.Claims} {
+		buf, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return nil, ErrMalformedToken
+		}
+
+		err = json.Unmarshal(buf, v)
+		if err != nil {
+			return nil, ErrMalformedToken
+		}
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	t.signature = sig
+
+	return t, nil
+}
+
+// VerifyToken check the token was signed by the key in certs, hasn't expired and if
+// Issuer is set was issued by it, the error returned says precisely why the token was
+// rejected. Tokens without a kid header are checked against the signing key.
+func VerifyToken(certs *Certs, token string) (*Token, error) {
+
+	t, err := DecodeToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Algorithm() != crypto.SigningMethodRS512.Alg() {
+		return t, ErrWrongAlgorithm
+	}
+
+	if kid := t.KeyID(); kid != "" && kid != certs.KeyID() {
+		return t, ErrUnknownKeyID
+	}
+
+	sum := sha512.Sum512([]byte(t.signed))
+
+	err = rsa.VerifyPKCS1v15(certs.PublicKey, gocrypto.SHA512, sum[:], t.signature)
+	if err != nil {
+		return t, ErrBadSignature
+	}
+
+	exp, ok := t.Expiration()
+	if !ok || time.Now().After(exp) {
+		return t, ErrTokenExpired
+	}
+
+	if Issuer != "" && t.Issuer() != Issuer {
+		return t, ErrWrongIssuer
+	}
+
+	return t, nil
+}
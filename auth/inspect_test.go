@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+)
+
+func TestVerifyToken(t *testing.T) {
+
+	certs, err := GenerateTestCerts()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	other, err := GenerateTestCerts()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	usr := models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+
+	token, err := GenerateClaimWithOptions(certs, usr, ClaimOptions{TTL: time.Hour, Scopes: []string{"users:read"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tok, err := VerifyToken(certs, token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "RS512", tok.Algorithm())
+		assert.Equal(t, certs.KeyID(), tok.KeyID())
+		assert.Equal(t, []interface{}{"users:read"}, tok.Claims["scopes"])
+		assert.Equal(t, []string{"users:read"}, tok.Scopes())
+
+		exp, ok := tok.Expiration()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), exp, time.Minute)
+	}
+
+	expired, _ := GenerateClaimWithOptions(certs, usr, ClaimOptions{TTL: -time.Minute})
+
+	parts := strings.Split(token, ".")
+
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"user_id":"456","exp":4102444800}`)) + "." + parts[2]
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+
+	testCases := []struct {
+		token string
+		certs *Certs
+		err   error
+	}{
+		{token: expired, certs: certs, err: ErrTokenExpired},
+		{token: token, certs: other, err: ErrUnknownKeyID},
+		{token: tampered, certs: certs, err: ErrBadSignature},
+		{token: unsigned, certs: certs, err: ErrWrongAlgorithm},
+		{token: "not.a token", certs: certs, err: ErrMalformedToken},
+	}
+
+	for _, tc := range testCases {
+		_, err := VerifyToken(tc.certs, tc.token)
+		assert.Equal(t, tc.err, err)
+	}
+
+	// the claims can still be read from tokens which fail verification
+	tok, err = DecodeToken(expired)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "123", tok.Claims["user_id"])
+	}
+}
+
+func TestVerifyTokenIssuer(t *testing.T) {
+
+	certs, err := GenerateTestCerts()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	usr := models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+
+	defer func() { Issuer = "" }()
+
+	Issuer = "https://auth.example.com"
+
+	token, err := GenerateClaim(certs, usr)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tok, err := VerifyToken(certs, token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://auth.example.com", tok.Issuer())
+	}
+
+	Issuer = "https://other.example.com"
+
+	_, err = VerifyToken(certs, token)
+	assert.Equal(t, ErrWrongIssuer, err)
+}
+
+func TestLoadCerts(t *testing.T) {
+
+	certs, err := GenerateTestCerts()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f, err := ioutil.TempFile("", "signing-key")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	pem.Encode(f, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(certs.PrivateKey)})
+	f.Close()
+
+	loaded, err := LoadCerts(f.Name())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, certs.KeyID(), loaded.KeyID())
+
+	token, err := GenerateClaim(certs, models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	if assert.NoError(t, err) {
+		usr, err := ValidateClaim(loaded, token)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "123", models.StringValue(usr.ID))
+		}
+	}
+
+	_, err = LoadCerts(f.Name() + ".missing")
+	assert.Error(t, err)
+}
@@ -16,6 +16,27 @@ var (
 	ErrTokenExpired = errors.New("JWT token has expired")
 )
 
+var (
+	// DefaultTokenTTL how long tokens are valid for when no TTL is given
+	DefaultTokenTTL = 24 * time.Hour
+
+	// Issuer the iss claim of tokens, when it isn't empty tokens with another issuer are
+	// rejected
+	Issuer = ""
+)
+
+// ClaimOptions optional settings for the tokens generated by GenerateClaimWithOptions
+type ClaimOptions struct {
+	// SessionID binds the token to a session, if it is empty it is omitted
+	SessionID string
+
+	// TTL how long the token is valid for, if it is zero DefaultTokenTTL is used
+	TTL time.Duration
+
+	// Scopes added to the token in the scopes claim, if any
+	Scopes []string
+}
+
 // Certs used by JWT to sign and verify tokens
 type Certs struct {
 	PublicKey  *rsa.PublicKey
@@ -25,46 +46,101 @@ type Certs struct {
 // GenerateClaim generate a JWT token containing a claim using the supplied
 // certificates and user
 func GenerateClaim(certs *Certs, usr *models.User) (string, error) {
+	return GenerateClaimWithOptions(certs, usr, ClaimOptions{})
+}
+
+// GenerateSessionClaim generate a JWT token containing a claim using the supplied
+// certificates and user which is bound to a session, if the session ID is empty
+// it is omitted.
+func GenerateSessionClaim(certs *Certs, usr *models.User, sessionID string) (string, error) {
+	return GenerateClaimWithOptions(certs, usr, ClaimOptions{SessionID: sessionID})
+}
+
+// GenerateClaimWithOptions generate a JWT token containing a claim using the supplied
+// certificates, user and options
+func GenerateClaimWithOptions(certs *Certs, usr *models.User, opts ClaimOptions) (string, error) {
+
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = DefaultTokenTTL
+	}
+
 	// generate a token
 	var claims = jws.Claims{
 		"user_id": models.StringValue(usr.ID),
 		"login":   models.StringValue(usr.Login),
 		"email":   models.StringValue(usr.Email),
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"exp":     time.Now().Add(ttl).Unix(),
 	}
 
-	j := jws.NewJWT(claims, crypto.SigningMethodRS512)
-	b, err := j.Serialize(certs.PrivateKey)
+	if opts.SessionID != "" {
+		claims["session_id"] = opts.SessionID
+	}
 
-	return string(b), err
+	if len(opts.Scopes) != 0 {
+		claims["scopes"] = opts.Scopes
+	}
+
+	return signClaims(certs, claims)
 }
 
 // ValidateClaim validate the JWT token and return the user model
 // decoded from the claim
 func ValidateClaim(certs *Certs, token string) (*models.User, error) {
+	usr, _, err := ValidateSessionClaim(certs, token)
+	return usr, err
+}
+
+// ValidateSessionClaim validate the JWT token and return the user model and
+// session ID decoded from the claim, the session ID is empty if the token
+// isn't bound to a session.
+func ValidateSessionClaim(certs *Certs, token string) (*models.User, string, error) {
+	usr, sessionID, _, err := ValidateScopedClaim(certs, token)
+	return usr, sessionID, err
+}
+
+// ValidateScopedClaim validate the JWT token and return the user model, session ID
+// and scopes decoded from the claim, the scopes are empty if the token isn't
+// restricted.
+func ValidateScopedClaim(certs *Certs, token string) (*models.User, string, []string, error) {
 
 	usr := new(models.User)
 
-	w, err := jws.ParseJWT([]byte(token))
+	t, err := VerifyToken(certs, token)
 	if err != nil {
-		return nil, err
+		return nil, "", nil, err
 	}
 
-	if err := w.Validate(certs.PublicKey, crypto.SigningMethodRS512); err != nil {
-		return nil, err
+	claims := jwt.Claims(t.Claims)
+
+	// tokens issued for other purposes, such as magic links, carry a type
+	if claims.Has("typ") {
+		return nil, "", nil, ErrInvalidTokenType
 	}
 
-	_, isExpired := w.Claims().Expiration()
+	usr.Email = extractKey("email", claims)
+	usr.Login = extractKey("login", claims)
+	usr.ID = extractKey("user_id", claims)
 
-	if !isExpired {
-		return nil, ErrTokenExpired
+	return usr, models.StringValue(extractKey("session_id", claims)), t.Scopes(), nil
+}
+
+// signClaims sign the claims with the private key, naming it in the kid header
+func signClaims(certs *Certs, claims jws.Claims) (string, error) {
+
+	if Issuer != "" {
+		claims["iss"] = Issuer
+	}
+
+	j := jws.NewJWT(claims, crypto.SigningMethodRS512)
+
+	if s, ok := j.(jws.JWS); ok {
+		s.Protected().Set("kid", certs.KeyID())
 	}
 
-	usr.Email = extractKey("email", w.Claims())
-	usr.Login = extractKey("login", w.Claims())
-	usr.ID = extractKey("user_id", w.Claims())
+	b, err := j.Serialize(certs.PrivateKey)
 
-	return usr, nil
+	return string(b), err
 }
 
 func extractKey(key string, claims jwt.Claims) *string {
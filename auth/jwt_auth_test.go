@@ -32,3 +32,21 @@ func TestGenerateAndValidateClaim(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateAndValidateSessionClaim(t *testing.T) {
+
+	certs, err := GenerateTestCerts()
+	if assert.NoError(t, err) {
+
+		claim, err := GenerateSessionClaim(certs, models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"), "abc")
+
+		if assert.NoError(t, err) {
+
+			usr, sessionID, err := ValidateSessionClaim(certs, claim)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "123", models.StringValue(usr.ID))
+				assert.Equal(t, "abc", sessionID)
+			}
+		}
+	}
+}
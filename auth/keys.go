@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/SermoDigital/jose/crypto"
+)
+
+// LoadCerts load the PEM encoded RSA private key used to sign tokens, the public key used
+// to verify them is derived from it.
+func LoadCerts(privateKeyFile string) (*Certs, error) {
+
+	buf, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := crypto.ParseRSAPrivateKeyFromPEM(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certs{PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}, nil
+}
+
+// KeyID the ID of the signing key which is sent in the kid header of tokens, this is the
+// RFC 7638 thumbprint of the public key so it doesn't need to be configured.
+func (c *Certs) KeyID() string {
+
+	enc := base64.RawURLEncoding
+
+	// the members must be in lexicographic order, which json.Marshal does for maps
+	jwk, _ := json.Marshal(map[string]string{
+		"e":   enc.EncodeToString(big.NewInt(int64(c.PublicKey.E)).Bytes()),
+		"kty": "RSA",
+		"n":   enc.EncodeToString(c.PublicKey.N.Bytes()),
+	})
+
+	sum := sha256.Sum256(jwk)
+
+	return enc.EncodeToString(sum[:])
+}
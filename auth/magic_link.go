@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/SermoDigital/jose/jws"
+	"github.com/SermoDigital/jose/jwt"
+	"github.com/wolfeidau/authinator/models"
+)
+
+const (
+	// magicLinkType is the value of the typ claim in magic link tokens, this ensures
+	// they can't be used in place of a normal token.
+	magicLinkType = "magic_link"
+)
+
+var (
+	// ErrInvalidTokenType returned when a token is used for the wrong purpose
+	ErrInvalidTokenType = errors.New("JWT token has the wrong type")
+)
+
+// MagicLinkClaim the claims contained in a magic link token
+type MagicLinkClaim struct {
+	LinkID    string
+	UserID    string
+	NonceHash string
+}
+
+// GenerateMagicLinkClaim generate a short lived JWT token for a magic link, the nonce
+// hash binds the link to the browser which requested it.
+func GenerateMagicLinkClaim(certs *Certs, link *models.MagicLink, nonceHash string) (string, error) {
+	var claims = jws.Claims{
+		"typ":     magicLinkType,
+		"jti":     models.StringValue(link.ID),
+		"user_id": models.StringValue(link.UserID),
+		"nonce":   nonceHash,
+		"exp":     link.ExpiresAt.Unix(),
+	}
+
+	return signClaims(certs, claims)
+}
+
+// ValidateMagicLinkClaim validate the magic link JWT token and return the claims
+func ValidateMagicLinkClaim(certs *Certs, token string) (*MagicLinkClaim, error) {
+
+	t, err := VerifyToken(certs, token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.Claims(t.Claims)
+
+	if models.StringValue(extractKey("typ", claims)) != magicLinkType {
+		return nil, ErrInvalidTokenType
+	}
+
+	return &MagicLinkClaim{
+		LinkID:    models.StringValue(extractKey("jti", claims)),
+		UserID:    models.StringValue(extractKey("user_id", claims)),
+		NonceHash: models.StringValue(extractKey("nonce", claims)),
+	}, nil
+}
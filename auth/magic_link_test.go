@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+)
+
+func TestGenerateAndValidateMagicLinkClaim(t *testing.T) {
+
+	certs, err := GenerateTestCerts()
+	if assert.NoError(t, err) {
+
+		claim, err := GenerateMagicLinkClaim(certs, &models.MagicLink{
+			ID:        models.String("abc"),
+			UserID:    models.String("123"),
+			ExpiresAt: time.Now().Add(time.Minute),
+		}, "noncehash")
+
+		if assert.NoError(t, err) {
+
+			mlc, err := ValidateMagicLinkClaim(certs, claim)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "abc", mlc.LinkID)
+				assert.Equal(t, "123", mlc.UserID)
+				assert.Equal(t, "noncehash", mlc.NonceHash)
+			}
+
+			// magic link tokens must not be usable as normal tokens
+			_, err = ValidateClaim(certs, claim)
+			assert.Equal(t, ErrInvalidTokenType, err)
+		}
+	}
+}
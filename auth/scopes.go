@@ -0,0 +1,57 @@
+package auth
+
+const (
+	// ScopeUsersRead read the user and export their data
+	ScopeUsersRead = "users:read"
+
+	// ScopeUsersWrite update the user
+	ScopeUsersWrite = "users:write"
+
+	// ScopeSessionsRead list the users sessions
+	ScopeSessionsRead = "sessions:read"
+
+	// ScopeSessionsWrite revoke the users sessions
+	ScopeSessionsWrite = "sessions:write"
+
+	// ScopeHistoryRead list the users login history
+	ScopeHistoryRead = "history:read"
+
+	// ScopeTokensRead list the users personal access tokens
+	ScopeTokensRead = "tokens:read"
+)
+
+// Scopes every scope a token can be restricted to. Tokens without scopes aren't
+// restricted, changing the password, deleting the user and creating or revoking
+// personal access tokens is never allowed with a token which is.
+var Scopes = []string{
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeSessionsRead,
+	ScopeSessionsWrite,
+	ScopeHistoryRead,
+	ScopeTokensRead,
+}
+
+// ValidScope check the scope is one of Scopes
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope check if a token with the scopes may be used for the scope, tokens without
+// scopes aren't restricted
+func HasScope(scopes []string, scope string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wolfeidau/authinator/config"
+)
+
+var (
+	cmdConfig = &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the server configuration",
+	}
+
+	cmdConfigPrint = &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective server configuration",
+		Long:  `Print the configuration serve would use, from the defaults, the config file, AUTHINATOR_* environment variables and flags, as YAML with secrets redacted.`,
+		Run:   runCmdConfigPrint,
+	}
+
+	configPrintFlags = config.Default()
+
+	configPrintFile string
+)
+
+func init() {
+	addConfigFlags(cmdConfigPrint, configPrintFlags, &configPrintFile)
+
+	cmdConfig.AddCommand(cmdConfigPrint)
+	cmdRoot.AddCommand(cmdConfig)
+}
+
+func runCmdConfigPrint(cmd *cobra.Command, args []string) {
+
+	cfg := mustLoadConfig(cmd, configPrintFile)
+
+	fmt.Print(cfg.Print())
+}
+
+// addConfigFlags add the --config flag and a flag for each configuration key to the command
+func addConfigFlags(cmd *cobra.Command, cfg *config.Config, configFile *string) {
+	cmd.PersistentFlags().StringVar(configFile, "config", "", "Configure the YAML or TOML config file, defaults to $"+config.EnvConfigFile)
+	cfg.RegisterFlags(cmd.PersistentFlags())
+}
+
+// mustLoadConfig load the configuration from the config file, environment and the flags
+// set on the command
+func mustLoadConfig(cmd *cobra.Command, configFile string) *config.Config {
+
+	if configFile == "" {
+		configFile = os.Getenv(config.EnvConfigFile)
+	}
+
+	cfg, err := config.Load(configFile, os.Environ(), cmd.Flags())
+	if err != nil {
+		fmt.Printf("Loading configuration failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	return cfg
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wolfeidau/authinator/keyring"
+)
+
+var (
+	cmdKeys = &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the keys used to encrypt user fields",
+	}
+
+	cmdKeysRotate = &cobra.Command{
+		Use:   "rotate",
+		Short: "Add a new key encryption key to the key file",
+		Long:  `Add a new key encryption key to the key file, creating the file if it doesn't exist. New values are encrypted with the newest key while older keys are kept to decrypt existing values until they are rewrapped.`,
+		Run:   runCmdKeysRotate,
+	}
+
+	keysOpts struct {
+		KEKFile string
+	}
+)
+
+func init() {
+	cmdKeys.PersistentFlags().StringVar(&keysOpts.KEKFile, "kek-file", "", "Configure the key file")
+
+	cmdKeys.AddCommand(cmdKeysRotate)
+	cmdRoot.AddCommand(cmdKeys)
+}
+
+func runCmdKeysRotate(cmd *cobra.Command, args []string) {
+
+	if keysOpts.KEKFile == "" {
+		fmt.Println("The --kek-file is required")
+		os.Exit(1)
+	}
+
+	version, err := keyring.Rotate(keysOpts.KEKFile)
+	if err != nil {
+		fmt.Printf("Rotating keys failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Added key version %d\n", version)
+}
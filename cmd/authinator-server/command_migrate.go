@@ -1,52 +1,145 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"text/tabwriter"
+	"time"
 
-	r "github.com/dancannon/gorethink"
 	"github.com/spf13/cobra"
-	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/store/migrate"
 )
 
 var (
 	cmdMigrate = &cobra.Command{
 		Use:   "migrate",
-		Short: "Perform a schema migration on the RethinkDB database",
-		Long:  ``,
-		Run:   runCmdMigrate,
+		Short: "Perform a schema migration on the database",
+		Long:  `Apply, list or revert the versioned schema migrations of the store, without a subcommand every pending migration is applied.`,
+		Run:   runCmdMigrateUp,
+	}
+
+	cmdMigrateUp = &cobra.Command{
+		Use:   "up",
+		Short: "Apply every pending migration",
+		Run:   runCmdMigrateUp,
+	}
+
+	cmdMigrateStatus = &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and when they were applied",
+		Run:   runCmdMigrateStatus,
+	}
+
+	cmdMigrateDown = &cobra.Command{
+		Use:   "down",
+		Short: "Revert the applied migrations newer than a version",
+		Run:   runCmdMigrateDown,
 	}
 
 	migrateOpts struct {
 		ConnectionAddr string
+		Store          string
+		To             int
 	}
 )
 
 func init() {
 	cmdMigrate.PersistentFlags().StringVar(&migrateOpts.ConnectionAddr, "connection-addr", "localhost:28015", "Configure a connection address")
+	cmdMigrate.PersistentFlags().StringVar(&migrateOpts.Store, "store", "", "Configure the store URL, rethinkdb://host:port, postgres://... or bolt:///path, defaults to RethinkDB at the connection address")
+	cmdMigrateDown.Flags().IntVar(&migrateOpts.To, "to", -1, "Revert migrations newer than this version, 0 reverts them all")
+
+	cmdMigrate.AddCommand(cmdMigrateUp, cmdMigrateStatus, cmdMigrateDown)
 	cmdRoot.AddCommand(cmdMigrate)
 
 }
 
-func runCmdMigrate(cmd *cobra.Command, args []string) {
+func runCmdMigrateUp(cmd *cobra.Command, args []string) {
+
+	m, closer := mustOpenMigrator()
+	defer closer()
 
-	session, err := r.Connect(r.ConnectOpts{
-		Address: migrateOpts.ConnectionAddr,
-	})
+	applied, err := m.Up(context.Background())
+	for _, step := range applied {
+		fmt.Printf("Applied %d: %s\n", step.Version, step.Description)
+	}
 
 	if err != nil {
-		fmt.Printf("Opening RethinkDB session failed: %s", err)
+		fmt.Printf("Migrating failed: %s\n", err)
 		os.Exit(1)
 	}
 
-	resp, err := r.DBCreate(users.DBName).RunWrite(session)
+	fmt.Printf("%d migrations applied\n", len(applied))
+}
+
+func runCmdMigrateStatus(cmd *cobra.Command, args []string) {
+
+	m, closer := mustOpenMigrator()
+	defer closer()
+
+	status, err := m.Status(context.Background())
 	if err != nil {
-		fmt.Println(err)
+		fmt.Printf("Reading migration status failed: %s\n", err)
+		os.Exit(1)
 	}
 
-	fmt.Printf("%d DB created\n", resp.DBsCreated)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
 
-	r.DB(users.DBName).TableCreate(users.TableName).Exec(session)
+	fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+
+	for _, s := range status {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, applied, s.Description)
+	}
+
+	w.Flush()
+}
+
+func runCmdMigrateDown(cmd *cobra.Command, args []string) {
+
+	if migrateOpts.To < 0 {
+		fmt.Println("The --to version is required")
+		os.Exit(1)
+	}
+
+	m, closer := mustOpenMigrator()
+	defer closer()
+
+	reverted, err := m.Down(context.Background(), migrateOpts.To)
+	for _, step := range reverted {
+		fmt.Printf("Reverted %d: %s\n", step.Version, step.Description)
+	}
+
+	if err != nil {
+		fmt.Printf("Reverting failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d migrations reverted\n", len(reverted))
+}
+
+func mustOpenMigrator() (*migrate.Migrator, func()) {
+
+	u, err := parseStoreURL(migrateOpts.Store, migrateOpts.ConnectionAddr)
+	if err != nil {
+		fmt.Printf("Invalid store: %s\n", err)
+		os.Exit(1)
+	}
+
+	if u.Scheme == "memory" {
+		fmt.Printf("The %s store doesn't require migration\n", u.Scheme)
+		os.Exit(0)
+	}
+
+	m, closer, err := openMigrator(u)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	fmt.Printf("Table created\n")
+	return m, closer
 }
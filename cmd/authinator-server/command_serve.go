@@ -1,17 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	r "github.com/dancannon/gorethink"
 	"github.com/emicklei/go-restful"
 	"github.com/spf13/cobra"
 	"github.com/wolfeidau/authinator/api"
 	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/config"
+	"github.com/wolfeidau/authinator/keyring"
+	"github.com/wolfeidau/authinator/mailer"
+	"github.com/wolfeidau/authinator/metrics"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/magiclinks"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/tokens"
 	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/tlsconfig"
+	"github.com/wolfeidau/authinator/util"
 )
 
 var (
@@ -22,48 +37,275 @@ var (
 		Run:   runCmdServe,
 	}
 
-	serveOpts struct {
-		ConnectionAddr string
-	}
+	// how often the TLS certificate and key files are checked for changes
+	tlsReloadInterval = 30 * time.Second
+
+	// serveFlags is bound to the flags, the effective configuration is built by config.Load
+	serveFlags = config.Default()
+
+	serveConfigFile string
 )
 
 func init() {
-	cmdServe.PersistentFlags().StringVar(&serveOpts.ConnectionAddr, "connection-addr", "localhost:28015", "Configure a connection address")
+	addConfigFlags(cmdServe, serveFlags, &serveConfigFile)
 	cmdRoot.AddCommand(cmdServe)
 }
 
 func runCmdServe(cmd *cobra.Command, args []string) {
 
-	session, err := r.Connect(r.ConnectOpts{
-		Address: serveOpts.ConnectionAddr,
-	})
+	cfg := mustLoadConfig(cmd, serveConfigFile)
 
+	auth.DefaultTokenTTL = cfg.TokenTTL
+	auth.Issuer = cfg.TokenIssuer
+	util.N = int32(cfg.ScryptCost)
+	util.HashConcurrency = cfg.HashConcurrency
+
+	bk, err := openBackend(cfg.Store, cfg.ConnectionAddr)
 	if err != nil {
-		fmt.Printf("Opening RethinkDB session failed: %s", err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	userStore := users.NewUserStoreRethinkDB(session)
+	instrumentBackend(bk)
+
+	if cfg.KEKFile != "" {
+		keys, err := keyring.LoadFile(cfg.KEKFile)
+		if err != nil {
+			fmt.Printf("Loading key file failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		bk.users = users.NewUserStoreEncrypted(bk.users, keys)
+
+		mustHaveNoPlaintextUsers(bk)
+	}
+
+	// cancelled once the server has shut down to stop the background tasks
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if cfg.UserCacheSize > 0 {
+		cache := users.NewUserStoreCache(bk.users, cfg.UserCacheSize, cfg.UserCacheTTL)
+
+		if bk.session != nil {
+			go watchUserCache(ctx, cache, bk.session)
+		}
+
+		err = metrics.RegisterCacheStats("users", func() (uint64, uint64) {
+			stats := cache.Stats()
+			return stats.Hits, stats.Misses
+		})
+		if err != nil {
+			fmt.Printf("Registering cache metrics failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		bk.users = cache
+	}
 
 	wsContainer := restful.NewContainer()
 
-	certs, err := auth.GenerateTestCerts()
-	if err != nil {
-		fmt.Printf("Opening RethinkDB session failed: %s", err)
-		os.Exit(1)
+	wsContainer.Filter(metrics.Filter)
+
+	var certs *auth.Certs
+
+	if cfg.SigningKey != "" {
+		certs = mustLoadCerts(cfg.SigningKey)
+	} else {
+		log.Printf("WARNING: no signing_key configured, tokens are signed with a generated key")
+
+		certs, err = auth.GenerateTestCerts()
+		if err != nil {
+			fmt.Printf("Generating certificates failed: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	log.Printf("signing tokens with key %s", certs.KeyID())
+
+	var cookies *api.CookieSessions
+
+	if cfg.CookieSessions {
+		cookies = api.NewCookieSessions(cfg.CookieDomain, !cfg.CookieInsecure)
+		cookies.MaxAge = cfg.TokenTTL
+	}
+
+	if len(cfg.CORSAllowedOrigins) != 0 {
+		api.EnableCORS(wsContainer, cfg.CORSAllowedOrigins, cookies)
 	}
 
-	jwtAuth := api.BuildJWTAuthFunc(userStore, certs)
+	jwtAuth := api.BuildJWTAuthFunc(bk.users, certs, cookies, bk.sessions, bk.tokens)
+
+	if len(cfg.TLSClientIdentities) != 0 {
+		clientCerts, err := api.NewClientCertAuth(bk.users, cfg.TLSClientIdentities)
+		if err != nil {
+			fmt.Printf("Loading configuration failed: tls_client_identities %s\n", err)
+			os.Exit(1)
+		}
 
-	ar := api.NewAuthResource(userStore, jwtAuth, certs)
+		jwtAuth = clientCerts.Wrap(jwtAuth)
+	}
+
+	ar := api.NewAuthResource(bk.users, jwtAuth, certs, cookies, bk.sessions, bk.history)
 
 	ar.Register(wsContainer)
 
-	ur := api.NewUserResource(userStore, jwtAuth)
+	ur := api.NewUserResource(bk.users, jwtAuth, bk.sessions, bk.history, bk.tokens)
 
 	ur.Register(wsContainer)
 
-	log.Printf("start listening on localhost:9090")
-	server := &http.Server{Addr: ":9090", Handler: wsContainer}
-	log.Fatal(server.ListenAndServe())
+	ad := api.NewAdminResource(bk.users, jwtAuth, bk.history)
+
+	ad.Register(wsContainer)
+
+	mailSender := mailer.NewLogMailer()
+
+	if cfg.SMTPAddr != "" {
+		mailSender = mailer.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPFrom, cfg.SMTPUsername, cfg.SMTPPassword)
+	}
+
+	mr := api.NewMagicLinkResource(ar, bk.links, mailSender, cfg.BaseURL)
+
+	mr.Register(wsContainer)
+
+	hr := api.NewHealthResource(bk.users, certs)
+
+	hr.Register(wsContainer)
+
+	purger := users.NewPurger(bk.users, cfg.PurgeRetention, cfg.PurgeInterval)
+	purger.PurgeExpiredLinks = bk.links.PurgeExpired
+
+	go purger.Run(ctx)
+
+	server := &http.Server{Addr: cfg.ListenAddr, Handler: wsContainer}
+
+	listen := server.ListenAndServe
+
+	if cfg.TLSCert != "" {
+		tlsConfig, reloader, err := tlsconfig.New(tlsconfig.Options{
+			CertFile:     cfg.TLSCert,
+			KeyFile:      cfg.TLSKey,
+			MinVersion:   cfg.TLSMinVersion,
+			CipherSuites: cfg.TLSCipherSuites,
+			ClientCAFile: cfg.TLSClientCA,
+			ClientAuth:   cfg.TLSClientAuth,
+		})
+		if err != nil {
+			fmt.Printf("Loading TLS certificate failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		go reloader.Watch(ctx, tlsReloadInterval)
+
+		server.TLSConfig = tlsConfig
+
+		listen = func() error { return server.ListenAndServeTLS("", "") }
+	}
+
+	listeners := []listener{{server, listen}}
+
+	// metrics are served on their own listener so they aren't exposed with the API
+	if cfg.MetricsListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+
+		metricsServer := &http.Server{Addr: cfg.MetricsListenAddr, Handler: mux}
+
+		listeners = append(listeners, listener{metricsServer, metricsServer.ListenAndServe})
+	}
+
+	err = serveUntilSignalled(listeners, hr, cfg.DrainDelay, cfg.ShutdownTimeout)
+
+	// stop the background tasks before exiting
+	cancel()
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// listener a server and the function which starts it listening
+type listener struct {
+	server *http.Server
+	listen func() error
+}
+
+// serveUntilSignalled serve until SIGINT or SIGTERM is received, then report the server
+// isn't ready for the drain delay, stop accepting connections and wait up to the drain
+// timeout for in flight requests to finish. Every listener is shut down even if one fails.
+func serveUntilSignalled(listeners []listener, hr *api.HealthResource, drainDelay, drainTimeout time.Duration) error {
+
+	errc := make(chan error, len(listeners))
+
+	for _, l := range listeners {
+		go func(l listener) {
+			errc <- l.listen()
+		}(l)
+
+		log.Printf("start listening on %s", l.server.Addr)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("listening failed: %s", err)
+	case sig := <-signals:
+		log.Printf("received %s, reporting not ready for %s then draining requests for up to %s", sig, drainDelay, drainTimeout)
+	}
+
+	hr.Drain()
+
+	time.Sleep(drainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	var failures []string
+
+	for _, l := range listeners {
+		err := l.server.Shutdown(ctx)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", l.server.Addr, err))
+		}
+	}
+
+	if len(failures) != 0 {
+		return fmt.Errorf("shutdown before requests finished: %s", strings.Join(failures, ", "))
+	}
+
+	log.Printf("shutdown complete")
+
+	return nil
+}
+
+// instrumentBackend record metrics for each operation on the stores, this is done before
+// they are wrapped by the encryption and cache so the latency of the backend is measured
+func instrumentBackend(bk *backend) {
+	bk.users = users.NewUserStoreMetrics(bk.users)
+	bk.links = magiclinks.NewMagicLinkStoreMetrics(bk.links)
+	bk.sessions = sessions.NewSessionStoreMetrics(bk.sessions)
+	bk.history = history.NewLoginHistoryStoreMetrics(bk.history)
+	bk.tokens = tokens.NewAccessTokenStoreMetrics(bk.tokens)
+}
+
+// watchUserCache invalidate cached users changed by other replicas, the changefeed is
+// restarted if it fails until the context is cancelled.
+func watchUserCache(ctx context.Context, cache *users.UserStoreCache, session *r.Session) {
+	for {
+		err := cache.WatchRethinkDB(ctx, session)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("user cache changefeed failed, restarting: %s", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
 }
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+var (
+	cmdToken = &cobra.Command{
+		Use:   "token",
+		Short: "Mint, decode and verify tokens",
+		Long:  `Mint, decode and verify the JWT tokens issued by the server, mint and verify use the server's signing key.`,
+	}
+
+	cmdTokenMint = &cobra.Command{
+		Use:   "mint",
+		Short: "Mint a token for a user",
+		Long:  `Mint a token for a user, a session is created in the store for the token to be bound to, like signing in does.`,
+		Run:   runCmdTokenMint,
+	}
+
+	cmdTokenDecode = &cobra.Command{
+		Use:   "decode [TOKEN]",
+		Short: "Print the header and claims of a token without verifying it",
+		Long:  `Print the header and claims of a token without verifying it, the token is read from stdin when it is - or omitted.`,
+		Run:   runCmdTokenDecode,
+	}
+
+	cmdTokenVerify = &cobra.Command{
+		Use:   "verify [TOKEN]",
+		Short: "Verify a token and print why it was rejected",
+		Long:  `Verify a token was signed by the signing key, hasn't expired and is bound to a session, the token is read from stdin when it is - or omitted. With --store the session is checked in the store as well.`,
+		Run:   runCmdTokenVerify,
+	}
+
+	tokenOpts struct {
+		SigningKey     string
+		Issuer         string
+		ConnectionAddr string
+		Store          string
+		KEKFile        string
+		UserID         string
+		TTL            time.Duration
+		Scopes         []string
+	}
+)
+
+func init() {
+	cmdToken.PersistentFlags().StringVar(&tokenOpts.SigningKey, "signing-key", "", "Configure the PEM encoded RSA private key the server signs tokens with")
+	cmdToken.PersistentFlags().StringVar(&tokenOpts.Issuer, "issuer", "", "Configure the token issuer the server is configured with, if any")
+
+	cmdTokenMint.Flags().StringVar(&tokenOpts.ConnectionAddr, "connection-addr", "localhost:28015", "Configure a connection address")
+	cmdTokenMint.Flags().StringVar(&tokenOpts.Store, "store", "", "Configure the store URL, rethinkdb://host:port, postgres://... or bolt:///path, defaults to RethinkDB at the connection address")
+	cmdTokenMint.Flags().StringVar(&tokenOpts.KEKFile, "kek-file", "", "Configure the key file used to encrypt user fields")
+	cmdTokenVerify.Flags().StringVar(&tokenOpts.Store, "store", "", "Configure the store URL, rethinkdb://host:port, postgres://... or bolt:///path, to check the token's session in")
+	cmdTokenMint.Flags().StringVar(&tokenOpts.UserID, "user", "", "Configure the ID of the user the token is issued to")
+	cmdTokenMint.Flags().DurationVar(&tokenOpts.TTL, "ttl", auth.DefaultTokenTTL, "Configure how long the token is valid for")
+	cmdTokenMint.Flags().StringSliceVar(&tokenOpts.Scopes, "scope", nil, "Restrict the token to a scope, can be repeated, one of "+strings.Join(auth.Scopes, ", "))
+
+	cmdToken.AddCommand(cmdTokenMint, cmdTokenDecode, cmdTokenVerify)
+	cmdRoot.AddCommand(cmdToken)
+}
+
+func runCmdTokenMint(cmd *cobra.Command, args []string) {
+
+	if tokenOpts.UserID == "" {
+		fmt.Println("The --user is required")
+		os.Exit(1)
+	}
+
+	if tokenOpts.TTL <= 0 {
+		fmt.Println("The --ttl must be positive")
+		os.Exit(1)
+	}
+
+	for _, scope := range tokenOpts.Scopes {
+		if !auth.ValidScope(scope) {
+			fmt.Printf("The --scope must be one of %s\n", strings.Join(auth.Scopes, ", "))
+			os.Exit(1)
+		}
+	}
+
+	certs := mustLoadTokenCerts()
+
+	bk := mustOpenBackend(tokenOpts.Store, tokenOpts.ConnectionAddr, tokenOpts.KEKFile)
+
+	// the server rejects tokens which aren't bound to one of its sessions
+	if bk.memory {
+		fmt.Println("Minting tokens requires the server's store, the session would be lost with the memory store")
+		os.Exit(1)
+	}
+
+	usr, err := bk.users.GetByID(context.Background(), tokenOpts.UserID)
+	if err == users.ErrUserNotFound {
+		fmt.Printf("User %s not found\n", tokenOpts.UserID)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Reading user failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	if usr.DisabledAt != nil {
+		fmt.Printf("User %s is disabled\n", tokenOpts.UserID)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+
+	session, err := bk.sessions.Create(&models.Session{
+		UserID:     usr.ID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		UserAgent:  models.String("authinator-server token mint"),
+	})
+	if err != nil {
+		fmt.Printf("Creating session failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	token, err := auth.GenerateClaimWithOptions(certs, usr, auth.ClaimOptions{
+		SessionID: models.StringValue(session.ID),
+		TTL:       tokenOpts.TTL,
+		Scopes:    tokenOpts.Scopes,
+	})
+	if err != nil {
+		fmt.Printf("Minting token failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(token)
+}
+
+func runCmdTokenDecode(cmd *cobra.Command, args []string) {
+
+	tok, err := auth.DecodeToken(mustReadToken(args))
+	if err != nil {
+		fmt.Printf("Decoding token failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	printToken(tok)
+}
+
+func runCmdTokenVerify(cmd *cobra.Command, args []string) {
+
+	certs := mustLoadTokenCerts()
+
+	token := mustReadToken(args)
+
+	usr, sessionID, _, err := auth.ValidateScopedClaim(certs, token)
+	if err != nil {
+		fmt.Printf("Invalid: %s\n", rejectReason(certs, token, err))
+		os.Exit(1)
+	}
+
+	tok, _ := auth.DecodeToken(token)
+
+	if sessionID == "" {
+		fmt.Println("Invalid: the token has no session_id claim, the server only accepts tokens bound to a session")
+		os.Exit(1)
+	}
+
+	if tokenOpts.Store != "" {
+		if reason := sessionRejectReason(sessionID, models.StringValue(usr.ID)); reason != "" {
+			fmt.Printf("Invalid: %s\n", reason)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Valid token for user %s (%s)\n", models.StringValue(usr.ID), models.StringValue(usr.Login))
+
+	if tokenOpts.Store != "" {
+		fmt.Printf("Session: %s\n", sessionID)
+	} else {
+		fmt.Printf("Session: %s, not checked, use --store to check it hasn't been revoked\n", sessionID)
+	}
+
+	printToken(tok)
+}
+
+// sessionRejectReason check the session the token is bound to in the store like the server
+// does and explain why it would be rejected, or return an empty string if it is accepted
+func sessionRejectReason(sessionID, userID string) string {
+
+	bk := mustOpenBackend(tokenOpts.Store, "", "")
+
+	if bk.memory {
+		fmt.Println("Checking sessions requires the server's store, the memory store has none")
+		os.Exit(1)
+	}
+
+	session, err := bk.sessions.GetByID(sessionID)
+	if err == sessions.ErrSessionNotFound {
+		return fmt.Sprintf("the session %s was revoked or doesn't exist", sessionID)
+	}
+
+	if err != nil {
+		fmt.Printf("Reading session failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	if models.StringValue(session.UserID) != userID {
+		return fmt.Sprintf("the session %s belongs to user %s", sessionID, models.StringValue(session.UserID))
+	}
+
+	return ""
+}
+
+// rejectReason explain why the token failed verification using its header and claims
+func rejectReason(certs *auth.Certs, token string, err error) string {
+
+	tok, derr := auth.DecodeToken(token)
+	if derr != nil {
+		return err.Error()
+	}
+
+	switch err {
+	case auth.ErrTokenExpired:
+		exp, ok := tok.Expiration()
+		if !ok {
+			return "the token has no exp claim"
+		}
+		return fmt.Sprintf("the token expired at %s, %s ago", exp.Format(time.RFC3339), time.Since(exp).Truncate(time.Second))
+	case auth.ErrBadSignature:
+		return "bad signature, the token was modified or signed by another key"
+	case auth.ErrWrongAlgorithm:
+		return fmt.Sprintf("wrong algorithm %q, tokens are signed with RS512", tok.Algorithm())
+	case auth.ErrUnknownKeyID:
+		return fmt.Sprintf("unknown kid %q, the signing key is %q", tok.KeyID(), certs.KeyID())
+	case auth.ErrWrongIssuer:
+		return fmt.Sprintf("wrong issuer %q, tokens are issued by %q", tok.Issuer(), auth.Issuer)
+	case auth.ErrInvalidTokenType:
+		return fmt.Sprintf("the token is a %v token and can't be used to authenticate", tok.Claims["typ"])
+	}
+
+	return err.Error()
+}
+
+func printToken(tok *auth.Token) {
+
+	for _, part := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"Header", tok.Header},
+		{"Claims", tok.Claims},
+	} {
+		buf, _ := json.MarshalIndent(part.v, "", "  ")
+		fmt.Printf("%s:\n%s\n", part.name, buf)
+	}
+
+	kid := tok.KeyID()
+	if kid == "" {
+		kid = "none"
+	}
+
+	fmt.Printf("Key ID: %s\n", kid)
+
+	if exp, ok := tok.Expiration(); ok {
+		fmt.Printf("Expires: %s\n", exp.Format(time.RFC3339))
+	}
+}
+
+// mustReadToken read the token from the arguments or the first line of stdin
+func mustReadToken(args []string) string {
+
+	if len(args) > 0 && args[0] != "-" {
+		return args[0]
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Printf("Reading token failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	return strings.TrimSpace(line)
+}
+
+func mustLoadTokenCerts() *auth.Certs {
+
+	if tokenOpts.SigningKey == "" {
+		fmt.Println("The --signing-key is required")
+		os.Exit(1)
+	}
+
+	auth.Issuer = tokenOpts.Issuer
+
+	return mustLoadCerts(tokenOpts.SigningKey)
+}
+
+func mustLoadCerts(signingKey string) *auth.Certs {
+
+	certs, err := auth.LoadCerts(signingKey)
+	if err != nil {
+		fmt.Printf("Loading signing key failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	return certs
+}
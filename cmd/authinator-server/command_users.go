@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wolfeidau/authinator/keyring"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/privacy"
+	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/userio"
+)
+
+var (
+	cmdUsers = &cobra.Command{
+		Use:   "users",
+		Short: "Administer users",
+		Long:  `Administer users directly in the store, without going through the REST API.`,
+	}
+
+	cmdUsersErase = &cobra.Command{
+		Use:   "erase USER_ID",
+		Short: "Permanently erase a user and their personal data",
+		Long:  `Permanently erase a user and their sessions and access tokens, their login history is kept under a random pseudonym without IP addresses or user agents. This can't be undone.`,
+		Run:   runCmdUsersErase,
+	}
+
+	cmdUsersRewrap = &cobra.Command{
+		Use:   "rewrap [USER_ID...]",
+		Short: "Encrypt the users fields with the newest key",
+		Long:  `Encrypt the fields of the users again with the newest key in the key file, this encrypts users stored before encryption was enabled and those encrypted with an older key after a rotation. Users stored before encryption can't sign in until they are rewrapped, use --all to rewrap every user after enabling encryption.`,
+		Run:   runCmdUsersRewrap,
+	}
+
+	cmdUsersImport = &cobra.Command{
+		Use:   "import [FILE]",
+		Short: "Import users from a CSV or NDJSON file",
+		Long:  `Import users from a CSV or NDJSON file, or stdin when FILE is - or omitted. Passwords must already be hashed as scrypt, bcrypt, Django PBKDF2 or htpasswd SHA/APR1, they are hashed again with scrypt on first login. Rows which fail validation are reported and skipped.`,
+		Run:   runCmdUsersImport,
+	}
+
+	cmdUsersExport = &cobra.Command{
+		Use:   "export",
+		Short: "Export users to a CSV or NDJSON file",
+		Long:  `Export users to a CSV or NDJSON file, ordered by ID. Password hashes are only included with --with-passwords, and are needed to import the file again.`,
+		Run:   runCmdUsersExport,
+	}
+
+	usersOpts struct {
+		ConnectionAddr string
+		Store          string
+		KEKFile        string
+		Format         string
+		DryRun         bool
+		ReportFile     string
+		WithPasswords  bool
+		Output         string
+		All            bool
+	}
+)
+
+func init() {
+	cmdUsers.PersistentFlags().StringVar(&usersOpts.ConnectionAddr, "connection-addr", "localhost:28015", "Configure a connection address")
+	cmdUsers.PersistentFlags().StringVar(&usersOpts.Store, "store", "", "Configure the store URL, rethinkdb://host:port, postgres://... or bolt:///path, defaults to RethinkDB at the connection address")
+	cmdUsers.PersistentFlags().StringVar(&usersOpts.KEKFile, "kek-file", "", "Configure the key file used to encrypt user fields")
+
+	cmdUsersImport.Flags().StringVar(&usersOpts.Format, "format", userio.FormatCSV, "Configure the file format, csv or ndjson")
+	cmdUsersImport.Flags().BoolVar(&usersOpts.DryRun, "dry-run", false, "Validate the file without creating any users")
+	cmdUsersImport.Flags().StringVar(&usersOpts.ReportFile, "report", "", "Write the rows which failed to this file as CSV")
+
+	cmdUsersExport.Flags().StringVar(&usersOpts.Format, "format", userio.FormatCSV, "Configure the file format, csv or ndjson")
+	cmdUsersExport.Flags().BoolVar(&usersOpts.WithPasswords, "with-passwords", false, "Include the password hashes")
+	cmdUsersExport.Flags().StringVarP(&usersOpts.Output, "output", "o", "", "Write to this file rather than stdout")
+
+	cmdUsersRewrap.Flags().BoolVar(&usersOpts.All, "all", false, "Rewrap every user rather than those listed")
+
+	cmdUsers.AddCommand(cmdUsersErase, cmdUsersRewrap, cmdUsersImport, cmdUsersExport)
+	cmdRoot.AddCommand(cmdUsers)
+}
+
+func runCmdUsersErase(cmd *cobra.Command, args []string) {
+
+	if len(args) != 1 {
+		fmt.Println("A user ID is required")
+		os.Exit(1)
+	}
+
+	bk := mustOpenUsersBackend()
+
+	pseudonym, err := privacy.NewService(bk.users, bk.sessions, bk.history, bk.tokens).Erase(context.Background(), args[0])
+	if err == users.ErrUserNotFound {
+		fmt.Printf("User %s not found\n", args[0])
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Erasing user failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Erased user %s, their login history is kept as %s\n", args[0], pseudonym)
+}
+
+func runCmdUsersRewrap(cmd *cobra.Command, args []string) {
+
+	if usersOpts.KEKFile == "" {
+		fmt.Println("The --kek-file is required")
+		os.Exit(1)
+	}
+
+	bk := mustOpenUsersBackend()
+
+	// the key file is required so the users are always encrypted
+	userStore := bk.users.(*users.UserStoreEncrypted)
+
+	userIDs := args
+
+	if usersOpts.All {
+		userIDs = mustListUserIDs(bk)
+	}
+
+	if len(userIDs) == 0 {
+		fmt.Println("A user ID or --all is required")
+		os.Exit(1)
+	}
+
+	failed := false
+
+	for _, userID := range userIDs {
+		rewrapped, err := userStore.Rewrap(context.Background(), userID)
+		switch {
+		case err != nil:
+			fmt.Printf("Rewrapping user %s failed: %s\n", userID, err)
+			failed = true
+		case rewrapped:
+			fmt.Printf("Rewrapped user %s\n", userID)
+		default:
+			fmt.Printf("User %s is up to date\n", userID)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// mustListUserIDs list the IDs of every active user
+func mustListUserIDs(bk *backend) []string {
+
+	var userIDs []string
+
+	after := ""
+
+	for {
+		page, err := bk.users.List(context.Background(), after, listPageSize)
+		if err != nil {
+			fmt.Printf("Listing users failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		for _, usr := range page {
+			userIDs = append(userIDs, models.StringValue(usr.ID))
+		}
+
+		if len(page) < listPageSize {
+			return userIDs
+		}
+
+		after = models.StringValue(page[len(page)-1].ID)
+	}
+}
+
+func runCmdUsersImport(cmd *cobra.Command, args []string) {
+
+	in := os.Stdin
+
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("Opening file failed: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		in = f
+	}
+
+	r, err := userio.NewReader(usersOpts.Format, in)
+	if err != nil {
+		fmt.Printf("Unsupported format %s\n", usersOpts.Format)
+		os.Exit(1)
+	}
+
+	bk := mustOpenUsersBackend()
+
+	mustHaveNoPlaintextUsers(bk)
+
+	report, err := userio.Import(context.Background(), bk.users, r, usersOpts.DryRun)
+
+	for _, re := range report.Errors {
+		fmt.Printf("Row %d %s: %s\n", re.Row, re.Login, re.Error)
+	}
+
+	if err != nil {
+		fmt.Printf("Importing users failed after %d rows: %s\n", report.Rows, err)
+		os.Exit(1)
+	}
+
+	if usersOpts.ReportFile != "" {
+		f, err := os.OpenFile(usersOpts.ReportFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err == nil {
+			err = report.WriteCSV(f)
+			f.Close()
+		}
+
+		if err != nil {
+			fmt.Printf("Writing report failed: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Would import"
+	}
+
+	fmt.Printf("%s %d of %d users, %d failed\n", verb, report.Imported, report.Rows, len(report.Errors))
+
+	if len(report.Errors) != 0 {
+		os.Exit(1)
+	}
+}
+
+func runCmdUsersExport(cmd *cobra.Command, args []string) {
+
+	out := os.Stdout
+
+	if usersOpts.Output != "" {
+		// the file may hold password hashes so keep it private
+		f, err := os.OpenFile(usersOpts.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Printf("Creating file failed: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		out = f
+	}
+
+	w, err := userio.NewWriter(usersOpts.Format, out)
+	if err != nil {
+		fmt.Printf("Unsupported format %s\n", usersOpts.Format)
+		os.Exit(1)
+	}
+
+	bk := mustOpenUsersBackend()
+
+	count, err := userio.Export(context.Background(), bk.users, w, usersOpts.WithPasswords)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Exporting users failed after %d users: %s\n", count, err)
+		os.Exit(1)
+	}
+
+	if out != os.Stdout {
+		fmt.Printf("Exported %d users\n", count)
+	}
+}
+
+// mustOpenUsersBackend open the store for the users commands, which change the server's
+// users, sessions and access tokens so the memory store is refused rather than reporting
+// changes which are lost when the command exits
+func mustOpenUsersBackend() *backend {
+
+	bk := mustOpenBackend(usersOpts.Store, usersOpts.ConnectionAddr, usersOpts.KEKFile)
+
+	if bk.memory {
+		fmt.Println("The users commands require the server's store, the memory store only lives as long as the command")
+		os.Exit(1)
+	}
+
+	return bk
+}
+
+// mustHaveNoPlaintextUsers refuse to continue with encryption enabled while users stored
+// before it was enabled remain, they can't sign in and their logins could be taken
+func mustHaveNoPlaintextUsers(bk *backend) {
+
+	userStore, ok := bk.users.(*users.UserStoreEncrypted)
+	if !ok {
+		return
+	}
+
+	userIDs, err := userStore.Unencrypted(context.Background())
+	if err != nil {
+		fmt.Printf("Checking for plaintext users failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(userIDs) != 0 {
+		fmt.Printf("%d users are stored in plaintext, encrypt them with users rewrap --kek-file FILE --all first\n", len(userIDs))
+		os.Exit(1)
+	}
+}
+
+// mustOpenBackend open the store for an admin command, encrypting user fields if a key
+// file is given
+func mustOpenBackend(store, connectionAddr, kekFile string) *backend {
+
+	bk, err := openBackend(store, connectionAddr)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if kekFile != "" {
+		keys, err := keyring.LoadFile(kekFile)
+		if err != nil {
+			fmt.Printf("Loading key file failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		bk.users = users.NewUserStoreEncrypted(bk.users, keys)
+	}
+
+	return bk
+}
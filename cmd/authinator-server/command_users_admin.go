@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/privacy"
+	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/util"
+	"github.com/wolfeidau/authinator/validation"
+	"github.com/wolfeidau/authinator/validation/field"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// listPageSize is the number of users read from the store at a time by users list
+const listPageSize = 100
+
+// the admin commands identify users by either their ID or login
+var (
+	cmdUsersCreate = &cobra.Command{
+		Use:   "create",
+		Short: "Create a user",
+		Long:  `Create a user, the password is prompted for or read from stdin when it isn't a terminal.`,
+		Run:   runCmdUsersCreate,
+	}
+
+	cmdUsersGet = &cobra.Command{
+		Use:   "get USER",
+		Short: "Show a user by ID or login",
+		Run:   runCmdUsersGet,
+	}
+
+	cmdUsersList = &cobra.Command{
+		Use:   "list",
+		Short: "List users ordered by ID",
+		Run:   runCmdUsersList,
+	}
+
+	cmdUsersDisable = &cobra.Command{
+		Use:   "disable USER",
+		Short: "Disable a user",
+		Long:  `Disable a user, they can't sign in and their existing sessions and access tokens are rejected until they are enabled again.`,
+		Run:   runCmdUsersDisable,
+	}
+
+	cmdUsersEnable = &cobra.Command{
+		Use:   "enable USER",
+		Short: "Enable a disabled user",
+		Run:   runCmdUsersEnable,
+	}
+
+	cmdUsersDelete = &cobra.Command{
+		Use:   "delete USER",
+		Short: "Delete a user",
+		Long:  `Soft delete a user and revoke their sessions and access tokens, the user is purged once the retention period has passed.`,
+		Run:   runCmdUsersDelete,
+	}
+
+	cmdUsersSetPassword = &cobra.Command{
+		Use:   "set-password USER",
+		Short: "Set the password of a user",
+		Long:  `Set the password of a user, the password is prompted for or read from stdin when it isn't a terminal.`,
+		Run:   runCmdUsersSetPassword,
+	}
+
+	cmdUsersAddRole = &cobra.Command{
+		Use:   "add-role USER ROLE...",
+		Short: "Grant roles to a user",
+		Run:   runCmdUsersAddRole,
+	}
+
+	cmdUsersHistory = &cobra.Command{
+		Use:   "history USER",
+		Short: "Show the recent sign in attempts of a user",
+		Long:  `Show the recent sign in attempts of a user, successful and failed, with the IP address and user agent they were made from.`,
+		Run:   runCmdUsersHistory,
+	}
+
+	usersAdminOpts struct {
+		Login  string
+		Email  string
+		Name   string
+		Roles  []string
+		After  string
+		Limit  int
+		Format string
+	}
+)
+
+func init() {
+	cmdUsersCreate.Flags().StringVar(&usersAdminOpts.Login, "login", "", "Configure the login of the user")
+	cmdUsersCreate.Flags().StringVar(&usersAdminOpts.Email, "email", "", "Configure the email of the user")
+	cmdUsersCreate.Flags().StringVar(&usersAdminOpts.Name, "name", "", "Configure the name of the user")
+	cmdUsersCreate.Flags().StringSliceVar(&usersAdminOpts.Roles, "role", nil, "Grant a role to the user, can be repeated")
+
+	cmdUsersList.Flags().StringVar(&usersAdminOpts.After, "after", "", "List the users after this ID")
+	cmdUsersList.Flags().IntVar(&usersAdminOpts.Limit, "limit", 100, "Configure the maximum number of users listed, 0 lists every user")
+
+	for _, cmd := range []*cobra.Command{cmdUsersCreate, cmdUsersGet, cmdUsersList, cmdUsersDisable, cmdUsersEnable, cmdUsersAddRole, cmdUsersHistory} {
+		cmd.Flags().StringVar(&usersAdminOpts.Format, "format", "table", "Configure the output format, table or json")
+	}
+
+	cmdUsers.AddCommand(cmdUsersCreate, cmdUsersGet, cmdUsersList, cmdUsersDisable, cmdUsersEnable, cmdUsersDelete, cmdUsersSetPassword, cmdUsersAddRole, cmdUsersHistory)
+}
+
+func runCmdUsersCreate(cmd *cobra.Command, args []string) {
+
+	password := mustReadPassword()
+
+	usr := &models.User{
+		Login:    models.String(usersAdminOpts.Login),
+		Email:    models.String(usersAdminOpts.Email),
+		Password: models.String(password),
+	}
+
+	if usersAdminOpts.Name != "" {
+		usr.Name = models.String(usersAdminOpts.Name)
+	}
+
+	mustBeValid(validation.ValidateUserRegister(usr))
+	mustBeValid(validation.ValidateUserRoles(usersAdminOpts.Roles))
+
+	phash, err := util.HashPassword(password)
+	if err != nil {
+		fmt.Printf("Hashing password failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	usr.Password = models.String(phash)
+
+	if len(usersAdminOpts.Roles) != 0 {
+		usr.Roles = usersAdminOpts.Roles
+	}
+
+	bk := mustOpenUsersBackend()
+
+	mustHaveNoPlaintextUsers(bk)
+
+	nusr, err := bk.users.Create(context.Background(), usr)
+	if err == users.ErrUserAlreadyExists {
+		fmt.Printf("Login %s is already taken\n", usersAdminOpts.Login)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Creating user failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	nusr.Password = nil
+
+	printUsers([]*models.User{nusr}, true)
+}
+
+func runCmdUsersGet(cmd *cobra.Command, args []string) {
+
+	usr := mustGetUser(mustOpenUsersBackend(), args)
+
+	printUsers([]*models.User{usr}, true)
+}
+
+func runCmdUsersList(cmd *cobra.Command, args []string) {
+
+	bk := mustOpenUsersBackend()
+
+	list := []*models.User{}
+	after := usersAdminOpts.After
+
+	for {
+		limit := listPageSize
+		if usersAdminOpts.Limit > 0 && usersAdminOpts.Limit-len(list) < limit {
+			limit = usersAdminOpts.Limit - len(list)
+		}
+
+		page, err := bk.users.List(context.Background(), after, limit)
+		if err != nil {
+			fmt.Printf("Listing users failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		list = append(list, page...)
+
+		if len(page) < limit || len(list) == usersAdminOpts.Limit {
+			break
+		}
+
+		after = models.StringValue(page[len(page)-1].ID)
+	}
+
+	printUsers(list, false)
+}
+
+func runCmdUsersDisable(cmd *cobra.Command, args []string) {
+
+	now := time.Now().UTC()
+
+	mustUpdateUser(args, users.FieldDisabledAt, func(usr *models.User) {
+		usr.DisabledAt = &now
+	})
+}
+
+func runCmdUsersEnable(cmd *cobra.Command, args []string) {
+
+	mustUpdateUser(args, users.FieldDisabledAt, func(usr *models.User) {
+		usr.DisabledAt = nil
+	})
+}
+
+func runCmdUsersAddRole(cmd *cobra.Command, args []string) {
+
+	if len(args) < 2 {
+		fmt.Println("A user and at least one role are required")
+		os.Exit(1)
+	}
+
+	roles := args[1:]
+
+	mustBeValid(validation.ValidateUserRoles(roles))
+
+	mustUpdateUser(args[:1], users.FieldRoles, func(usr *models.User) {
+		for _, role := range roles {
+			if !hasRole(usr.Roles, role) {
+				usr.Roles = append(usr.Roles, role)
+			}
+		}
+	})
+}
+
+func runCmdUsersHistory(cmd *cobra.Command, args []string) {
+
+	bk := mustOpenUsersBackend()
+
+	usr := mustGetUser(bk, args)
+
+	list, err := bk.history.ListByUser(models.StringValue(usr.ID))
+	if err != nil {
+		fmt.Printf("Reading login history failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	if usersAdminOpts.Format == "json" {
+		buf, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			fmt.Printf("Encoding login history failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(buf))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, "TIME\tRESULT\tREASON\tIP\tUSER AGENT")
+
+	for _, attempt := range list {
+		result := "failed"
+		if attempt.Success {
+			result = "success"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", formatTime(&attempt.CreatedAt), result, valueOrDash(attempt.Reason),
+			valueOrDash(attempt.IP), valueOrDash(attempt.UserAgent))
+	}
+
+	w.Flush()
+}
+
+func runCmdUsersDelete(cmd *cobra.Command, args []string) {
+
+	bk := mustOpenUsersBackend()
+
+	usr := mustGetUser(bk, args)
+	userID := models.StringValue(usr.ID)
+
+	// revoke first so the user is signed out even if the delete fails
+	err := privacy.NewService(bk.users, bk.sessions, bk.history, bk.tokens).Revoke(userID)
+	if err != nil {
+		fmt.Printf("Revoking sessions and access tokens failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = bk.users.Delete(context.Background(), userID)
+	if err != nil {
+		fmt.Printf("Deleting user failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Deleted user %s\n", userID)
+}
+
+func runCmdUsersSetPassword(cmd *cobra.Command, args []string) {
+
+	bk := mustOpenUsersBackend()
+
+	usr := mustGetUser(bk, args)
+
+	password := mustReadPassword()
+
+	mustBeValid(validation.ValidateUserPassword(password))
+
+	phash, err := util.HashPassword(password)
+	if err != nil {
+		fmt.Printf("Hashing password failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = bk.users.Update(context.Background(), &models.User{
+		ID:       usr.ID,
+		Password: models.String(phash),
+	}, []string{users.FieldPassword})
+	if err != nil {
+		fmt.Printf("Setting password failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Set the password of user %s\n", models.StringValue(usr.ID))
+}
+
+// mustGetUser find the user named by the only argument, by ID then by login
+func mustGetUser(bk *backend, args []string) *models.User {
+
+	if len(args) != 1 {
+		fmt.Println("A user ID or login is required")
+		os.Exit(1)
+	}
+
+	usr, err := bk.users.GetByID(context.Background(), args[0])
+	if err == users.ErrUserNotFound {
+		usr, err = bk.users.GetByLogin(context.Background(), args[0])
+	}
+
+	if err == users.ErrUserNotFound {
+		fmt.Printf("User %s not found\n", args[0])
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Reading user failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	return usr
+}
+
+// mustUpdateUser change a field of the user and print it, the update is checked against
+// the version read so concurrent changes aren't lost.
+func mustUpdateUser(args []string, fieldName string, change func(usr *models.User)) {
+
+	bk := mustOpenUsersBackend()
+
+	usr := mustGetUser(bk, args)
+
+	change(usr)
+
+	err := bk.users.Update(context.Background(), usr, []string{fieldName})
+	if err == users.ErrConflict {
+		fmt.Println("The user was modified by another request, try again")
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Printf("Updating user failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	printUsers([]*models.User{usr}, true)
+}
+
+func mustBeValid(allErrs field.ErrorList) {
+
+	if len(allErrs) == 0 {
+		return
+	}
+
+	for _, err := range allErrs {
+		fmt.Println(err)
+	}
+
+	os.Exit(1)
+}
+
+// mustReadPassword prompt for the password twice on a terminal, otherwise read the first
+// line of stdin so passwords can be piped in by scripts.
+func mustReadPassword() string {
+
+	fd := int(os.Stdin.Fd())
+
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Printf("Reading password failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		return strings.TrimRight(line, "\r\n")
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		fmt.Printf("Reading password failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		fmt.Printf("Reading password failed: %s\n", err)
+		os.Exit(1)
+	}
+
+	if string(password) != string(confirm) {
+		fmt.Println("Passwords don't match")
+		os.Exit(1)
+	}
+
+	return string(password)
+}
+
+// printUsers print the users as JSON or a table, a single user is printed as an object or
+// a table of its fields rather than a list
+func printUsers(list []*models.User, single bool) {
+
+	if usersAdminOpts.Format == "json" {
+		var v interface{} = list
+		if single {
+			v = list[0]
+		}
+
+		buf, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			fmt.Printf("Encoding users failed: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(buf))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	if single {
+		usr := list[0]
+
+		fmt.Fprintf(w, "ID\t%s\n", models.StringValue(usr.ID))
+		fmt.Fprintf(w, "LOGIN\t%s\n", models.StringValue(usr.Login))
+		fmt.Fprintf(w, "EMAIL\t%s\n", models.StringValue(usr.Email))
+		fmt.Fprintf(w, "NAME\t%s\n", models.StringValue(usr.Name))
+		fmt.Fprintf(w, "ROLES\t%s\n", strings.Join(usr.Roles, ","))
+		fmt.Fprintf(w, "DISABLED\t%s\n", formatTime(usr.DisabledAt))
+		fmt.Fprintf(w, "LAST LOGIN\t%s\n", formatTime(usr.LastLoginAt))
+		fmt.Fprintf(w, "LAST LOGIN IP\t%s\n", models.StringValue(usr.LastLoginIP))
+		fmt.Fprintf(w, "VERSION\t%d\n", models.Int64Value(usr.Version))
+
+		w.Flush()
+		return
+	}
+
+	fmt.Fprintln(w, "ID\tLOGIN\tEMAIL\tNAME\tROLES\tDISABLED\tLAST LOGIN")
+
+	for _, usr := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", models.StringValue(usr.ID), models.StringValue(usr.Login),
+			models.StringValue(usr.Email), models.StringValue(usr.Name), strings.Join(usr.Roles, ","),
+			formatTime(usr.DisabledAt), formatTime(usr.LastLoginAt))
+	}
+
+	w.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func valueOrDash(s *string) string {
+	if models.StringValue(s) == "" {
+		return "-"
+	}
+	return *s
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
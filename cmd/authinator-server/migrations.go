@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/magiclinks"
+	"github.com/wolfeidau/authinator/store/migrate"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/tokens"
+	"github.com/wolfeidau/authinator/store/users"
+	bolt "go.etcd.io/bbolt"
+)
+
+// rethinkDBMigrations the ordered schema changes for the RethinkDB stores. Append new
+// migrations to the end and never modify ones which have been released.
+func rethinkDBMigrations(session *r.Session) []migrate.Step {
+
+	logins := migrate.RethinkDBTableStep(session, users.DBName, 2, "user_logins table reserving each login", users.LoginsTableName)
+	createLogins := logins.Up
+
+	// reserve the logins of users created before the logins table existed, users sharing a
+	// login have to be resolved by hand first as only one of them can keep it
+	logins.Up = func(ctx context.Context) error {
+		err := createLogins(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = checkDuplicateLoginsRethinkDB(ctx, session)
+		if err != nil {
+			return err
+		}
+
+		// logins reserved by an earlier attempt are skipped so the step can be rerun
+		return r.DB(users.DBName).Table(users.LoginsTableName).Insert(
+			r.DB(users.DBName).Table(users.TableName).Filter(func(usr r.Term) r.Term {
+				return r.DB(users.DBName).Table(users.LoginsTableName).Get(usr.Field("login")).Eq(nil)
+			}).Map(func(usr r.Term) interface{} {
+				return map[string]interface{}{"id": usr.Field("login"), "user_id": usr.Field("id")}
+			}),
+		).Exec(session, r.ExecOpts{Context: ctx})
+	}
+
+	return []migrate.Step{
+		migrate.RethinkDBTableStep(session, users.DBName, 1, "users table with a login index", users.TableName, users.LoginIndex),
+		logins,
+		migrate.RethinkDBTableStep(session, users.DBName, 3, "magic links table", magiclinks.TableName),
+		migrate.RethinkDBTableStep(session, users.DBName, 4, "sessions table", sessions.TableName, sessions.UserIDIndex),
+		migrate.RethinkDBTableStep(session, users.DBName, 5, "login history table", history.TableName, history.UserIDIndex),
+		migrate.RethinkDBTableStep(session, users.DBName, 6, "access tokens table", tokens.TableName, tokens.UserIDIndex, tokens.HashIndex),
+		migrate.RethinkDBIndexStep(session, users.DBName, 7, "users deleted_at index used to purge deleted users", users.TableName, users.DeletedAtIndex),
+		migrate.RethinkDBIndexStep(session, users.DBName, 8, "magic links expires_at index used to purge expired links", magiclinks.TableName, magiclinks.ExpiresAtIndex),
+		migrate.RethinkDBIndexStep(session, users.DBName, 9, "users email index", users.TableName, users.EmailIndex),
+	}
+}
+
+// checkDuplicateLoginsRethinkDB fail with the IDs of the users who share a login, or whose
+// login is already reserved by another user, before the logins are reserved
+func checkDuplicateLoginsRethinkDB(ctx context.Context, session *r.Session) error {
+
+	var groups []struct {
+		UserIDs []string `gorethink:"reduction"`
+	}
+
+	err := r.DB(users.DBName).Table(users.TableName).Map(func(usr r.Term) interface{} {
+		return map[string]interface{}{
+			"login": usr.Field("login"),
+			"id":    usr.Field("id"),
+			// the holder of an existing reservation is counted as well
+			"holder": r.DB(users.DBName).Table(users.LoginsTableName).Get(usr.Field("login")).Field("user_id").Default(usr.Field("id")),
+		}
+	}).Group("login").Ungroup().Map(func(group r.Term) interface{} {
+		return map[string]interface{}{
+			"reduction": group.Field("reduction").Field("id").Union(group.Field("reduction").Field("holder")).Distinct(),
+		}
+	}).Filter(func(group r.Term) r.Term {
+		return group.Field("reduction").Count().Gt(1)
+	}).ReadAll(&groups, session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	report := make([]string, len(groups))
+
+	for i, group := range groups {
+		report[i] = strings.Join(group.UserIDs, ", ")
+	}
+
+	return fmt.Errorf("%d logins are shared by more than one user, give each of these users a unique login and migrate again: %s",
+		len(groups), strings.Join(report, "; "))
+}
+
+// openMigrator open the backend selected by the store URL and create a migrator for it,
+// the returned function closes the backend.
+func openMigrator(u *url.URL) (*migrate.Migrator, func(), error) {
+
+	switch u.Scheme {
+	case "rethinkdb":
+		session, err := r.Connect(r.ConnectOpts{
+			Address: u.Host,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening RethinkDB session failed: %s", err)
+		}
+
+		m, err := migrate.NewMigrator(migrate.NewRethinkDBRecorder(session, users.DBName), rethinkDBMigrations(session))
+
+		return m, func() { session.Close() }, err
+
+	case "postgres", "postgresql":
+		db, err := openPostgres(u.String())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		m, err := migrate.NewMigrator(migrate.NewPostgresRecorder(db), users.PostgresMigrations(db))
+
+		return m, func() { db.Close() }, err
+
+	case "bolt":
+		db, err := openBoltFile(u)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		m, err := migrate.NewMigrator(migrate.NewBoltRecorder(db), users.BoltMigrations(db))
+
+		return m, func() { db.Close() }, err
+	}
+
+	return nil, nil, fmt.Errorf("the %s store doesn't require migration", u.Scheme)
+}
+
+// openBoltFile open the bolt database without applying migrations
+func openBoltFile(u *url.URL) (*bolt.DB, error) {
+	// both bolt:///abs/path.db and bolt://relative.db are supported
+	db, err := bolt.Open(u.Host+u.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening bolt database failed: %s", err)
+	}
+
+	return db, nil
+}
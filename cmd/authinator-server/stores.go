@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+
+	r "github.com/dancannon/gorethink"
+	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/magiclinks"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/tokens"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+// backend the stores used by the server
+type backend struct {
+	users    users.UserStore
+	links    magiclinks.MagicLinkStore
+	sessions sessions.SessionStore
+	history  history.LoginHistoryStore
+	tokens   tokens.AccessTokenStore
+
+	// session is the RethinkDB session when the stores are in RethinkDB
+	session *r.Session
+
+	// memory is set when the stores are kept in memory and lost when the process exits
+	memory bool
+}
+
+// parseStoreURL parse the store URL, an empty URL selects RethinkDB at the connection address
+func parseStoreURL(storeURL, connectionAddr string) (*url.URL, error) {
+	if storeURL == "" {
+		return &url.URL{Scheme: "rethinkdb", Host: connectionAddr}, nil
+	}
+
+	u, err := url.Parse(storeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "rethinkdb", "postgres", "postgresql", "bolt", "memory":
+		return u, nil
+	}
+
+	return nil, fmt.Errorf("unsupported store %q", u.Scheme)
+}
+
+// openBackend open the stores selected by the store URL
+func openBackend(storeURL, connectionAddr string) (*backend, error) {
+
+	u, err := parseStoreURL(storeURL, connectionAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "rethinkdb":
+		session, err := r.Connect(r.ConnectOpts{
+			Address: u.Host,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("opening RethinkDB session failed: %s", err)
+		}
+
+		return &backend{
+			users:    users.NewUserStoreRethinkDB(session),
+			links:    magiclinks.NewMagicLinkStoreRethinkDB(session),
+			sessions: sessions.NewSessionStoreRethinkDB(session),
+			history:  history.NewLoginHistoryStoreRethinkDB(session),
+			tokens:   tokens.NewAccessTokenStoreRethinkDB(session),
+			session:  session,
+		}, nil
+
+	case "postgres", "postgresql":
+		db, err := openPostgres(u.String())
+		if err != nil {
+			return nil, err
+		}
+
+		return &backend{
+			users:    users.NewUserStorePostgres(db),
+			links:    magiclinks.NewMagicLinkStorePostgres(db),
+			sessions: sessions.NewSessionStorePostgres(db),
+			history:  history.NewLoginHistoryStorePostgres(db),
+			tokens:   tokens.NewAccessTokenStorePostgres(db),
+		}, nil
+
+	case "bolt":
+		// both bolt:///abs/path.db and bolt://relative.db are supported
+		db, err := users.OpenBolt(u.Host + u.Path)
+		if err != nil {
+			return nil, fmt.Errorf("opening bolt database failed: %s", err)
+		}
+
+		return &backend{
+			users:    users.NewUserStoreBolt(db),
+			links:    magiclinks.NewMagicLinkStoreBolt(db),
+			sessions: sessions.NewSessionStoreBolt(db),
+			history:  history.NewLoginHistoryStoreBolt(db),
+			tokens:   tokens.NewAccessTokenStoreBolt(db),
+		}, nil
+	}
+
+	log.Printf("WARNING: all data is stored in memory and lost on restart")
+
+	return newLocalBackend(), nil
+}
+
+func newLocalBackend() *backend {
+	return &backend{
+		users:    users.NewUserStoreLocal(),
+		links:    magiclinks.NewMagicLinkStoreLocal(),
+		sessions: sessions.NewSessionStoreLocal(),
+		history:  history.NewLoginHistoryStoreLocal(),
+		tokens:   tokens.NewAccessTokenStoreLocal(),
+		memory:   true,
+	}
+}
+
+func openPostgres(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening PostgreSQL failed: %s", err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to PostgreSQL failed: %s", err)
+	}
+
+	return db, nil
+}
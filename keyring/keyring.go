@@ -0,0 +1,351 @@
+// Package keyring provides envelope encryption of individual fields and keyed blind
+// indexes, using versioned key encryption keys loaded from a file.
+//
+// Each value is encrypted with its own random data key using AES-256-GCM, the data key is
+// then wrapped by the primary key encryption key. Ciphertexts record the version of the key
+// which wrapped them so old keys can still decrypt after a new one is added.
+package keyring
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Prefix marks an encrypted value
+	Prefix = "enc:v1:"
+
+	// KeySize the size of key encryption, data and index keys in bytes
+	KeySize = 32
+
+	indexKeyName = "index"
+)
+
+var (
+	ErrNoKeys         = errors.New("Key file has no key encryption keys.")
+	ErrNoIndexKey     = errors.New("Key file has no index key.")
+	ErrUnknownVersion = errors.New("Value was encrypted with an unknown key version.")
+	ErrMalformed      = errors.New("Malformed encrypted value.")
+)
+
+// Keyring the versioned key encryption keys and the blind index key
+type Keyring struct {
+	keys     map[int][]byte
+	primary  int
+	indexKey []byte
+}
+
+// New create a keyring from the key encryption keys by version and the index key, the
+// highest version is used to encrypt new values.
+func New(keys map[int][]byte, indexKey []byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	if len(indexKey) != KeySize {
+		return nil, ErrNoIndexKey
+	}
+
+	kr := &Keyring{keys: make(map[int][]byte), indexKey: indexKey}
+
+	for version, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key version %d must be %d bytes", version, KeySize)
+		}
+
+		kr.keys[version] = key
+
+		if version > kr.primary {
+			kr.primary = version
+		}
+	}
+
+	return kr, nil
+}
+
+// Load read a key file, each line holds a version number or "index" followed by a base64
+// encoded key. Blank lines and lines starting with # are ignored.
+//
+//	index q83vEjRWeJq83vEjRWeJq83vEjRWeJq83vEjRWeJq80=
+//	1 AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=
+func Load(r io.Reader) (*Keyring, error) {
+
+	keys := map[int][]byte{}
+
+	var indexKey []byte
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a version and a key", line)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		if fields[0] == indexKeyName {
+			indexKey = key
+			continue
+		}
+
+		version, err := strconv.Atoi(fields[0])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("line %d: invalid version %q", line, fields[0])
+		}
+
+		if _, ok := keys[version]; ok {
+			return nil, fmt.Errorf("line %d: duplicate version %d", line, version)
+		}
+
+		keys[version] = key
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return New(keys, indexKey)
+}
+
+// LoadFile read the key file at the path
+func LoadFile(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Rotate append a new key encryption key to the key file, creating it with an index key
+// if it doesn't exist. The new version is returned.
+func Rotate(path string) (int, error) {
+
+	var lines []string
+
+	version := 1
+
+	kr, err := LoadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		key, err := NewKey()
+		if err != nil {
+			return 0, err
+		}
+		lines = append(lines, "# authinator key file, keep this secret and never remove old versions", indexKeyName+" "+key)
+	case err != nil:
+		return 0, err
+	default:
+		version = kr.primary + 1
+	}
+
+	key, err := NewKey()
+	if err != nil {
+		return 0, err
+	}
+
+	lines = append(lines, strconv.Itoa(version)+" "+key)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	return version, f.Close()
+}
+
+// NewKey generate a random base64 encoded key
+func NewKey() (string, error) {
+	key, err := randomBytes(KeySize)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// PrimaryVersion the version of the key used to encrypt new values
+func (kr *Keyring) PrimaryVersion() int {
+	return kr.primary
+}
+
+// IsEncrypted check if the value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt encrypt the value with a new data key wrapped by the primary key, the field name
+// is authenticated so a value can't be moved to another field.
+func (kr *Keyring) Encrypt(field, plaintext string) (string, error) {
+
+	dataKey, err := randomBytes(KeySize)
+	if err != nil {
+		return "", err
+	}
+
+	version := strconv.Itoa(kr.primary)
+
+	wrapped, err := seal(kr.keys[kr.primary], dataKey, []byte(version))
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(plaintext), []byte(field))
+	if err != nil {
+		return "", err
+	}
+
+	return Prefix + version + ":" + encode(wrapped) + ":" + encode(ciphertext), nil
+}
+
+// Decrypt decrypt a value produced by Encrypt for the same field
+func (kr *Keyring) Decrypt(field, value string) (string, error) {
+
+	version, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	kek, ok := kr.keys[version]
+	if !ok {
+		return "", ErrUnknownVersion
+	}
+
+	dataKey, err := open(kek, wrapped, []byte(strconv.Itoa(version)))
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, ciphertext, []byte(field))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsRewrap check if the value is plaintext or wasn't encrypted with the primary key
+func (kr *Keyring) NeedsRewrap(value string) bool {
+	version, _, _, err := parse(value)
+	return err != nil || version != kr.primary
+}
+
+// BlindIndex a keyed hash of the value which can be used to look it up without
+// decrypting, equal values in the same field always have the same index.
+func (kr *Keyring) BlindIndex(field, value string) string {
+	mac := hmac.New(sha256.New, kr.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+
+	return encode(mac.Sum(nil))
+}
+
+func parse(value string) (int, []byte, []byte, error) {
+	if !IsEncrypted(value) {
+		return 0, nil, nil, ErrMalformed
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, Prefix), ":")
+	if len(parts) != 3 {
+		return 0, nil, nil, ErrMalformed
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, nil, ErrMalformed
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, nil, nil, ErrMalformed
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, ErrMalformed
+	}
+
+	return version, wrapped, ciphertext, nil
+}
+
+// seal encrypt with AES-GCM prefixing the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package keyring
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeyring(t *testing.T, versions ...int) *Keyring {
+	keys := map[int][]byte{}
+
+	for _, v := range versions {
+		keys[v] = bytes.Repeat([]byte{byte(v)}, KeySize)
+	}
+
+	kr, err := New(keys, bytes.Repeat([]byte{0xff}, KeySize))
+	if err != nil {
+		t.Fatalf("error creating keyring %v", err)
+	}
+
+	return kr
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+
+	kr := newTestKeyring(t, 1)
+
+	ciphertext, err := kr.Encrypt("email", "mark@wolfe.id.au")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, IsEncrypted(ciphertext))
+	assert.NotContains(t, ciphertext, "mark")
+
+	// each value gets its own data key and nonce
+	other, _ := kr.Encrypt("email", "mark@wolfe.id.au")
+	assert.NotEqual(t, ciphertext, other)
+
+	plaintext, err := kr.Decrypt("email", ciphertext)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mark@wolfe.id.au", plaintext)
+	}
+
+	// the field name is authenticated
+	_, err = kr.Decrypt("name", ciphertext)
+	assert.Error(t, err)
+
+	_, err = kr.Decrypt("email", "mark@wolfe.id.au")
+	assert.Equal(t, ErrMalformed, err)
+}
+
+func TestRotation(t *testing.T) {
+
+	old := newTestKeyring(t, 1)
+
+	ciphertext, err := old.Encrypt("name", "Mark Wolfe")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	kr := newTestKeyring(t, 1, 2)
+
+	assert.Equal(t, 2, kr.PrimaryVersion())
+	assert.True(t, kr.NeedsRewrap(ciphertext))
+	assert.True(t, kr.NeedsRewrap("plaintext"))
+
+	plaintext, err := kr.Decrypt("name", ciphertext)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Mark Wolfe", plaintext)
+	}
+
+	rewrapped, err := kr.Encrypt("name", plaintext)
+	if assert.NoError(t, err) {
+		assert.False(t, kr.NeedsRewrap(rewrapped))
+	}
+
+	// retired keys can't decrypt newer values
+	_, err = old.Decrypt("name", rewrapped)
+	assert.Equal(t, ErrUnknownVersion, err)
+
+	// the blind index doesn't change with the key encryption keys
+	assert.Equal(t, old.BlindIndex("login", "wolfeidau"), kr.BlindIndex("login", "wolfeidau"))
+	assert.NotEqual(t, kr.BlindIndex("login", "wolfeidau"), kr.BlindIndex("email", "wolfeidau"))
+}
+
+func TestLoad(t *testing.T) {
+
+	_, err := Load(strings.NewReader("# no keys\n"))
+	assert.Equal(t, ErrNoKeys, err)
+
+	_, err = Load(strings.NewReader("1 AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n"))
+	assert.Equal(t, ErrNoIndexKey, err)
+
+	_, err = Load(strings.NewReader("one AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n"))
+	assert.Error(t, err)
+
+	kr, err := Load(strings.NewReader(`
+# test keys
+index AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=
+1 AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=
+3 AwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwM=
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, kr.PrimaryVersion())
+	}
+}
+
+func TestRotateFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "keyring")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys")
+
+	version, err := Rotate(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, version)
+	}
+
+	kr, err := LoadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ciphertext, _ := kr.Encrypt("name", "Mark Wolfe")
+
+	version, err = Rotate(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, version)
+	}
+
+	kr, err = LoadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, kr.PrimaryVersion())
+
+		plaintext, err := kr.Decrypt("name", ciphertext)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Mark Wolfe", plaintext)
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+}
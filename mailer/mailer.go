@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain text emails to users
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends email using an SMTP relay
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer create a new SMTP mailer, if username is empty no
+// authentication is performed.
+func NewSMTPMailer(addr, from, username, password string) Mailer {
+	var auth smtp.Auth
+
+	if username != "" {
+		host := strings.Split(addr, ":")[0]
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{addr: addr, from: from, auth: auth}
+}
+
+// Send send the email via the SMTP relay
+func (sm *SMTPMailer) Send(to, subject, body string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", sm.from, to, subject, body)
+
+	return smtp.SendMail(sm.addr, sm.auth, sm.from, []string{to}, []byte(msg))
+}
+
+// LogMailer writes emails to the log, this is for development purposes
+type LogMailer struct{}
+
+// NewLogMailer create a new mailer which logs emails
+func NewLogMailer() Mailer {
+	return &LogMailer{}
+}
+
+// Send log the email
+func (lm *LogMailer) Send(to, subject, body string) error {
+	log.Printf("mail to=%s subject=%q\n%s", to, subject, body)
+	return nil
+}
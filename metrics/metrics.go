@@ -0,0 +1,182 @@
+// Package metrics records Prometheus metrics for the API traffic, sign ins, tokens,
+// password hashing and stores, and serves them for scraping.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "authinator"
+
+var (
+	// Registry the registry the metrics are registered with and served from
+	Registry = prometheus.NewRegistry()
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	signIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sign_ins_total",
+		Help:      "Sign in attempts by result and the reason they failed.",
+	}, []string{"result", "reason"})
+
+	tokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Tokens issued by type.",
+	}, []string{"type"})
+
+	tokenFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_validation_failures_total",
+		Help:      "Tokens rejected when authenticating requests by reason.",
+	}, []string{"reason"})
+
+	passwordHashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Time taken to hash or compare a password, including waiting for a hashing slot.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"operation"})
+
+	storeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_operation_duration_seconds",
+		Help:      "Store operation latency by store, operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"store", "operation", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		requests,
+		requestDuration,
+		signIns,
+		tokensIssued,
+		tokenFailures,
+		passwordHashDuration,
+		storeDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serve the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Filter count and time every request by the route it matched, as a container filter it
+// applies to every resource. Requests which match no route are recorded as unmatched.
+func Filter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+
+	start := time.Now()
+
+	chain.ProcessFilter(req, resp)
+
+	route := req.SelectedRoutePath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	method := req.Request.Method
+
+	requests.WithLabelValues(route, method, strconv.Itoa(resp.StatusCode())).Inc()
+	requestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+}
+
+// SignIn record a sign in attempt, the reason is empty when it succeeded
+func SignIn(success bool, reason string) {
+	if success {
+		signIns.WithLabelValues("success", "").Inc()
+		return
+	}
+	signIns.WithLabelValues("failure", reason).Inc()
+}
+
+// TokenIssued record a token being issued, such as session, magic_link or access_token
+func TokenIssued(tokenType string) {
+	tokensIssued.WithLabelValues(tokenType).Inc()
+}
+
+// TokenRejected record a token being rejected when authenticating a request
+func TokenRejected(reason string) {
+	tokenFailures.WithLabelValues(reason).Inc()
+}
+
+// ObservePasswordHash record how long it took to hash or compare a password
+func ObservePasswordHash(operation string, start time.Time) {
+	passwordHashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// ObserveStoreOperation record how long a store operation took, the result is ok,
+// not_found when err is the store's not found error or error otherwise.
+func ObserveStoreOperation(store, operation string, start time.Time, err, notFound error) {
+
+	result := "ok"
+
+	switch {
+	case err == nil:
+	case err == notFound:
+		result = "not_found"
+	default:
+		result = "error"
+	}
+
+	storeDuration.WithLabelValues(store, operation, result).Observe(time.Since(start).Seconds())
+}
+
+// RegisterCacheStats expose the hits and misses of a cache, stats is called when the
+// metrics are scraped.
+func RegisterCacheStats(cache string, stats func() (hits, misses uint64)) error {
+
+	labels := prometheus.Labels{"cache": cache}
+
+	for _, c := range []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_hits_total",
+			Help:        "Lookups served from the cache.",
+			ConstLabels: labels,
+		}, func() float64 {
+			hits, _ := stats()
+			return float64(hits)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_misses_total",
+			Help:        "Lookups which weren't in the cache.",
+			ConstLabels: labels,
+		}, func() float64 {
+			_, misses := stats()
+			return float64(misses)
+		}),
+	} {
+		err := Registry.Register(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
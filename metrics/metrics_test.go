@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFilter(t *testing.T) {
+
+	container := restful.NewContainer()
+	container.Filter(Filter)
+
+	ws := new(restful.WebService)
+	ws.Path("/users")
+	ws.Route(ws.GET("/sessions/{session-id}").To(func(req *restful.Request, resp *restful.Response) {
+		resp.WriteErrorString(http.StatusNotFound, "404: Not Found")
+	}))
+	container.Add(ws)
+
+	for _, path := range []string{"/users/sessions/1", "/users/sessions/2", "/users/nothing/here"} {
+		req := httptest.NewRequest("GET", "http://api.his.com"+path, nil)
+		container.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if n := testutil.ToFloat64(requests.WithLabelValues("/users/sessions/{session-id}", "GET", "404")); n != 2 {
+		t.Errorf("expected 2 requests to the route got %v", n)
+	}
+
+	if n := testutil.ToFloat64(requests.WithLabelValues("unmatched", "GET", "404")); n != 1 {
+		t.Errorf("expected 1 unmatched request got %v", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+
+	SignIn(false, "bad_password")
+	TokenRejected("expired")
+
+	notFound := errors.New("not found")
+
+	ObserveStoreOperation("test", "get", time.Now(), nil, notFound)
+	ObserveStoreOperation("test", "get", time.Now(), notFound, notFound)
+	ObserveStoreOperation("test", "get", time.Now(), errors.New("timeout"), notFound)
+
+	err := RegisterCacheStats("test", func() (uint64, uint64) { return 3, 1 })
+	if err != nil {
+		t.Fatalf("error registering cache stats %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "http://api.his.com/metrics", nil))
+
+	body := recorder.Body.String()
+
+	for _, line := range []string{
+		`authinator_sign_ins_total{reason="bad_password",result="failure"} 1`,
+		`authinator_token_validation_failures_total{reason="expired"} 1`,
+		`authinator_cache_hits_total{cache="test"} 3`,
+		`authinator_store_operation_duration_seconds_count{operation="get",result="ok",store="test"} 1`,
+		`authinator_store_operation_duration_seconds_count{operation="get",result="not_found",store="test"} 1`,
+		`authinator_store_operation_duration_seconds_count{operation="get",result="error",store="test"} 1`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected metrics to contain %s", line)
+		}
+	}
+}
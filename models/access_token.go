@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AccessToken represents a named personal access token used by scripts and CI, only
+// a hash of the token is stored.
+type AccessToken struct {
+	ID         *string    `json:"id,omitempty" gorethink:"id,omitempty"`
+	UserID     *string    `json:"user_id,omitempty" gorethink:"user_id"`
+	Name       *string    `json:"name,omitempty" gorethink:"name"`
+	Scopes     []string   `json:"scopes,omitempty" gorethink:"scopes"`
+	Hash       *string    `json:"-" gorethink:"hash"`
+	CreatedAt  *time.Time `json:"created_at,omitempty" gorethink:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" gorethink:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" gorethink:"last_used_at,omitempty"`
+
+	// Token is only populated when the token is created
+	Token *string `json:"token,omitempty" gorethink:"-"`
+}
@@ -5,3 +5,8 @@ type Authentication struct {
 	Login    string `schema:"login"`
 	Password string `schema:"password"`
 }
+
+// MagicLinkRequest used to parse magic link requests
+type MagicLinkRequest struct {
+	Login string `schema:"login"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// LoginAttempt represents a successful or failed sign in by a user.
+type LoginAttempt struct {
+	ID        *string   `json:"id,omitempty" gorethink:"id,omitempty"`
+	UserID    *string   `json:"user_id,omitempty" gorethink:"user_id"`
+	Success   bool      `json:"success" gorethink:"success"`
+	Reason    *string   `json:"reason,omitempty" gorethink:"reason,omitempty"`
+	IP        *string   `json:"ip,omitempty" gorethink:"ip"`
+	UserAgent *string   `json:"user_agent,omitempty" gorethink:"user_agent"`
+	CreatedAt time.Time `json:"created_at" gorethink:"created_at"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// MagicLink represents a single use sign in link which has been emailed to a user.
+type MagicLink struct {
+	ID        *string   `json:"id,omitempty" gorethink:"id,omitempty"`
+	UserID    *string   `json:"user_id,omitempty" gorethink:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" gorethink:"expires_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Session represents a signed in device or browser.
+type Session struct {
+	ID         *string   `json:"id,omitempty" gorethink:"id,omitempty"`
+	UserID     *string   `json:"user_id,omitempty" gorethink:"user_id"`
+	CreatedAt  time.Time `json:"created_at" gorethink:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" gorethink:"last_seen_at"`
+	IP         *string   `json:"ip,omitempty" gorethink:"ip"`
+	UserAgent  *string   `json:"user_agent,omitempty" gorethink:"user_agent"`
+	Current    bool      `json:"current,omitempty" gorethink:"-"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // String returns a pointer to of the string value passed in.
 func String(v string) *string {
 	return &v
@@ -14,6 +16,20 @@ func StringValue(v *string) string {
 	return ""
 }
 
+// Int64 returns a pointer to of the int64 value passed in.
+func Int64(v int64) *int64 {
+	return &v
+}
+
+// Int64Value returns the value of the int64 pointer passed in or
+// 0 if the pointer is nil.
+func Int64Value(v *int64) int64 {
+	if v != nil {
+		return *v
+	}
+	return 0
+}
+
 // NewUser helper method to create a user
 func NewUser(id, login, email, name string) *User {
 	return &User{
@@ -31,4 +47,27 @@ type User struct {
 	Email    *string `json:"email,omitempty" gorethink:"email"`
 	Name     *string `json:"name,omitempty" gorethink:"name,omitempty"`
 	Password *string `json:"password,omitempty" gorethink:"password"`
+
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" gorethink:"last_login_at,omitempty"`
+	LastLoginIP *string    `json:"last_login_ip,omitempty" gorethink:"last_login_ip,omitempty"`
+
+	// DeletedAt is set when the user is soft deleted, deleted users can't sign in and
+	// are permanently erased once the retention period has passed.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorethink:"deleted_at,omitempty"`
+
+	// DisabledAt is set when an administrator disables the user, disabled users can't sign
+	// in or use their existing sessions and tokens until they are enabled again.
+	DisabledAt *time.Time `json:"disabled_at,omitempty" gorethink:"disabled_at,omitempty"`
+
+	// Roles are granted to the user by an administrator.
+	Roles []string `json:"roles,omitempty" gorethink:"roles,omitempty"`
+
+	// LoginCiphertext and EmailIndex are only set in storage when fields are encrypted, the
+	// login then holds its blind index and the plaintext is kept encrypted here.
+	LoginCiphertext *string `json:"login_ciphertext,omitempty" gorethink:"login_ciphertext,omitempty"`
+	EmailIndex      *string `json:"email_index,omitempty" gorethink:"email_index,omitempty"`
+
+	// Version is incremented by every update, updates which supply it fail if the
+	// user has been changed since it was read.
+	Version *int64 `json:"version,omitempty" gorethink:"version,omitempty"`
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserExport everything stored about a user, returned for subject access requests. The
+// login history is the audit trail so it also holds the user's audit entries.
+type UserExport struct {
+	User         *User           `json:"user"`
+	Sessions     []*Session      `json:"sessions"`
+	LoginHistory []*LoginAttempt `json:"login_history"`
+	AccessTokens []*AccessToken  `json:"access_tokens"`
+	ExportedAt   time.Time       `json:"exported_at"`
+}
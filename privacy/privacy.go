@@ -0,0 +1,197 @@
+// Package privacy answers subject access and erasure requests for users by gathering or
+// scrubbing their data across every store.
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/tokens"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+// PseudonymPrefix is the prefix of the pseudonyms given to erased users
+var PseudonymPrefix = "erased-"
+
+// Service exports and erases user data, the sessions, history and tokens stores are
+// optional and skipped when nil.
+//
+// Magic links aren't covered as they only hold the user ID and expire within minutes.
+//
+// The login history is the audit trail, there is no separate audit log, so the audit
+// entries of a user are the sign in attempts in the export and the pseudonymous stubs
+// left behind by an erasure.
+type Service struct {
+	users    users.UserStore
+	sessions sessions.SessionStore
+	history  history.LoginHistoryStore
+	tokens   tokens.AccessTokenStore
+}
+
+// NewService create a new privacy service over the stores
+func NewService(userStore users.UserStore, sessionStore sessions.SessionStore, historyStore history.LoginHistoryStore, tokenStore tokens.AccessTokenStore) *Service {
+	return &Service{userStore, sessionStore, historyStore, tokenStore}
+}
+
+// Export gather everything stored about the user, the login history holds their audit entries
+func (s *Service) Export(ctx context.Context, userID string) (*models.UserExport, error) {
+
+	usr, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &models.UserExport{
+		User:         usr,
+		Sessions:     []*models.Session{},
+		LoginHistory: []*models.LoginAttempt{},
+		AccessTokens: []*models.AccessToken{},
+		ExportedAt:   time.Now().UTC(),
+	}
+
+	if s.sessions != nil {
+		export.Sessions, err = s.sessions.ListByUser(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.history != nil {
+		export.LoginHistory, err = s.history.ListByUser(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.tokens != nil {
+		export.AccessTokens, err = s.tokens.ListByUser(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return export, nil
+}
+
+// Erase permanently remove the user and their sessions and access tokens, their login
+// history is kept under a random pseudonym without the IP address or user agent. The
+// pseudonym is returned so the erasure can be recorded.
+//
+// The user is erased last so a failed erasure can be retried, soft deleted users are
+// erased as well and users.ErrUserNotFound is returned if the user doesn't exist.
+func (s *Service) Erase(ctx context.Context, userID string) (string, error) {
+
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.Revoke(userID)
+	if err != nil {
+		return "", err
+	}
+
+	if s.history != nil {
+		err = s.history.Pseudonymize(userID, pseudonym)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = s.users.Erase(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return pseudonym, nil
+}
+
+// Revoke remove every session and access token of the user, signing them out everywhere
+func (s *Service) Revoke(userID string) error {
+
+	if s.sessions != nil {
+		list, err := s.sessions.ListByUser(userID)
+		if err != nil {
+			return err
+		}
+
+		for _, session := range list {
+			err = s.sessions.Delete(models.StringValue(session.ID))
+			if err != nil && err != sessions.ErrSessionNotFound {
+				return err
+			}
+		}
+	}
+
+	if s.tokens != nil {
+		list, err := s.tokens.ListByUser(userID)
+		if err != nil {
+			return err
+		}
+
+		for _, token := range list {
+			err = s.tokens.Delete(models.StringValue(token.ID))
+			if err != nil && err != tokens.ErrAccessTokenNotFound {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteZip write the export as a ZIP archive with a JSON file for each part
+func WriteZip(w io.Writer, export *models.UserExport) error {
+
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"user.json", export.User},
+		{"sessions.json", export.Sessions},
+		{"login_history.json", export.LoginHistory},
+		{"access_tokens.json", export.AccessTokens},
+	}
+
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(f.v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func newPseudonym() (string, error) {
+	buf := make([]byte, 16)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return PseudonymPrefix + hex.EncodeToString(buf), nil
+}
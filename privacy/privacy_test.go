@@ -0,0 +1,137 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/history"
+	"github.com/wolfeidau/authinator/store/sessions"
+	"github.com/wolfeidau/authinator/store/tokens"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+func setupService(t *testing.T) (*Service, *Service) {
+	userStore := users.NewUserStoreLocal()
+	sessionStore := sessions.NewSessionStoreLocal()
+	historyStore := history.NewLoginHistoryStoreLocal()
+	tokenStore := tokens.NewAccessTokenStoreLocal()
+
+	usr := models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+	usr.Password = models.String("LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP")
+
+	_, err := userStore.Create(context.Background(), usr)
+	if err != nil {
+		t.Fatalf("error creating user %v", err)
+	}
+
+	sessionStore.Create(&models.Session{UserID: models.String("123"), IP: models.String("127.0.0.1")})
+	historyStore.Record(&models.LoginAttempt{UserID: models.String("123"), Success: true, IP: models.String("127.0.0.1"), CreatedAt: time.Now()})
+	tokenStore.Create(&models.AccessToken{UserID: models.String("123"), Name: models.String("ci"), Hash: models.String("abc")})
+
+	return NewService(userStore, sessionStore, historyStore, tokenStore), NewService(userStore, nil, nil, nil)
+}
+
+func TestExport(t *testing.T) {
+
+	svc, usersOnly := setupService(t)
+
+	export, err := svc.Export(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "wolfeidau", models.StringValue(export.User.Login))
+		assert.Nil(t, export.User.Password)
+		assert.Len(t, export.Sessions, 1)
+		assert.Len(t, export.LoginHistory, 1)
+		assert.Len(t, export.AccessTokens, 1)
+	}
+
+	export, err = usersOnly.Export(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Empty(t, export.Sessions)
+	}
+
+	_, err = svc.Export(context.Background(), "nothere")
+	assert.Equal(t, users.ErrUserNotFound, err)
+}
+
+func TestErase(t *testing.T) {
+
+	svc, _ := setupService(t)
+
+	pseudonym, err := svc.Erase(context.Background(), "123")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, strings.HasPrefix(pseudonym, PseudonymPrefix))
+
+	_, err = svc.users.GetByID(context.Background(), "123")
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	list, _ := svc.sessions.ListByUser("123")
+	assert.Empty(t, list)
+
+	tokenList, _ := svc.tokens.ListByUser("123")
+	assert.Empty(t, tokenList)
+
+	attempts, _ := svc.history.ListByUser("123")
+	assert.Empty(t, attempts)
+
+	// only a pseudonymous stub of the attempt is left
+	attempts, _ = svc.history.ListByUser(pseudonym)
+	if assert.Len(t, attempts, 1) {
+		assert.True(t, attempts[0].Success)
+		assert.Nil(t, attempts[0].IP)
+	}
+
+	_, err = svc.Erase(context.Background(), "123")
+	assert.Equal(t, users.ErrUserNotFound, err)
+}
+
+func TestWriteZip(t *testing.T) {
+
+	svc, _ := setupService(t)
+
+	export, err := svc.Export(context.Background(), "123")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = WriteZip(buf, export)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	names := []string{}
+
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+
+	assert.Equal(t, []string{"user.json", "sessions.json", "login_history.json", "access_tokens.json"}, names)
+
+	rc, err := zr.File[0].Open()
+	if assert.NoError(t, err) {
+		defer rc.Close()
+
+		usr := new(models.User)
+
+		err = json.NewDecoder(rc).Decode(usr)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "123", models.StringValue(usr.ID))
+		}
+	}
+}
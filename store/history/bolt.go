@@ -0,0 +1,144 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ LoginHistoryStore = &LoginHistoryStoreBolt{}
+
+// LoginHistoryStoreBolt bolt based login history store, the attempts are kept in the same
+// file as the users in a bucket for each user keyed by sequence so they are in the order
+// they were recorded.
+type LoginHistoryStoreBolt struct {
+	db *bolt.DB
+}
+
+// NewLoginHistoryStoreBolt create a new bolt backed login history store, the database
+// should be opened with users.OpenBolt.
+func NewLoginHistoryStoreBolt(db *bolt.DB) LoginHistoryStore {
+	return &LoginHistoryStoreBolt{db}
+}
+
+// Record store the attempt discarding the oldest attempts over the limit
+func (hs *LoginHistoryStoreBolt) Record(attempt *models.LoginAttempt) error {
+	return hs.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(users.BoltLoginHistoryBucket).CreateBucketIfNotExists([]byte(models.StringValue(attempt.UserID)))
+		if err != nil {
+			return err
+		}
+
+		err = putBoltAttempt(b, attempt)
+		if err != nil {
+			return err
+		}
+
+		var n int
+		err = b.ForEach(func(k, v []byte) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// the oldest attempts are first
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && n > MaxAttemptsPerUser; k, _ = c.First() {
+			err = c.Delete()
+			if err != nil {
+				return err
+			}
+			n--
+		}
+
+		return nil
+	})
+}
+
+// ListByUser list the attempts for a user, most recent first
+func (hs *LoginHistoryStoreBolt) ListByUser(userID string) ([]*models.LoginAttempt, error) {
+	list := []*models.LoginAttempt{}
+
+	err := hs.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(users.BoltLoginHistoryBucket).Bucket([]byte(userID))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil && len(list) < MaxAttemptsPerUser; k, v = c.Prev() {
+			attempt := new(models.LoginAttempt)
+
+			err := json.Unmarshal(v, attempt)
+			if err != nil {
+				return err
+			}
+
+			list = append(list, attempt)
+		}
+
+		return nil
+	})
+
+	return list, err
+}
+
+// Pseudonymize move the attempts of the user to the pseudonym removing identifying details
+func (hs *LoginHistoryStoreBolt) Pseudonymize(userID, pseudonym string) error {
+	return hs.db.Update(func(tx *bolt.Tx) error {
+		history := tx.Bucket(users.BoltLoginHistoryBucket)
+
+		b := history.Bucket([]byte(userID))
+		if b == nil {
+			return nil
+		}
+
+		dest, err := history.CreateBucketIfNotExists([]byte(pseudonym))
+		if err != nil {
+			return err
+		}
+
+		err = b.ForEach(func(k, v []byte) error {
+			attempt := new(models.LoginAttempt)
+
+			err := json.Unmarshal(v, attempt)
+			if err != nil {
+				return err
+			}
+
+			attempt.UserID = models.String(pseudonym)
+			attempt.IP = nil
+			attempt.UserAgent = nil
+
+			return putBoltAttempt(dest, attempt)
+		})
+		if err != nil {
+			return err
+		}
+
+		return history.DeleteBucket([]byte(userID))
+	})
+}
+
+// putBoltAttempt add the attempt to the end of the bucket
+func putBoltAttempt(b *bolt.Bucket, attempt *models.LoginAttempt) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+
+	return b.Put(key, buf)
+}
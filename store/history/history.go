@@ -0,0 +1,21 @@
+package history
+
+import (
+	"github.com/wolfeidau/authinator/models"
+)
+
+var (
+	// MaxAttemptsPerUser the number of sign in attempts retained for each user
+	MaxAttemptsPerUser = 50
+)
+
+// LoginHistoryStore login history store interface, only the most recent
+// MaxAttemptsPerUser attempts are retained for each user.
+//
+// Pseudonymize moves the attempts of an erased user to the pseudonym and removes the IP
+// address and user agent, leaving a record of the attempts which can't be tied to the user.
+type LoginHistoryStore interface {
+	Record(attempt *models.LoginAttempt) error
+	ListByUser(userID string) ([]*models.LoginAttempt, error)
+	Pseudonymize(userID, pseudonym string) error
+}
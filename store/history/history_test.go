@@ -0,0 +1,86 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/pgtest"
+	"github.com/wolfeidau/authinator/store/users/storetest"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+func TestLoginHistoryStore(t *testing.T) {
+	storetest.RunBackends(t, func(t *testing.T, b *storetest.Backend) {
+		testLoginHistoryStore(t, newLoginHistoryStore(t, b))
+	})
+}
+
+// newLoginHistoryStore create the login history store for the backend
+func newLoginHistoryStore(t *testing.T, b *storetest.Backend) LoginHistoryStore {
+	switch {
+	case b.Bolt != nil:
+		return NewLoginHistoryStoreBolt(b.Bolt)
+	case b.Postgres != nil:
+		return NewLoginHistoryStorePostgres(b.Postgres)
+	case b.RethinkDB != nil:
+		storetest.RethinkDBTable(t, b.RethinkDB, TableName, UserIDIndex)
+		return NewLoginHistoryStoreRethinkDB(b.RethinkDB)
+	}
+
+	return NewLoginHistoryStoreLocal()
+}
+
+func testLoginHistoryStore(t *testing.T, store LoginHistoryStore) {
+
+	defer func(max int) { MaxAttemptsPerUser = max }(MaxAttemptsPerUser)
+	MaxAttemptsPerUser = 3
+
+	start := time.Now().UTC().Truncate(time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		err := store.Record(&models.LoginAttempt{
+			UserID:    models.String("123"),
+			Success:   i%2 == 0,
+			IP:        models.String("127.0.0.1"),
+			UserAgent: models.String("curl"),
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	store.Record(&models.LoginAttempt{UserID: models.String("456"), Reason: models.String("bad_password"), CreatedAt: start})
+
+	list, err := store.ListByUser("123")
+	if assert.NoError(t, err) && assert.Len(t, list, 3) {
+		assert.True(t, start.Add(4*time.Minute).Equal(list[0].CreatedAt))
+		assert.True(t, start.Add(2*time.Minute).Equal(list[2].CreatedAt))
+		assert.True(t, list[0].Success)
+		assert.False(t, list[1].Success)
+	}
+
+	list, err = store.ListByUser("456")
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, "bad_password", models.StringValue(list[0].Reason))
+	}
+
+	assert.NoError(t, store.Pseudonymize("123", "erased-1"))
+
+	list, err = store.ListByUser("123")
+	if assert.NoError(t, err) {
+		assert.Len(t, list, 0)
+	}
+
+	list, err = store.ListByUser("erased-1")
+	if assert.NoError(t, err) && assert.Len(t, list, 3) {
+		assert.Equal(t, "erased-1", models.StringValue(list[0].UserID))
+		assert.Nil(t, list[0].IP)
+		assert.Nil(t, list[0].UserAgent)
+	}
+}
@@ -0,0 +1,76 @@
+package history
+
+import (
+	"sync"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ LoginHistoryStore = &LoginHistoryStoreLocal{}
+
+// LoginHistoryStoreLocal local login history store for testing purposes
+type LoginHistoryStoreLocal struct {
+	sync.RWMutex
+	attempts map[string][]models.LoginAttempt
+}
+
+// NewLoginHistoryStoreLocal create a new local login history store
+func NewLoginHistoryStoreLocal() LoginHistoryStore {
+	return &LoginHistoryStoreLocal{attempts: make(map[string][]models.LoginAttempt)}
+}
+
+// Record store the attempt discarding the oldest attempts over the limit
+func (lhl *LoginHistoryStoreLocal) Record(attempt *models.LoginAttempt) error {
+	lhl.Lock()
+	defer lhl.Unlock()
+
+	userID := models.StringValue(attempt.UserID)
+
+	// most recent first
+	list := append([]models.LoginAttempt{*attempt}, lhl.attempts[userID]...)
+
+	if len(list) > MaxAttemptsPerUser {
+		list = list[:MaxAttemptsPerUser]
+	}
+
+	lhl.attempts[userID] = list
+
+	return nil
+}
+
+// ListByUser list the attempts for a user, most recent first
+func (lhl *LoginHistoryStoreLocal) ListByUser(userID string) ([]*models.LoginAttempt, error) {
+	lhl.RLock()
+	defer lhl.RUnlock()
+
+	list := []*models.LoginAttempt{}
+
+	for _, v := range lhl.attempts[userID] {
+		attempt := v
+		list = append(list, &attempt)
+	}
+
+	return list, nil
+}
+
+// Pseudonymize move the attempts of the user to the pseudonym removing identifying details
+func (lhl *LoginHistoryStoreLocal) Pseudonymize(userID, pseudonym string) error {
+	lhl.Lock()
+	defer lhl.Unlock()
+
+	list := lhl.attempts[userID]
+
+	for i := range list {
+		list[i].UserID = models.String(pseudonym)
+		list[i].IP = nil
+		list[i].UserAgent = nil
+	}
+
+	delete(lhl.attempts, userID)
+
+	if len(list) > 0 {
+		lhl.attempts[pseudonym] = list
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package history
+
+import (
+	"time"
+
+	"github.com/wolfeidau/authinator/metrics"
+	"github.com/wolfeidau/authinator/models"
+)
+
+type loginHistoryStoreMetrics struct {
+	store LoginHistoryStore
+}
+
+// NewLoginHistoryStoreMetrics create a login history store which records the latency and
+// result of each operation on the store
+func NewLoginHistoryStoreMetrics(store LoginHistoryStore) LoginHistoryStore {
+	return &loginHistoryStoreMetrics{store}
+}
+
+func observeOperation(operation string, start time.Time, err error) {
+	metrics.ObserveStoreOperation("history", operation, start, err, nil)
+}
+
+func (hm *loginHistoryStoreMetrics) Record(attempt *models.LoginAttempt) (err error) {
+	defer func(start time.Time) { observeOperation("record", start, err) }(time.Now())
+	return hm.store.Record(attempt)
+}
+
+func (hm *loginHistoryStoreMetrics) ListByUser(userID string) (list []*models.LoginAttempt, err error) {
+	defer func(start time.Time) { observeOperation("list_by_user", start, err) }(time.Now())
+	return hm.store.ListByUser(userID)
+}
+
+func (hm *loginHistoryStoreMetrics) Pseudonymize(userID, pseudonym string) (err error) {
+	defer func(start time.Time) { observeOperation("pseudonymize", start, err) }(time.Now())
+	return hm.store.Pseudonymize(userID, pseudonym)
+}
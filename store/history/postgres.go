@@ -0,0 +1,76 @@
+package history
+
+import (
+	"database/sql"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ LoginHistoryStore = &LoginHistoryStorePostgres{}
+
+// LoginHistoryStorePostgres PostgreSQL based login history store
+type LoginHistoryStorePostgres struct {
+	db *sql.DB
+}
+
+// NewLoginHistoryStorePostgres create a new PostgreSQL backed login history store, the
+// table is created by the users.PostgresMigrations.
+func NewLoginHistoryStorePostgres(db *sql.DB) LoginHistoryStore {
+	return &LoginHistoryStorePostgres{db}
+}
+
+// Record insert the attempt then delete the oldest attempts over the limit
+func (hs *LoginHistoryStorePostgres) Record(attempt *models.LoginAttempt) error {
+
+	var id string
+
+	err := hs.db.QueryRow(`INSERT INTO login_history (user_id, success, reason, ip, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id::TEXT`,
+		attempt.UserID, attempt.Success, attempt.Reason, attempt.IP, attempt.UserAgent, attempt.CreatedAt).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	attempt.ID = models.String(id)
+
+	_, err = hs.db.Exec(`DELETE FROM login_history WHERE user_id = $1 AND id NOT IN (
+		SELECT id FROM login_history WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2)`,
+		attempt.UserID, MaxAttemptsPerUser)
+
+	return err
+}
+
+// ListByUser list the attempts for a user, most recent first
+func (hs *LoginHistoryStorePostgres) ListByUser(userID string) ([]*models.LoginAttempt, error) {
+
+	rows, err := hs.db.Query(`SELECT id::TEXT, user_id, success, reason, ip, user_agent, created_at FROM login_history
+		WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, userID, MaxAttemptsPerUser)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*models.LoginAttempt{}
+
+	for rows.Next() {
+		attempt := new(models.LoginAttempt)
+
+		err = rows.Scan(&attempt.ID, &attempt.UserID, &attempt.Success, &attempt.Reason, &attempt.IP, &attempt.UserAgent, &attempt.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, attempt)
+	}
+
+	return list, rows.Err()
+}
+
+// Pseudonymize move the attempts of the user to the pseudonym removing identifying details
+func (hs *LoginHistoryStorePostgres) Pseudonymize(userID, pseudonym string) error {
+
+	_, err := hs.db.Exec("UPDATE login_history SET user_id = $2, ip = NULL, user_agent = NULL WHERE user_id = $1", userID, pseudonym)
+
+	return err
+}
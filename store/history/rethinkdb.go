@@ -0,0 +1,73 @@
+package history
+
+import (
+	r "github.com/dancannon/gorethink"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+var _ LoginHistoryStore = &LoginHistoryStoreRethinkDB{}
+
+var (
+	// TableName is the name of login history table in the RethinkDB database
+	TableName = "login_history"
+	// UserIDIndex is the name of the secondary index on user_id
+	UserIDIndex = "user_id"
+)
+
+// LoginHistoryStoreRethinkDB RethinkDB based login history store
+type LoginHistoryStoreRethinkDB struct {
+	session *r.Session
+}
+
+// NewLoginHistoryStoreRethinkDB create a new RethinkDB backed login history store
+func NewLoginHistoryStoreRethinkDB(session *r.Session) LoginHistoryStore {
+	return &LoginHistoryStoreRethinkDB{session}
+}
+
+// Record insert the attempt then delete the oldest attempts over the limit
+func (hs *LoginHistoryStoreRethinkDB) Record(attempt *models.LoginAttempt) error {
+
+	_, err := r.DB(users.DBName).Table(TableName).Insert(attempt).RunWrite(hs.session)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB(users.DBName).Table(TableName).GetAllByIndex(UserIDIndex, models.StringValue(attempt.UserID)).
+		OrderBy(r.Desc("created_at")).Skip(MaxAttemptsPerUser).Delete().RunWrite(hs.session)
+
+	return err
+}
+
+// ListByUser list the attempts for a user using the user_id index, most recent first
+func (hs *LoginHistoryStoreRethinkDB) ListByUser(userID string) ([]*models.LoginAttempt, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).GetAllByIndex(UserIDIndex, userID).
+		OrderBy(r.Desc("created_at")).Limit(MaxAttemptsPerUser).Run(hs.session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	list := []*models.LoginAttempt{}
+
+	err = res.All(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Pseudonymize move the attempts of the user to the pseudonym removing identifying details
+func (hs *LoginHistoryStoreRethinkDB) Pseudonymize(userID, pseudonym string) error {
+
+	_, err := r.DB(users.DBName).Table(TableName).GetAllByIndex(UserIDIndex, userID).Update(map[string]interface{}{
+		"user_id":    pseudonym,
+		"ip":         nil,
+		"user_agent": nil,
+	}).RunWrite(hs.session)
+
+	return err
+}
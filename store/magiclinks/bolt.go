@@ -0,0 +1,122 @@
+package magiclinks
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ MagicLinkStore = &MagicLinkStoreBolt{}
+
+// MagicLinkStoreBolt bolt based magic link store, the links are kept in the same file as
+// the users.
+type MagicLinkStoreBolt struct {
+	db *bolt.DB
+}
+
+// NewMagicLinkStoreBolt create a new bolt backed magic link store, the database should be
+// opened with users.OpenBolt.
+func NewMagicLinkStoreBolt(db *bolt.DB) MagicLinkStore {
+	return &MagicLinkStoreBolt{db}
+}
+
+// Create store a new magic link in bolt, an ID is generated if one isn't supplied
+func (ms *MagicLinkStoreBolt) Create(link *models.MagicLink) (*models.MagicLink, error) {
+
+	if link.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		link.ID = models.String(id)
+	}
+
+	buf, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ms.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(users.BoltMagicLinksBucket).Put([]byte(models.StringValue(link.ID)), buf)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// Consume read and delete the magic link in one transaction so only one caller can
+// consume a link.
+func (ms *MagicLinkStoreBolt) Consume(linkID string) (*models.MagicLink, error) {
+
+	link := new(models.MagicLink)
+
+	err := ms.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(users.BoltMagicLinksBucket)
+
+		buf := b.Get([]byte(linkID))
+		if buf == nil {
+			return ErrMagicLinkNotFound
+		}
+
+		err := json.Unmarshal(buf, link)
+		if err != nil {
+			return err
+		}
+
+		return b.Delete([]byte(linkID))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// PurgeExpired delete the magic links which expired before the time from bolt, the links
+// are only valid for minutes so there are few to scan
+func (ms *MagicLinkStoreBolt) PurgeExpired(expiredBefore time.Time) (int, error) {
+
+	n := 0
+
+	err := ms.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(users.BoltMagicLinksBucket)
+
+		var expired [][]byte
+
+		err := b.ForEach(func(k, v []byte) error {
+			link := new(models.MagicLink)
+
+			err := json.Unmarshal(v, link)
+			if err != nil {
+				return err
+			}
+
+			if link.ExpiresAt.Before(expiredBefore) {
+				expired = append(expired, k)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			err = b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+
+		n = len(expired)
+
+		return nil
+	})
+
+	return n, err
+}
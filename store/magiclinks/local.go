@@ -0,0 +1,84 @@
+package magiclinks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ MagicLinkStore = &MagicLinkStoreLocal{}
+
+// MagicLinkStoreLocal local magic link store for testing purposes
+type MagicLinkStoreLocal struct {
+	sync.Mutex
+	links map[string]*models.MagicLink
+}
+
+// NewMagicLinkStoreLocal create a new local magic link store
+func NewMagicLinkStoreLocal() MagicLinkStore {
+	return &MagicLinkStoreLocal{links: make(map[string]*models.MagicLink)}
+}
+
+// Create store a new magic link, an ID is generated if one isn't supplied
+func (mls *MagicLinkStoreLocal) Create(link *models.MagicLink) (*models.MagicLink, error) {
+	mls.Lock()
+	defer mls.Unlock()
+
+	if link.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		link.ID = models.String(id)
+	}
+
+	mls.links[models.StringValue(link.ID)] = link
+
+	return link, nil
+}
+
+// Consume remove and return the magic link
+func (mls *MagicLinkStoreLocal) Consume(linkID string) (*models.MagicLink, error) {
+	mls.Lock()
+	defer mls.Unlock()
+
+	link, ok := mls.links[linkID]
+	if !ok {
+		return nil, ErrMagicLinkNotFound
+	}
+
+	delete(mls.links, linkID)
+
+	return link, nil
+}
+
+// PurgeExpired remove the magic links which expired before the time
+func (mls *MagicLinkStoreLocal) PurgeExpired(expiredBefore time.Time) (int, error) {
+	mls.Lock()
+	defer mls.Unlock()
+
+	n := 0
+
+	for id, link := range mls.links {
+		if link.ExpiresAt.Before(expiredBefore) {
+			delete(mls.links, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,21 @@
+package magiclinks
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var (
+	ErrMagicLinkNotFound = errors.New("Magic link not found.")
+)
+
+// MagicLinkStore magic link store interface
+type MagicLinkStore interface {
+	Create(link *models.MagicLink) (*models.MagicLink, error)
+	// Consume atomically removes the link so it can only be used once
+	Consume(linkID string) (*models.MagicLink, error)
+	// PurgeExpired removes the links which expired before the time and returns how many
+	PurgeExpired(expiredBefore time.Time) (int, error)
+}
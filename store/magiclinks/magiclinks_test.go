@@ -0,0 +1,99 @@
+package magiclinks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/pgtest"
+	"github.com/wolfeidau/authinator/store/users/storetest"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+func TestMagicLinkStore(t *testing.T) {
+	storetest.RunBackends(t, func(t *testing.T, b *storetest.Backend) {
+		testMagicLinkStore(t, newMagicLinkStore(t, b))
+	})
+}
+
+// newMagicLinkStore create the magic link store for the backend
+func newMagicLinkStore(t *testing.T, b *storetest.Backend) MagicLinkStore {
+	switch {
+	case b.Bolt != nil:
+		return NewMagicLinkStoreBolt(b.Bolt)
+	case b.Postgres != nil:
+		return NewMagicLinkStorePostgres(b.Postgres)
+	case b.RethinkDB != nil:
+		storetest.RethinkDBTable(t, b.RethinkDB, TableName, ExpiresAtIndex)
+		return NewMagicLinkStoreRethinkDB(b.RethinkDB)
+	}
+
+	return NewMagicLinkStoreLocal()
+}
+
+func testMagicLinkStore(t *testing.T, store MagicLinkStore) {
+
+	expires := time.Now().UTC().Add(15 * time.Minute).Truncate(time.Millisecond)
+
+	link, err := store.Create(&models.MagicLink{UserID: models.String("123"), ExpiresAt: expires})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		consumed []*models.MagicLink
+	)
+
+	// only one of the concurrent callers can consume the link
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			l, err := store.Consume(models.StringValue(link.ID))
+			if err == nil {
+				mu.Lock()
+				consumed = append(consumed, l)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if assert.Len(t, consumed, 1) {
+		assert.Equal(t, "123", models.StringValue(consumed[0].UserID))
+		assert.True(t, expires.Equal(consumed[0].ExpiresAt))
+	}
+
+	_, err = store.Consume(models.StringValue(link.ID))
+	assert.Equal(t, ErrMagicLinkNotFound, err)
+
+	expired, err := store.Create(&models.MagicLink{UserID: models.String("123"), ExpiresAt: time.Now().UTC().Add(-time.Minute)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	link, err = store.Create(&models.MagicLink{UserID: models.String("123"), ExpiresAt: expires})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	n, err := store.PurgeExpired(time.Now())
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, n)
+	}
+
+	_, err = store.Consume(models.StringValue(expired.ID))
+	assert.Equal(t, ErrMagicLinkNotFound, err)
+
+	_, err = store.Consume(models.StringValue(link.ID))
+	assert.NoError(t, err)
+}
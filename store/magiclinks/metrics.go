@@ -0,0 +1,37 @@
+package magiclinks
+
+import (
+	"time"
+
+	"github.com/wolfeidau/authinator/metrics"
+	"github.com/wolfeidau/authinator/models"
+)
+
+type magicLinkStoreMetrics struct {
+	store MagicLinkStore
+}
+
+// NewMagicLinkStoreMetrics create a magic link store which records the latency and result
+// of each operation on the store
+func NewMagicLinkStoreMetrics(store MagicLinkStore) MagicLinkStore {
+	return &magicLinkStoreMetrics{store}
+}
+
+func observeOperation(operation string, start time.Time, err error) {
+	metrics.ObserveStoreOperation("magic_links", operation, start, err, ErrMagicLinkNotFound)
+}
+
+func (lm *magicLinkStoreMetrics) Create(link *models.MagicLink) (l *models.MagicLink, err error) {
+	defer func(start time.Time) { observeOperation("create", start, err) }(time.Now())
+	return lm.store.Create(link)
+}
+
+func (lm *magicLinkStoreMetrics) Consume(linkID string) (l *models.MagicLink, err error) {
+	defer func(start time.Time) { observeOperation("consume", start, err) }(time.Now())
+	return lm.store.Consume(linkID)
+}
+
+func (lm *magicLinkStoreMetrics) PurgeExpired(expiredBefore time.Time) (n int, err error) {
+	defer func(start time.Time) { observeOperation("purge_expired", start, err) }(time.Now())
+	return lm.store.PurgeExpired(expiredBefore)
+}
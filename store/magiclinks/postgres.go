@@ -0,0 +1,71 @@
+package magiclinks
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ MagicLinkStore = &MagicLinkStorePostgres{}
+
+// MagicLinkStorePostgres PostgreSQL based magic link store
+type MagicLinkStorePostgres struct {
+	db *sql.DB
+}
+
+// NewMagicLinkStorePostgres create a new PostgreSQL backed magic link store, the table is
+// created by the users.PostgresMigrations.
+func NewMagicLinkStorePostgres(db *sql.DB) MagicLinkStore {
+	return &MagicLinkStorePostgres{db}
+}
+
+// Create create the magic link in PostgreSQL, an ID is generated if one isn't supplied
+func (ms *MagicLinkStorePostgres) Create(link *models.MagicLink) (*models.MagicLink, error) {
+
+	if link.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		link.ID = models.String(id)
+	}
+
+	_, err := ms.db.Exec("INSERT INTO magic_links (id, user_id, expires_at) VALUES ($1, $2, $3)", link.ID, link.UserID, link.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// Consume delete the magic link from PostgreSQL returning the deleted row, as the delete
+// is a single statement only one caller can consume a link.
+func (ms *MagicLinkStorePostgres) Consume(linkID string) (*models.MagicLink, error) {
+
+	link := new(models.MagicLink)
+
+	err := ms.db.QueryRow("DELETE FROM magic_links WHERE id = $1 RETURNING id, user_id, expires_at", linkID).
+		Scan(&link.ID, &link.UserID, &link.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMagicLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// PurgeExpired delete the magic links which expired before the time from PostgreSQL
+func (ms *MagicLinkStorePostgres) PurgeExpired(expiredBefore time.Time) (int, error) {
+
+	res, err := ms.db.Exec("DELETE FROM magic_links WHERE expires_at < $1", expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return int(n), err
+}
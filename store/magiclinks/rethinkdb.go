@@ -0,0 +1,82 @@
+package magiclinks
+
+import (
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/dancannon/gorethink/encoding"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+var _ MagicLinkStore = &MagicLinkStoreRethinkDB{}
+
+var (
+	// TableName is the name of magic links table in the RethinkDB database
+	TableName = "magic_links"
+	// ExpiresAtIndex is the name of the secondary index on expires_at used to purge expired links
+	ExpiresAtIndex = "expires_at"
+)
+
+// MagicLinkStoreRethinkDB RethinkDB based magic link store
+type MagicLinkStoreRethinkDB struct {
+	session *r.Session
+}
+
+// NewMagicLinkStoreRethinkDB create a new RethinkDB backed magic link store
+func NewMagicLinkStoreRethinkDB(session *r.Session) MagicLinkStore {
+	return &MagicLinkStoreRethinkDB{session}
+}
+
+// Create create the magic link in RethinkDB
+func (ms *MagicLinkStoreRethinkDB) Create(link *models.MagicLink) (*models.MagicLink, error) {
+
+	resp, err := r.DB(users.DBName).Table(TableName).Insert(link).RunWrite(ms.session)
+	if err != nil {
+		return nil, err
+	}
+
+	if link.ID == nil {
+		link.ID = models.String(resp.GeneratedKeys[0])
+	}
+
+	return link, nil
+}
+
+// Consume delete the magic link from RethinkDB returning the old value, as the delete
+// is a single atomic operation only one caller can consume a link.
+func (ms *MagicLinkStoreRethinkDB) Consume(linkID string) (*models.MagicLink, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).Get(linkID).Delete(r.DeleteOpts{
+		ReturnChanges: true,
+	}).RunWrite(ms.session)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Deleted != 1 || len(res.Changes) != 1 {
+		return nil, ErrMagicLinkNotFound
+	}
+
+	link := new(models.MagicLink)
+
+	err = encoding.Decode(link, res.Changes[0].OldValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// PurgeExpired delete the magic links which expired before the time from RethinkDB
+func (ms *MagicLinkStoreRethinkDB) PurgeExpired(expiredBefore time.Time) (int, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).Between(r.MinVal, expiredBefore, r.BetweenOpts{
+		Index: ExpiresAtIndex,
+	}).Delete().RunWrite(ms.session)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Deleted, nil
+}
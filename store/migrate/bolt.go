@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ Recorder = &BoltRecorder{}
+
+// BoltRecorder records applied migrations in a bolt bucket keyed by version
+type BoltRecorder struct {
+	db *bolt.DB
+}
+
+// NewBoltRecorder create a new bolt migration recorder
+func NewBoltRecorder(db *bolt.DB) Recorder {
+	return &BoltRecorder{db}
+}
+
+// Init create the schema_migrations bucket if it doesn't exist
+func (br *BoltRecorder) Init(ctx context.Context) error {
+	return br.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(TableName))
+		return err
+	})
+}
+
+// Applied list the applied versions and when they were applied
+func (br *BoltRecorder) Applied(ctx context.Context) (map[int]time.Time, error) {
+
+	applied := make(map[int]time.Time)
+
+	err := br.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(TableName)).ForEach(func(k, v []byte) error {
+			var at time.Time
+
+			err := at.UnmarshalText(v)
+			if err != nil {
+				return err
+			}
+
+			applied[int(binary.BigEndian.Uint64(k))] = at
+			return nil
+		})
+	})
+
+	return applied, err
+}
+
+// Record mark the version as applied
+func (br *BoltRecorder) Record(ctx context.Context, version int, at time.Time) error {
+
+	buf, err := at.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	return br.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(TableName)).Put(boltVersion(version), buf)
+	})
+}
+
+// Remove mark the version as not applied
+func (br *BoltRecorder) Remove(ctx context.Context, version int) error {
+	return br.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(TableName)).Delete(boltVersion(version))
+	})
+}
+
+// BoltBucketStep a step which creates buckets, it is reverted by deleting them.
+func BoltBucketStep(db *bolt.DB, version int, description string, buckets ...[]byte) Step {
+	return Step{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context) error {
+			return db.Update(func(tx *bolt.Tx) error {
+				for _, name := range buckets {
+					if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+		Down: func(ctx context.Context) error {
+			return db.Update(func(tx *bolt.Tx) error {
+				for _, name := range buckets {
+					if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	}
+}
+
+func boltVersion(version int) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(version))
+	return buf
+}
@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltMigrations(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "authinator")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	db, err := bolt.Open(filepath.Join(dir, "authinator.db"), 0600, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer db.Close()
+
+	m, err := NewMigrator(NewBoltRecorder(db), []Step{BoltBucketStep(db, 1, "test bucket", []byte("test"))})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	applied, err := m.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+
+	status, err := m.Status(context.Background())
+	if assert.NoError(t, err) && assert.Len(t, status, 1) {
+		assert.NotNil(t, status[0].AppliedAt)
+	}
+
+	db.View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket([]byte("test")))
+		return nil
+	})
+
+	reverted, err := m.Down(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+
+	db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("test")))
+		return nil
+	})
+}
@@ -0,0 +1,181 @@
+// Package migrate applies versioned schema changes to the store backends, the
+// versions applied to a backend are recorded in its schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrIrreversible = errors.New("Migration can't be reverted.")
+)
+
+// TableName is the name of the table recording applied migrations
+var TableName = "schema_migrations"
+
+// Step a versioned schema change, index creation or data backfill. Up and Down must be
+// idempotent so a step which was applied but not recorded can safely be run again.
+type Step struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context) error
+	// Down reverts the step, steps without one can't be reverted
+	Down func(ctx context.Context) error
+}
+
+// Status the state of a step in a backend
+type Status struct {
+	Version     int
+	Description string
+	AppliedAt   *time.Time
+}
+
+// Recorder records which steps have been applied to a backend
+type Recorder interface {
+	// Init create the schema_migrations table if it doesn't exist
+	Init(ctx context.Context) error
+	Applied(ctx context.Context) (map[int]time.Time, error)
+	Record(ctx context.Context, version int, at time.Time) error
+	Remove(ctx context.Context, version int) error
+}
+
+// Migrator applies and reverts the registered steps in version order
+type Migrator struct {
+	recorder Recorder
+	steps    []Step
+}
+
+// NewMigrator create a new migrator, versions must be positive and unique.
+func NewMigrator(recorder Recorder, steps []Step) (*Migrator, error) {
+
+	sorted := make([]Step, len(steps))
+	copy(sorted, steps)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i, step := range sorted {
+		if step.Version < 1 {
+			return nil, fmt.Errorf("migration %q has an invalid version %d", step.Description, step.Version)
+		}
+
+		if i > 0 && sorted[i-1].Version == step.Version {
+			return nil, fmt.Errorf("migration version %d is registered more than once", step.Version)
+		}
+
+		if step.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up step", step.Version)
+		}
+	}
+
+	return &Migrator{recorder, sorted}, nil
+}
+
+// Up apply every step which hasn't been recorded, in version order.
+func (m *Migrator) Up(ctx context.Context) ([]Step, error) {
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Step
+
+	for _, step := range m.steps {
+		if _, ok := applied[step.Version]; ok {
+			continue
+		}
+
+		err = step.Up(ctx)
+		if err != nil {
+			return done, fmt.Errorf("migration %d failed: %v", step.Version, err)
+		}
+
+		err = m.recorder.Record(ctx, step.Version, time.Now())
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, step)
+	}
+
+	return done, nil
+}
+
+// Down revert every applied step with a version greater than to, in reverse version order.
+func (m *Migrator) Down(ctx context.Context, to int) ([]Step, error) {
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Step
+
+	for i := len(m.steps) - 1; i >= 0; i-- {
+		step := m.steps[i]
+
+		if step.Version <= to {
+			break
+		}
+
+		if _, ok := applied[step.Version]; !ok {
+			continue
+		}
+
+		if step.Down == nil {
+			return done, fmt.Errorf("migration %d: %v", step.Version, ErrIrreversible)
+		}
+
+		err = step.Down(ctx)
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %d failed: %v", step.Version, err)
+		}
+
+		err = m.recorder.Remove(ctx, step.Version)
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, step)
+	}
+
+	return done, nil
+}
+
+// Status list every registered step and when it was applied, if it has been.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, len(m.steps))
+
+	for i, step := range m.steps {
+		status[i] = Status{Version: step.Version, Description: step.Description}
+
+		if at, ok := applied[step.Version]; ok {
+			at := at
+			status[i].AppliedAt = &at
+		}
+	}
+
+	return status, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+
+	err := m.recorder.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.recorder.Applied(ctx)
+}
@@ -0,0 +1,153 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryRecorder struct {
+	applied map[int]time.Time
+}
+
+func (mr *memoryRecorder) Init(ctx context.Context) error {
+	if mr.applied == nil {
+		mr.applied = make(map[int]time.Time)
+	}
+	return nil
+}
+
+func (mr *memoryRecorder) Applied(ctx context.Context) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	for k, v := range mr.applied {
+		applied[k] = v
+	}
+	return applied, nil
+}
+
+func (mr *memoryRecorder) Record(ctx context.Context, version int, at time.Time) error {
+	mr.applied[version] = at
+	return nil
+}
+
+func (mr *memoryRecorder) Remove(ctx context.Context, version int) error {
+	delete(mr.applied, version)
+	return nil
+}
+
+func testSteps(log *[]string) []Step {
+	step := func(version int, name string) Step {
+		return Step{
+			Version:     version,
+			Description: name,
+			Up: func(ctx context.Context) error {
+				*log = append(*log, "up "+name)
+				return nil
+			},
+			Down: func(ctx context.Context) error {
+				*log = append(*log, "down "+name)
+				return nil
+			},
+		}
+	}
+
+	// registered out of order to check they are sorted by version
+	return []Step{step(2, "two"), step(1, "one"), step(3, "three")}
+}
+
+func TestMigratorUpAndDown(t *testing.T) {
+
+	var log []string
+
+	m, err := NewMigrator(&memoryRecorder{}, testSteps(&log))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	applied, err := m.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, 3)
+	assert.Equal(t, []string{"up one", "up two", "up three"}, log)
+
+	// applying again is a no-op
+	applied, err = m.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, applied, 0)
+
+	reverted, err := m.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 2)
+	assert.Equal(t, []string{"up one", "up two", "up three", "down three", "down two"}, log)
+
+	status, err := m.Status(context.Background())
+	if assert.NoError(t, err) && assert.Len(t, status, 3) {
+		assert.Equal(t, 1, status[0].Version)
+		assert.NotNil(t, status[0].AppliedAt)
+		assert.Nil(t, status[1].AppliedAt)
+		assert.Nil(t, status[2].AppliedAt)
+	}
+}
+
+func TestMigratorStopsOnError(t *testing.T) {
+
+	var log []string
+
+	steps := testSteps(&log)
+	steps[0].Up = func(ctx context.Context) error {
+		return errors.New("boom")
+	}
+
+	m, err := NewMigrator(&memoryRecorder{}, steps)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	applied, err := m.Up(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, applied, 1)
+
+	status, err := m.Status(context.Background())
+	if assert.NoError(t, err) {
+		assert.NotNil(t, status[0].AppliedAt)
+		assert.Nil(t, status[1].AppliedAt)
+	}
+}
+
+func TestMigratorIrreversible(t *testing.T) {
+
+	var log []string
+
+	steps := testSteps(&log)
+	steps[2].Down = nil
+
+	m, err := NewMigrator(&memoryRecorder{}, steps)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = m.Up(context.Background())
+	assert.NoError(t, err)
+
+	reverted, err := m.Down(context.Background(), 0)
+	assert.Error(t, err)
+	assert.Len(t, reverted, 0)
+}
+
+func TestNewMigratorValidatesVersions(t *testing.T) {
+
+	var log []string
+
+	steps := testSteps(&log)
+	steps[1].Version = 2
+
+	_, err := NewMigrator(&memoryRecorder{}, steps)
+	assert.Error(t, err)
+
+	steps[1].Version = 0
+
+	_, err = NewMigrator(&memoryRecorder{}, steps)
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+var _ Recorder = &PostgresRecorder{}
+
+// PostgresRecorder records applied migrations in a PostgreSQL table
+type PostgresRecorder struct {
+	db *sql.DB
+}
+
+// NewPostgresRecorder create a new PostgreSQL migration recorder
+func NewPostgresRecorder(db *sql.DB) Recorder {
+	return &PostgresRecorder{db}
+}
+
+// Init create the schema_migrations table if it doesn't exist
+func (pr *PostgresRecorder) Init(ctx context.Context) error {
+	_, err := pr.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+TableName+` (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+// Applied list the applied versions and when they were applied
+func (pr *PostgresRecorder) Applied(ctx context.Context) (map[int]time.Time, error) {
+
+	rows, err := pr.db.QueryContext(ctx, "SELECT version, applied_at FROM "+TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+
+		err = rows.Scan(&version, &at)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// Record mark the version as applied
+func (pr *PostgresRecorder) Record(ctx context.Context, version int, at time.Time) error {
+	_, err := pr.db.ExecContext(ctx, "INSERT INTO "+TableName+" (version, applied_at) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING", version, at)
+	return err
+}
+
+// Remove mark the version as not applied
+func (pr *PostgresRecorder) Remove(ctx context.Context, version int) error {
+	_, err := pr.db.ExecContext(ctx, "DELETE FROM "+TableName+" WHERE version = $1", version)
+	return err
+}
+
+// PostgresStep a step which runs SQL statements in a transaction, the statements should
+// use IF NOT EXISTS and IF EXISTS so they can be run again. An empty down statement
+// makes the step irreversible.
+func PostgresStep(db *sql.DB, version int, description, up, down string) Step {
+
+	step := Step{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context) error {
+			return execPostgres(ctx, db, up)
+		},
+	}
+
+	if down != "" {
+		step.Down = func(ctx context.Context) error {
+			return execPostgres(ctx, db, down)
+		}
+	}
+
+	return step
+}
+
+func execPostgres(ctx context.Context, db *sql.DB, statements string) error {
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, statements)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,154 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+)
+
+var _ Recorder = &RethinkDBRecorder{}
+
+// RethinkDBRecorder records applied migrations in a RethinkDB table
+type RethinkDBRecorder struct {
+	session *r.Session
+	dbName  string
+}
+
+// NewRethinkDBRecorder create a new RethinkDB migration recorder for the database,
+// the database is created if it doesn't exist.
+func NewRethinkDBRecorder(session *r.Session, dbName string) Recorder {
+	return &RethinkDBRecorder{session, dbName}
+}
+
+type rethinkDBMigration struct {
+	Version   int       `gorethink:"id"`
+	AppliedAt time.Time `gorethink:"applied_at"`
+}
+
+// Init create the database and schema_migrations table if they don't exist
+func (rr *RethinkDBRecorder) Init(ctx context.Context) error {
+
+	err := ensureRethinkDB(ctx, rr.session, r.DBList(), rr.dbName, r.DBCreate(rr.dbName))
+	if err != nil {
+		return err
+	}
+
+	return ensureRethinkDB(ctx, rr.session, r.DB(rr.dbName).TableList(), TableName, r.DB(rr.dbName).TableCreate(TableName))
+}
+
+// Applied list the applied versions and when they were applied
+func (rr *RethinkDBRecorder) Applied(ctx context.Context) (map[int]time.Time, error) {
+
+	res, err := r.DB(rr.dbName).Table(TableName).Run(rr.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	var migrations []rethinkDBMigration
+
+	err = res.All(&migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]time.Time)
+
+	for _, m := range migrations {
+		applied[m.Version] = m.AppliedAt
+	}
+
+	return applied, nil
+}
+
+// Record mark the version as applied
+func (rr *RethinkDBRecorder) Record(ctx context.Context, version int, at time.Time) error {
+	return r.DB(rr.dbName).Table(TableName).Insert(rethinkDBMigration{version, at}, r.InsertOpts{
+		Conflict: "replace",
+	}).Exec(rr.session, r.ExecOpts{Context: ctx})
+}
+
+// Remove mark the version as not applied
+func (rr *RethinkDBRecorder) Remove(ctx context.Context, version int) error {
+	return r.DB(rr.dbName).Table(TableName).Get(version).Delete().Exec(rr.session, r.ExecOpts{Context: ctx})
+}
+
+// RethinkDBTableStep a step which creates a table and its secondary indexes, it is
+// reverted by dropping the table.
+func RethinkDBTableStep(session *r.Session, dbName string, version int, description, table string, indexes ...string) Step {
+	return Step{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context) error {
+
+			err := ensureRethinkDB(ctx, session, r.DB(dbName).TableList(), table, r.DB(dbName).TableCreate(table))
+			if err != nil {
+				return err
+			}
+
+			for _, index := range indexes {
+				err = ensureRethinkDB(ctx, session, r.DB(dbName).Table(table).IndexList(), index, r.DB(dbName).Table(table).IndexCreate(index))
+				if err != nil {
+					return err
+				}
+			}
+
+			return r.DB(dbName).Table(table).IndexWait().Exec(session, r.ExecOpts{Context: ctx})
+		},
+		Down: func(ctx context.Context) error {
+
+			var exists bool
+
+			err := r.DB(dbName).TableList().Contains(table).ReadOne(&exists, session, r.RunOpts{Context: ctx})
+			if err != nil || !exists {
+				return err
+			}
+
+			return r.DB(dbName).TableDrop(table).Exec(session, r.ExecOpts{Context: ctx})
+		},
+	}
+}
+
+// RethinkDBIndexStep a step which adds a secondary index to an existing table, it is
+// reverted by dropping the index.
+func RethinkDBIndexStep(session *r.Session, dbName string, version int, description, table, index string) Step {
+	return Step{
+		Version:     version,
+		Description: description,
+		Up: func(ctx context.Context) error {
+
+			err := ensureRethinkDB(ctx, session, r.DB(dbName).Table(table).IndexList(), index, r.DB(dbName).Table(table).IndexCreate(index))
+			if err != nil {
+				return err
+			}
+
+			return r.DB(dbName).Table(table).IndexWait(index).Exec(session, r.ExecOpts{Context: ctx})
+		},
+		Down: func(ctx context.Context) error {
+
+			var exists bool
+
+			err := r.DB(dbName).Table(table).IndexList().Contains(index).ReadOne(&exists, session, r.RunOpts{Context: ctx})
+			if err != nil || !exists {
+				return err
+			}
+
+			return r.DB(dbName).Table(table).IndexDrop(index).Exec(session, r.ExecOpts{Context: ctx})
+		},
+	}
+}
+
+// ensureRethinkDB run create unless name is already in the list
+func ensureRethinkDB(ctx context.Context, session *r.Session, list r.Term, name string, create r.Term) error {
+
+	var exists bool
+
+	err := list.Contains(name).ReadOne(&exists, session, r.RunOpts{Context: ctx})
+	if err != nil || exists {
+		return err
+	}
+
+	return create.Exec(session, r.ExecOpts{Context: ctx})
+}
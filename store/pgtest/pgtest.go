@@ -0,0 +1,152 @@
+// Package pgtest launches a throwaway PostgreSQL server for the store tests, so they run
+// against a real database without any setup. The server is started on first use with the
+// initdb and pg_ctl of the local PostgreSQL installation and listens only on a unix socket
+// in a temporary directory. The tests are skipped when PostgreSQL isn't installed.
+//
+// Set AUTHINATOR_POSTGRES_URL to use an existing database instead, for example
+// postgres://localhost/authinator_test?sslmode=disable. Every table in its public schema is
+// dropped by each test, so run the packages one at a time with go test -p 1.
+package pgtest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+var (
+	// errNotInstalled returned when initdb and pg_ctl can't be found
+	errNotInstalled = errors.New("PostgreSQL isn't installed, install it or set AUTHINATOR_POSTGRES_URL")
+)
+
+var (
+	once     sync.Once
+	dsn      string
+	stop     func()
+	startErr error
+)
+
+// Open connect to an empty database on the test server, starting it if this is the first
+// use. The test is skipped if PostgreSQL isn't installed and AUTHINATOR_POSTGRES_URL isn't
+// set, and fails if the server can't be started.
+func Open(t *testing.T) *sql.DB {
+
+	once.Do(func() {
+		dsn, stop, startErr = start()
+	})
+
+	if startErr == errNotInstalled {
+		t.Skipf("skipping postgres tests: %v", startErr)
+	}
+
+	if startErr != nil {
+		t.Fatalf("error starting postgres %v", startErr)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("error opening postgres %v", err)
+	}
+
+	_, err = db.Exec("DROP SCHEMA IF EXISTS public CASCADE; CREATE SCHEMA public")
+	if err != nil {
+		db.Close()
+		t.Fatalf("error resetting postgres %v", err)
+	}
+
+	return db
+}
+
+// Main run the tests and stop the server if one was started, call it from TestMain in the
+// packages which use Open.
+func Main(m *testing.M) {
+	code := m.Run()
+
+	if stop != nil {
+		stop()
+	}
+
+	os.Exit(code)
+}
+
+// start launch a server in a temporary directory and return its DSN and a function to
+// stop it and remove the directory
+func start() (string, func(), error) {
+
+	if url := os.Getenv("AUTHINATOR_POSTGRES_URL"); url != "" {
+		return url, func() {}, nil
+	}
+
+	bin, err := binDir()
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "pgtest")
+	if err != nil {
+		return "", nil, err
+	}
+
+	data := filepath.Join(dir, "data")
+	pgCtl := filepath.Join(bin, "pg_ctl")
+
+	out, err := exec.Command(filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb failed: %s: %s", err, out)
+	}
+
+	// only listen on a unix socket in the directory, with fsync off as the data is thrown away
+	out, err = exec.Command(pgCtl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-w",
+		"-o", fmt.Sprintf("-k %s -c listen_addresses='' -F", dir), "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start failed: %s: %s", err, out)
+	}
+
+	stop := func() {
+		exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+
+	return fmt.Sprintf("host=%s user=postgres dbname=postgres sslmode=disable", dir), stop, nil
+}
+
+// binDir find the directory holding initdb and pg_ctl, which often aren't on the PATH
+func binDir() (string, error) {
+
+	if path, err := exec.LookPath("pg_ctl"); err == nil {
+		return filepath.Dir(path), nil
+	}
+
+	// pg_config is also installed with the client libraries, without the server
+	if out, err := exec.Command("pg_config", "--bindir").Output(); err == nil {
+		dir := strings.TrimSpace(string(out))
+		if _, err := os.Stat(filepath.Join(dir, "pg_ctl")); err == nil {
+			return dir, nil
+		}
+	}
+
+	for _, pattern := range []string{
+		"/usr/lib/postgresql/*/bin/pg_ctl",
+		"/usr/pgsql-*/bin/pg_ctl",
+		"/usr/local/opt/postgresql*/bin/pg_ctl",
+		"/opt/homebrew/opt/postgresql*/bin/pg_ctl",
+	} {
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) != 0 {
+			return filepath.Dir(matches[len(matches)-1]), nil
+		}
+	}
+
+	return "", errNotInstalled
+}
@@ -0,0 +1,145 @@
+package sessions
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ SessionStore = &SessionStoreBolt{}
+
+// SessionStoreBolt bolt based session store, the sessions are kept in the same file
+// as the users.
+type SessionStoreBolt struct {
+	db *bolt.DB
+}
+
+// NewSessionStoreBolt create a new bolt backed session store, the database should be
+// opened with users.OpenBolt.
+func NewSessionStoreBolt(db *bolt.DB) SessionStore {
+	return &SessionStoreBolt{db}
+}
+
+// Create store a new session in bolt, an ID is generated if one isn't supplied
+func (ss *SessionStoreBolt) Create(session *models.Session) (*models.Session, error) {
+
+	if session.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		session.ID = models.String(id)
+	}
+
+	err := ss.db.Update(func(tx *bolt.Tx) error {
+		return putBoltSession(tx, session)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetByID retrieve a session from bolt
+func (ss *SessionStoreBolt) GetByID(sessionID string) (*models.Session, error) {
+	var session *models.Session
+
+	err := ss.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = getBoltSession(tx, sessionID)
+		return err
+	})
+
+	return session, err
+}
+
+// ListByUser list the sessions for a user, most recently seen first
+func (ss *SessionStoreBolt) ListByUser(userID string) ([]*models.Session, error) {
+	list := []*models.Session{}
+
+	err := ss.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(users.BoltSessionsBucket).ForEach(func(k, v []byte) error {
+			session := new(models.Session)
+
+			err := json.Unmarshal(v, session)
+			if err != nil {
+				return err
+			}
+
+			if models.StringValue(session.UserID) == userID {
+				list = append(list, session)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeenAt.After(list[j].LastSeenAt)
+	})
+
+	return list, nil
+}
+
+// Touch update the last seen time of the session in bolt
+func (ss *SessionStoreBolt) Touch(sessionID string, lastSeen time.Time) error {
+	return ss.db.Update(func(tx *bolt.Tx) error {
+		session, err := getBoltSession(tx, sessionID)
+		if err != nil {
+			return err
+		}
+
+		session.LastSeenAt = lastSeen
+
+		return putBoltSession(tx, session)
+	})
+}
+
+// Delete delete the session from bolt
+func (ss *SessionStoreBolt) Delete(sessionID string) error {
+	return ss.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(users.BoltSessionsBucket)
+
+		if b.Get([]byte(sessionID)) == nil {
+			return ErrSessionNotFound
+		}
+
+		return b.Delete([]byte(sessionID))
+	})
+}
+
+func getBoltSession(tx *bolt.Tx, sessionID string) (*models.Session, error) {
+	buf := tx.Bucket(users.BoltSessionsBucket).Get([]byte(sessionID))
+	if buf == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	session := new(models.Session)
+
+	err := json.Unmarshal(buf, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func putBoltSession(tx *bolt.Tx, session *models.Session) error {
+	stored := *session
+	stored.Current = false
+
+	buf, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(users.BoltSessionsBucket).Put([]byte(models.StringValue(session.ID)), buf)
+}
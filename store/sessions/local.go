@@ -0,0 +1,118 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ SessionStore = &SessionStoreLocal{}
+
+// SessionStoreLocal local session store for testing purposes
+type SessionStoreLocal struct {
+	sync.RWMutex
+	sessions map[string]models.Session
+}
+
+// NewSessionStoreLocal create a new local session store
+func NewSessionStoreLocal() SessionStore {
+	return &SessionStoreLocal{sessions: make(map[string]models.Session)}
+}
+
+// Create store a new session, an ID is generated if one isn't supplied
+func (ssl *SessionStoreLocal) Create(session *models.Session) (*models.Session, error) {
+	ssl.Lock()
+	defer ssl.Unlock()
+
+	if session.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		session.ID = models.String(id)
+	}
+
+	ssl.sessions[models.StringValue(session.ID)] = *session
+
+	return session, nil
+}
+
+// GetByID lookup a session by its identifier
+func (ssl *SessionStoreLocal) GetByID(sessionID string) (*models.Session, error) {
+	ssl.RLock()
+	defer ssl.RUnlock()
+
+	session, ok := ssl.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	return &session, nil
+}
+
+// ListByUser list the sessions for a user, most recently seen first
+func (ssl *SessionStoreLocal) ListByUser(userID string) ([]*models.Session, error) {
+	ssl.RLock()
+	defer ssl.RUnlock()
+
+	list := []*models.Session{}
+
+	for _, v := range ssl.sessions {
+		if models.StringValue(v.UserID) == userID {
+			session := v
+			list = append(list, &session)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeenAt.After(list[j].LastSeenAt)
+	})
+
+	return list, nil
+}
+
+// Touch update the last seen time of the session
+func (ssl *SessionStoreLocal) Touch(sessionID string, lastSeen time.Time) error {
+	ssl.Lock()
+	defer ssl.Unlock()
+
+	session, ok := ssl.sessions[sessionID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	session.LastSeenAt = lastSeen
+
+	ssl.sessions[sessionID] = session
+
+	return nil
+}
+
+// Delete revoke the session by session ID
+func (ssl *SessionStoreLocal) Delete(sessionID string) error {
+	ssl.Lock()
+	defer ssl.Unlock()
+
+	if _, ok := ssl.sessions[sessionID]; !ok {
+		return ErrSessionNotFound
+	}
+
+	delete(ssl.sessions, sessionID)
+
+	return nil
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
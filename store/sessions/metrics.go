@@ -0,0 +1,47 @@
+package sessions
+
+import (
+	"time"
+
+	"github.com/wolfeidau/authinator/metrics"
+	"github.com/wolfeidau/authinator/models"
+)
+
+type sessionStoreMetrics struct {
+	store SessionStore
+}
+
+// NewSessionStoreMetrics create a session store which records the latency and result of
+// each operation on the store
+func NewSessionStoreMetrics(store SessionStore) SessionStore {
+	return &sessionStoreMetrics{store}
+}
+
+func observeOperation(operation string, start time.Time, err error) {
+	metrics.ObserveStoreOperation("sessions", operation, start, err, ErrSessionNotFound)
+}
+
+func (sm *sessionStoreMetrics) Create(session *models.Session) (s *models.Session, err error) {
+	defer func(start time.Time) { observeOperation("create", start, err) }(time.Now())
+	return sm.store.Create(session)
+}
+
+func (sm *sessionStoreMetrics) GetByID(sessionID string) (s *models.Session, err error) {
+	defer func(start time.Time) { observeOperation("get_by_id", start, err) }(time.Now())
+	return sm.store.GetByID(sessionID)
+}
+
+func (sm *sessionStoreMetrics) ListByUser(userID string) (list []*models.Session, err error) {
+	defer func(start time.Time) { observeOperation("list_by_user", start, err) }(time.Now())
+	return sm.store.ListByUser(userID)
+}
+
+func (sm *sessionStoreMetrics) Touch(sessionID string, lastSeen time.Time) (err error) {
+	defer func(start time.Time) { observeOperation("touch", start, err) }(time.Now())
+	return sm.store.Touch(sessionID, lastSeen)
+}
+
+func (sm *sessionStoreMetrics) Delete(sessionID string) (err error) {
+	defer func(start time.Time) { observeOperation("delete", start, err) }(time.Now())
+	return sm.store.Delete(sessionID)
+}
@@ -0,0 +1,129 @@
+package sessions
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ SessionStore = &SessionStorePostgres{}
+
+const sessionColumns = "id, user_id, created_at, last_seen_at, ip, user_agent"
+
+// SessionStorePostgres PostgreSQL based session store
+type SessionStorePostgres struct {
+	db *sql.DB
+}
+
+// NewSessionStorePostgres create a new PostgreSQL backed session store, the table is
+// created by the users.PostgresMigrations.
+func NewSessionStorePostgres(db *sql.DB) SessionStore {
+	return &SessionStorePostgres{db}
+}
+
+// Create create the session in PostgreSQL, an ID is generated if one isn't supplied
+func (ss *SessionStorePostgres) Create(session *models.Session) (*models.Session, error) {
+
+	if session.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		session.ID = models.String(id)
+	}
+
+	_, err := ss.db.Exec("INSERT INTO sessions ("+sessionColumns+") VALUES ($1, $2, $3, $4, $5, $6)",
+		session.ID, session.UserID, session.CreatedAt, session.LastSeenAt, session.IP, session.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetByID retrieve a session from PostgreSQL
+func (ss *SessionStorePostgres) GetByID(sessionID string) (*models.Session, error) {
+
+	session, err := scanSession(ss.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = $1", sessionID))
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+
+	return session, err
+}
+
+// ListByUser list the sessions for a user, most recently seen first
+func (ss *SessionStorePostgres) ListByUser(userID string) ([]*models.Session, error) {
+
+	rows, err := ss.db.Query("SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 ORDER BY last_seen_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*models.Session{}
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, session)
+	}
+
+	return list, rows.Err()
+}
+
+// Touch update the last seen time of the session in PostgreSQL
+func (ss *SessionStorePostgres) Touch(sessionID string, lastSeen time.Time) error {
+
+	res, err := ss.db.Exec("UPDATE sessions SET last_seen_at = $2 WHERE id = $1", sessionID, lastSeen)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Delete delete the session from the PostgreSQL database.
+func (ss *SessionStorePostgres) Delete(sessionID string) error {
+
+	res, err := ss.db.Exec("DELETE FROM sessions WHERE id = $1", sessionID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// scanner is implemented by sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row scanner) (*models.Session, error) {
+	session := new(models.Session)
+
+	err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.LastSeenAt, &session.IP, &session.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func checkRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
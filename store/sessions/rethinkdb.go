@@ -0,0 +1,119 @@
+package sessions
+
+import (
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+var _ SessionStore = &SessionStoreRethinkDB{}
+
+var (
+	// TableName is the name of sessions table in the RethinkDB database
+	TableName = "sessions"
+	// UserIDIndex is the name of the secondary index on user_id
+	UserIDIndex = "user_id"
+)
+
+// SessionStoreRethinkDB RethinkDB based session store
+type SessionStoreRethinkDB struct {
+	session *r.Session
+}
+
+// NewSessionStoreRethinkDB create a new RethinkDB backed session store
+func NewSessionStoreRethinkDB(session *r.Session) SessionStore {
+	return &SessionStoreRethinkDB{session}
+}
+
+// Create create the session in RethinkDB
+func (ss *SessionStoreRethinkDB) Create(session *models.Session) (*models.Session, error) {
+
+	resp, err := r.DB(users.DBName).Table(TableName).Insert(session).RunWrite(ss.session)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.ID == nil {
+		session.ID = models.String(resp.GeneratedKeys[0])
+	}
+
+	return session, nil
+}
+
+// GetByID retrieve a session from RethinkDB
+func (ss *SessionStoreRethinkDB) GetByID(sessionID string) (*models.Session, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).Get(sessionID).Run(ss.session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	if res.IsNil() {
+		return nil, ErrSessionNotFound
+	}
+
+	session := new(models.Session)
+	err = res.One(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ListByUser list the sessions for a user using the user_id index, most recently seen first
+func (ss *SessionStoreRethinkDB) ListByUser(userID string) ([]*models.Session, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).GetAllByIndex(UserIDIndex, userID).
+		OrderBy(r.Desc("last_seen_at")).Run(ss.session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	list := []*models.Session{}
+
+	err = res.All(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Touch update the last seen time of the session in RethinkDB
+func (ss *SessionStoreRethinkDB) Touch(sessionID string, lastSeen time.Time) error {
+
+	res, err := r.DB(users.DBName).Table(TableName).Get(sessionID).Update(map[string]interface{}{
+		"last_seen_at": lastSeen,
+	}).RunWrite(ss.session)
+	if err != nil {
+		return err
+	}
+
+	if res.Replaced != 1 && res.Unchanged != 1 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// Delete delete the session from the RethinkDB database.
+func (ss *SessionStoreRethinkDB) Delete(sessionID string) error {
+
+	res, err := r.DB(users.DBName).Table(TableName).Get(sessionID).Delete().RunWrite(ss.session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted != 1 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package sessions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var (
+	ErrSessionNotFound = errors.New("Session not found.")
+)
+
+// SessionStore session store interface
+type SessionStore interface {
+	Create(session *models.Session) (*models.Session, error)
+	GetByID(sessionID string) (*models.Session, error)
+	ListByUser(userID string) ([]*models.Session, error)
+	Touch(sessionID string, lastSeen time.Time) error
+	Delete(sessionID string) error
+}
@@ -0,0 +1,81 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/pgtest"
+	"github.com/wolfeidau/authinator/store/users/storetest"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+func TestSessionStore(t *testing.T) {
+	storetest.RunBackends(t, func(t *testing.T, b *storetest.Backend) {
+		testSessionStore(t, newSessionStore(t, b))
+	})
+}
+
+// newSessionStore create the session store for the backend
+func newSessionStore(t *testing.T, b *storetest.Backend) SessionStore {
+	switch {
+	case b.Bolt != nil:
+		return NewSessionStoreBolt(b.Bolt)
+	case b.Postgres != nil:
+		return NewSessionStorePostgres(b.Postgres)
+	case b.RethinkDB != nil:
+		storetest.RethinkDBTable(t, b.RethinkDB, TableName, UserIDIndex)
+		return NewSessionStoreRethinkDB(b.RethinkDB)
+	}
+
+	return NewSessionStoreLocal()
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	first, err := store.Create(&models.Session{UserID: models.String("123"), CreatedAt: now, LastSeenAt: now, IP: models.String("127.0.0.1")})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	second, err := store.Create(&models.Session{UserID: models.String("123"), CreatedAt: now, LastSeenAt: now.Add(time.Minute)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	store.Create(&models.Session{UserID: models.String("456"), CreatedAt: now, LastSeenAt: now})
+
+	session, err := store.GetByID(models.StringValue(first.ID))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "123", models.StringValue(session.UserID))
+		assert.Equal(t, "127.0.0.1", models.StringValue(session.IP))
+		assert.Nil(t, session.UserAgent)
+		assert.True(t, now.Equal(session.CreatedAt))
+	}
+
+	list, err := store.ListByUser("123")
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, second.ID, list[0].ID)
+	}
+
+	assert.NoError(t, store.Touch(models.StringValue(first.ID), now.Add(time.Hour)))
+
+	list, err = store.ListByUser("123")
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, first.ID, list[0].ID)
+		assert.True(t, now.Add(time.Hour).Equal(list[0].LastSeenAt))
+	}
+
+	assert.NoError(t, store.Delete(models.StringValue(first.ID)))
+
+	_, err = store.GetByID(models.StringValue(first.ID))
+	assert.Equal(t, ErrSessionNotFound, err)
+	assert.Equal(t, ErrSessionNotFound, store.Delete(models.StringValue(first.ID)))
+	assert.Equal(t, ErrSessionNotFound, store.Touch(models.StringValue(first.ID), now))
+}
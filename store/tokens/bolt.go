@@ -0,0 +1,185 @@
+package tokens
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ AccessTokenStore = &AccessTokenStoreBolt{}
+
+// AccessTokenStoreBolt bolt based access token store, the tokens are kept in the same file
+// as the users with a bucket mapping the token hashes to IDs.
+type AccessTokenStoreBolt struct {
+	db *bolt.DB
+}
+
+// boltAccessToken the stored form of a token, the hash is omitted from the JSON of the model
+type boltAccessToken struct {
+	models.AccessToken
+	Hash *string `json:"hash"`
+}
+
+// NewAccessTokenStoreBolt create a new bolt backed access token store, the database
+// should be opened with users.OpenBolt.
+func NewAccessTokenStoreBolt(db *bolt.DB) AccessTokenStore {
+	return &AccessTokenStoreBolt{db}
+}
+
+// Create store a new access token in bolt, an ID is generated if one isn't supplied
+func (ts *AccessTokenStoreBolt) Create(token *models.AccessToken) (*models.AccessToken, error) {
+
+	if token.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		token.ID = models.String(id)
+	}
+
+	err := ts.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(users.BoltAccessTokenHashesBucket).Put([]byte(models.StringValue(token.Hash)), []byte(models.StringValue(token.ID)))
+		if err != nil {
+			return err
+		}
+
+		return putBoltToken(tx, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetByID retrieve an access token from bolt
+func (ts *AccessTokenStoreBolt) GetByID(tokenID string) (*models.AccessToken, error) {
+	var token *models.AccessToken
+
+	err := ts.db.View(func(tx *bolt.Tx) error {
+		var err error
+		token, err = getBoltToken(tx, tokenID)
+		return err
+	})
+
+	return token, err
+}
+
+// GetByHash retrieve an access token from bolt using the hashes bucket
+func (ts *AccessTokenStoreBolt) GetByHash(hash string) (*models.AccessToken, error) {
+	var token *models.AccessToken
+
+	err := ts.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(users.BoltAccessTokenHashesBucket).Get([]byte(hash))
+		if id == nil {
+			return ErrAccessTokenNotFound
+		}
+
+		var err error
+		token, err = getBoltToken(tx, string(id))
+		return err
+	})
+
+	return token, err
+}
+
+// ListByUser list the access tokens for a user, most recently created first
+func (ts *AccessTokenStoreBolt) ListByUser(userID string) ([]*models.AccessToken, error) {
+	list := []*models.AccessToken{}
+
+	err := ts.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(users.BoltAccessTokensBucket).ForEach(func(k, v []byte) error {
+			token, err := decodeBoltToken(v)
+			if err != nil {
+				return err
+			}
+
+			if models.StringValue(token.UserID) == userID {
+				list = append(list, token)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt != nil && list[j].CreatedAt != nil && list[i].CreatedAt.After(*list[j].CreatedAt)
+	})
+
+	return list, nil
+}
+
+// Touch update the last used time of the access token in bolt
+func (ts *AccessTokenStoreBolt) Touch(tokenID string, lastUsed time.Time) error {
+	return ts.db.Update(func(tx *bolt.Tx) error {
+		token, err := getBoltToken(tx, tokenID)
+		if err != nil {
+			return err
+		}
+
+		token.LastUsedAt = &lastUsed
+
+		return putBoltToken(tx, token)
+	})
+}
+
+// Delete delete the access token and its hash from bolt
+func (ts *AccessTokenStoreBolt) Delete(tokenID string) error {
+	return ts.db.Update(func(tx *bolt.Tx) error {
+		token, err := getBoltToken(tx, tokenID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(users.BoltAccessTokenHashesBucket).Delete([]byte(models.StringValue(token.Hash)))
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(users.BoltAccessTokensBucket).Delete([]byte(tokenID))
+	})
+}
+
+func getBoltToken(tx *bolt.Tx, tokenID string) (*models.AccessToken, error) {
+	buf := tx.Bucket(users.BoltAccessTokensBucket).Get([]byte(tokenID))
+	if buf == nil {
+		return nil, ErrAccessTokenNotFound
+	}
+
+	return decodeBoltToken(buf)
+}
+
+func decodeBoltToken(buf []byte) (*models.AccessToken, error) {
+	stored := new(boltAccessToken)
+
+	err := json.Unmarshal(buf, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	token := stored.AccessToken
+	token.Hash = stored.Hash
+
+	return &token, nil
+}
+
+func putBoltToken(tx *bolt.Tx, token *models.AccessToken) error {
+	stored := boltAccessToken{AccessToken: *token, Hash: token.Hash}
+
+	// the token itself is never stored
+	stored.AccessToken.Token = nil
+
+	buf, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(users.BoltAccessTokensBucket).Put([]byte(models.StringValue(token.ID)), buf)
+}
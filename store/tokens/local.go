@@ -0,0 +1,136 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ AccessTokenStore = &AccessTokenStoreLocal{}
+
+// AccessTokenStoreLocal local access token store for testing purposes
+type AccessTokenStoreLocal struct {
+	sync.RWMutex
+	tokens map[string]models.AccessToken
+}
+
+// NewAccessTokenStoreLocal create a new local access token store
+func NewAccessTokenStoreLocal() AccessTokenStore {
+	return &AccessTokenStoreLocal{tokens: make(map[string]models.AccessToken)}
+}
+
+// Create store a new access token, an ID is generated if one isn't supplied
+func (atl *AccessTokenStoreLocal) Create(token *models.AccessToken) (*models.AccessToken, error) {
+	atl.Lock()
+	defer atl.Unlock()
+
+	if token.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		token.ID = models.String(id)
+	}
+
+	stored := *token
+	stored.Token = nil
+
+	atl.tokens[models.StringValue(token.ID)] = stored
+
+	return token, nil
+}
+
+// GetByID lookup an access token by its identifier
+func (atl *AccessTokenStoreLocal) GetByID(tokenID string) (*models.AccessToken, error) {
+	atl.RLock()
+	defer atl.RUnlock()
+
+	token, ok := atl.tokens[tokenID]
+	if !ok {
+		return nil, ErrAccessTokenNotFound
+	}
+
+	return &token, nil
+}
+
+// GetByHash lookup an access token by the hash of the token
+func (atl *AccessTokenStoreLocal) GetByHash(hash string) (*models.AccessToken, error) {
+	atl.RLock()
+	defer atl.RUnlock()
+
+	for _, v := range atl.tokens {
+		if models.StringValue(v.Hash) == hash {
+			token := v
+			return &token, nil
+		}
+	}
+
+	return nil, ErrAccessTokenNotFound
+}
+
+// ListByUser list the access tokens for a user, most recently created first
+func (atl *AccessTokenStoreLocal) ListByUser(userID string) ([]*models.AccessToken, error) {
+	atl.RLock()
+	defer atl.RUnlock()
+
+	list := []*models.AccessToken{}
+
+	for _, v := range atl.tokens {
+		if models.StringValue(v.UserID) == userID {
+			token := v
+			list = append(list, &token)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt != nil && list[j].CreatedAt != nil && list[i].CreatedAt.After(*list[j].CreatedAt)
+	})
+
+	return list, nil
+}
+
+// Touch update the last used time of the access token
+func (atl *AccessTokenStoreLocal) Touch(tokenID string, lastUsed time.Time) error {
+	atl.Lock()
+	defer atl.Unlock()
+
+	token, ok := atl.tokens[tokenID]
+	if !ok {
+		return ErrAccessTokenNotFound
+	}
+
+	token.LastUsedAt = &lastUsed
+
+	atl.tokens[tokenID] = token
+
+	return nil
+}
+
+// Delete revoke the access token by token ID
+func (atl *AccessTokenStoreLocal) Delete(tokenID string) error {
+	atl.Lock()
+	defer atl.Unlock()
+
+	if _, ok := atl.tokens[tokenID]; !ok {
+		return ErrAccessTokenNotFound
+	}
+
+	delete(atl.tokens, tokenID)
+
+	return nil
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,52 @@
+package tokens
+
+import (
+	"time"
+
+	"github.com/wolfeidau/authinator/metrics"
+	"github.com/wolfeidau/authinator/models"
+)
+
+type accessTokenStoreMetrics struct {
+	store AccessTokenStore
+}
+
+// NewAccessTokenStoreMetrics create an access token store which records the latency and
+// result of each operation on the store
+func NewAccessTokenStoreMetrics(store AccessTokenStore) AccessTokenStore {
+	return &accessTokenStoreMetrics{store}
+}
+
+func observeOperation(operation string, start time.Time, err error) {
+	metrics.ObserveStoreOperation("tokens", operation, start, err, ErrAccessTokenNotFound)
+}
+
+func (tm *accessTokenStoreMetrics) Create(token *models.AccessToken) (t *models.AccessToken, err error) {
+	defer func(start time.Time) { observeOperation("create", start, err) }(time.Now())
+	return tm.store.Create(token)
+}
+
+func (tm *accessTokenStoreMetrics) GetByID(tokenID string) (t *models.AccessToken, err error) {
+	defer func(start time.Time) { observeOperation("get_by_id", start, err) }(time.Now())
+	return tm.store.GetByID(tokenID)
+}
+
+func (tm *accessTokenStoreMetrics) GetByHash(hash string) (t *models.AccessToken, err error) {
+	defer func(start time.Time) { observeOperation("get_by_hash", start, err) }(time.Now())
+	return tm.store.GetByHash(hash)
+}
+
+func (tm *accessTokenStoreMetrics) ListByUser(userID string) (list []*models.AccessToken, err error) {
+	defer func(start time.Time) { observeOperation("list_by_user", start, err) }(time.Now())
+	return tm.store.ListByUser(userID)
+}
+
+func (tm *accessTokenStoreMetrics) Touch(tokenID string, lastUsed time.Time) (err error) {
+	defer func(start time.Time) { observeOperation("touch", start, err) }(time.Now())
+	return tm.store.Touch(tokenID, lastUsed)
+}
+
+func (tm *accessTokenStoreMetrics) Delete(tokenID string) (err error) {
+	defer func(start time.Time) { observeOperation("delete", start, err) }(time.Now())
+	return tm.store.Delete(tokenID)
+}
@@ -0,0 +1,139 @@
+package tokens
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ AccessTokenStore = &AccessTokenStorePostgres{}
+
+const tokenColumns = "id, user_id, name, scopes, hash, created_at, expires_at, last_used_at"
+
+// AccessTokenStorePostgres PostgreSQL based access token store
+type AccessTokenStorePostgres struct {
+	db *sql.DB
+}
+
+// NewAccessTokenStorePostgres create a new PostgreSQL backed access token store, the
+// table is created by the users.PostgresMigrations.
+func NewAccessTokenStorePostgres(db *sql.DB) AccessTokenStore {
+	return &AccessTokenStorePostgres{db}
+}
+
+// Create create the access token in PostgreSQL, an ID is generated if one isn't supplied
+func (ts *AccessTokenStorePostgres) Create(token *models.AccessToken) (*models.AccessToken, error) {
+
+	if token.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		token.ID = models.String(id)
+	}
+
+	_, err := ts.db.Exec("INSERT INTO access_tokens ("+tokenColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		token.ID, token.UserID, token.Name, pq.Array(token.Scopes), token.Hash, token.CreatedAt, token.ExpiresAt, token.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetByID retrieve an access token from PostgreSQL
+func (ts *AccessTokenStorePostgres) GetByID(tokenID string) (*models.AccessToken, error) {
+	return scanToken(ts.db.QueryRow("SELECT "+tokenColumns+" FROM access_tokens WHERE id = $1", tokenID))
+}
+
+// GetByHash retrieve an access token from PostgreSQL using the unique index on hash
+func (ts *AccessTokenStorePostgres) GetByHash(hash string) (*models.AccessToken, error) {
+	return scanToken(ts.db.QueryRow("SELECT "+tokenColumns+" FROM access_tokens WHERE hash = $1", hash))
+}
+
+// ListByUser list the access tokens for a user, most recently created first
+func (ts *AccessTokenStorePostgres) ListByUser(userID string) ([]*models.AccessToken, error) {
+
+	rows, err := ts.db.Query("SELECT "+tokenColumns+" FROM access_tokens WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*models.AccessToken{}
+
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, token)
+	}
+
+	return list, rows.Err()
+}
+
+// Touch update the last used time of the access token in PostgreSQL
+func (ts *AccessTokenStorePostgres) Touch(tokenID string, lastUsed time.Time) error {
+
+	res, err := ts.db.Exec("UPDATE access_tokens SET last_used_at = $2 WHERE id = $1", tokenID, lastUsed)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Delete delete the access token from the PostgreSQL database.
+func (ts *AccessTokenStorePostgres) Delete(tokenID string) error {
+
+	res, err := ts.db.Exec("DELETE FROM access_tokens WHERE id = $1", tokenID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// scanner is implemented by sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row scanner) (*models.AccessToken, error) {
+	var (
+		token  = new(models.AccessToken)
+		scopes pq.StringArray
+	)
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.Hash, &token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccessTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scopes) != 0 {
+		token.Scopes = []string(scopes)
+	}
+
+	return token, nil
+}
+
+func checkRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return ErrAccessTokenNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package tokens
+
+import (
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+var _ AccessTokenStore = &AccessTokenStoreRethinkDB{}
+
+var (
+	// TableName is the name of access tokens table in the RethinkDB database
+	TableName = "access_tokens"
+	// UserIDIndex is the name of the secondary index on user_id
+	UserIDIndex = "user_id"
+	// HashIndex is the name of the secondary index on hash
+	HashIndex = "hash"
+)
+
+// AccessTokenStoreRethinkDB RethinkDB based access token store
+type AccessTokenStoreRethinkDB struct {
+	session *r.Session
+}
+
+// NewAccessTokenStoreRethinkDB create a new RethinkDB backed access token store
+func NewAccessTokenStoreRethinkDB(session *r.Session) AccessTokenStore {
+	return &AccessTokenStoreRethinkDB{session}
+}
+
+// Create create the access token in RethinkDB
+func (ts *AccessTokenStoreRethinkDB) Create(token *models.AccessToken) (*models.AccessToken, error) {
+
+	resp, err := r.DB(users.DBName).Table(TableName).Insert(token).RunWrite(ts.session)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ID == nil {
+		token.ID = models.String(resp.GeneratedKeys[0])
+	}
+
+	return token, nil
+}
+
+// GetByID retrieve an access token from RethinkDB
+func (ts *AccessTokenStoreRethinkDB) GetByID(tokenID string) (*models.AccessToken, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).Get(tokenID).Run(ts.session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	if res.IsNil() {
+		return nil, ErrAccessTokenNotFound
+	}
+
+	token := new(models.AccessToken)
+	err = res.One(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetByHash retrieve an access token from RethinkDB using the hash index
+func (ts *AccessTokenStoreRethinkDB) GetByHash(hash string) (*models.AccessToken, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).GetAllByIndex(HashIndex, hash).Run(ts.session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	if res.IsNil() {
+		return nil, ErrAccessTokenNotFound
+	}
+
+	token := new(models.AccessToken)
+	err = res.One(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ListByUser list the access tokens for a user using the user_id index, most recently created first
+func (ts *AccessTokenStoreRethinkDB) ListByUser(userID string) ([]*models.AccessToken, error) {
+
+	res, err := r.DB(users.DBName).Table(TableName).GetAllByIndex(UserIDIndex, userID).
+		OrderBy(r.Desc("created_at")).Run(ts.session)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	list := []*models.AccessToken{}
+
+	err = res.All(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Touch update the last used time of the access token in RethinkDB
+func (ts *AccessTokenStoreRethinkDB) Touch(tokenID string, lastUsed time.Time) error {
+
+	res, err := r.DB(users.DBName).Table(TableName).Get(tokenID).Update(map[string]interface{}{
+		"last_used_at": lastUsed,
+	}).RunWrite(ts.session)
+	if err != nil {
+		return err
+	}
+
+	if res.Replaced != 1 && res.Unchanged != 1 {
+		return ErrAccessTokenNotFound
+	}
+
+	return nil
+}
+
+// Delete delete the access token from the RethinkDB database.
+func (ts *AccessTokenStoreRethinkDB) Delete(tokenID string) error {
+
+	res, err := r.DB(users.DBName).Table(TableName).Get(tokenID).Delete().RunWrite(ts.session)
+	if err != nil {
+		return err
+	}
+
+	if res.Deleted != 1 {
+		return ErrAccessTokenNotFound
+	}
+
+	return nil
+}
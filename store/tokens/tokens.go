@@ -0,0 +1,22 @@
+package tokens
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var (
+	ErrAccessTokenNotFound = errors.New("Access token not found.")
+)
+
+// AccessTokenStore personal access token store interface
+type AccessTokenStore interface {
+	Create(token *models.AccessToken) (*models.AccessToken, error)
+	GetByID(tokenID string) (*models.AccessToken, error)
+	GetByHash(hash string) (*models.AccessToken, error)
+	ListByUser(userID string) ([]*models.AccessToken, error)
+	Touch(tokenID string, lastUsed time.Time) error
+	Delete(tokenID string) error
+}
@@ -0,0 +1,93 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/pgtest"
+	"github.com/wolfeidau/authinator/store/users/storetest"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+func TestAccessTokenStore(t *testing.T) {
+	storetest.RunBackends(t, func(t *testing.T, b *storetest.Backend) {
+		testAccessTokenStore(t, newAccessTokenStore(t, b))
+	})
+}
+
+// newAccessTokenStore create the access token store for the backend
+func newAccessTokenStore(t *testing.T, b *storetest.Backend) AccessTokenStore {
+	switch {
+	case b.Bolt != nil:
+		return NewAccessTokenStoreBolt(b.Bolt)
+	case b.Postgres != nil:
+		return NewAccessTokenStorePostgres(b.Postgres)
+	case b.RethinkDB != nil:
+		storetest.RethinkDBTable(t, b.RethinkDB, TableName, UserIDIndex, HashIndex)
+		return NewAccessTokenStoreRethinkDB(b.RethinkDB)
+	}
+
+	return NewAccessTokenStoreLocal()
+}
+
+func testAccessTokenStore(t *testing.T, store AccessTokenStore) {
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	later := now.Add(time.Hour)
+
+	ci, err := store.Create(&models.AccessToken{
+		UserID:    models.String("123"),
+		Name:      models.String("ci"),
+		Scopes:    []string{"users:read"},
+		Hash:      models.String("hash-ci"),
+		CreatedAt: &now,
+		ExpiresAt: &later,
+		Token:     models.String("secret"),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	deploy, err := store.Create(&models.AccessToken{UserID: models.String("123"), Name: models.String("deploy"), Hash: models.String("hash-deploy"), CreatedAt: &later})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	token, err := store.GetByHash("hash-ci")
+	if assert.NoError(t, err) {
+		assert.Equal(t, ci.ID, token.ID)
+		assert.Equal(t, []string{"users:read"}, token.Scopes)
+		assert.Equal(t, "hash-ci", models.StringValue(token.Hash))
+		assert.True(t, later.Equal(*token.ExpiresAt))
+		assert.Nil(t, token.Token)
+		assert.Nil(t, token.LastUsedAt)
+	}
+
+	_, err = store.GetByHash("hash-other")
+	assert.Equal(t, ErrAccessTokenNotFound, err)
+
+	assert.NoError(t, store.Touch(models.StringValue(ci.ID), later))
+
+	list, err := store.ListByUser("123")
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, deploy.ID, list[0].ID)
+		assert.Nil(t, list[0].Scopes)
+		assert.True(t, later.Equal(*list[1].LastUsedAt))
+	}
+
+	assert.NoError(t, store.Delete(models.StringValue(ci.ID)))
+
+	_, err = store.GetByID(models.StringValue(ci.ID))
+	assert.Equal(t, ErrAccessTokenNotFound, err)
+
+	_, err = store.GetByHash("hash-ci")
+	assert.Equal(t, ErrAccessTokenNotFound, err)
+
+	assert.Equal(t, ErrAccessTokenNotFound, store.Delete(models.StringValue(ci.ID)))
+	assert.Equal(t, ErrAccessTokenNotFound, store.Touch(models.StringValue(ci.ID), now))
+}
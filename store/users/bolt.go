@@ -0,0 +1,472 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ UserStore = &UserStoreBolt{}
+
+var (
+	// BoltUsersBucket is the name of the bucket holding users keyed by ID
+	BoltUsersBucket = []byte("users")
+	// BoltLoginsBucket is the name of the bucket mapping logins to user IDs
+	BoltLoginsBucket = []byte("logins")
+
+	// BoltSessionsBucket is the name of the bucket holding sessions keyed by ID
+	BoltSessionsBucket = []byte("sessions")
+	// BoltLoginHistoryBucket is the name of the bucket holding a bucket of sign in attempts for each user
+	BoltLoginHistoryBucket = []byte("login_history")
+	// BoltAccessTokensBucket is the name of the bucket holding access tokens keyed by ID
+	BoltAccessTokensBucket = []byte("access_tokens")
+	// BoltAccessTokenHashesBucket is the name of the bucket mapping access token hashes to IDs
+	BoltAccessTokenHashesBucket = []byte("access_token_hashes")
+	// BoltMagicLinksBucket is the name of the bucket holding magic links keyed by ID
+	BoltMagicLinksBucket = []byte("magic_links")
+)
+
+// UserStoreBolt embedded bolt file based user store, this doesn't require a database server.
+type UserStoreBolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt open or create the bolt database file and apply any pending migrations, the
+// file holds the buckets of the session, login history, access token and magic link stores
+// as well as the users.
+func OpenBolt(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = MigrateBolt(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewUserStoreBolt create a new bolt backed user store, the database should be opened with OpenBolt.
+func NewUserStoreBolt(db *bolt.DB) UserStore {
+	return &UserStoreBolt{db}
+}
+
+// GetByID retrieve a user from bolt
+func (us *UserStoreBolt) GetByID(ctx context.Context, userID string) (*models.User, error) {
+	var usr *models.User
+
+	err := us.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		usr, err = getBoltUser(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usr.Password = nil
+
+	return usr, nil
+}
+
+// List list the active users from bolt ordered by ID after the given ID
+func (us *UserStoreBolt) List(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	list := []*models.User{}
+
+	err := us.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(BoltUsersBucket).Cursor()
+
+		k, v := c.Seek([]byte(after))
+		if k != nil && string(k) == after {
+			k, v = c.Next()
+		}
+
+		for ; k != nil && len(list) < limit; k, v = c.Next() {
+			usr := new(models.User)
+
+			err := json.Unmarshal(v, usr)
+			if err != nil {
+				return err
+			}
+
+			if usr.DeletedAt != nil {
+				continue
+			}
+
+			if usr.Version == nil {
+				usr.Version = models.Int64(1)
+			}
+
+			usr.Password = nil
+
+			list = append(list, usr)
+		}
+
+		return nil
+	})
+
+	return list, err
+}
+
+// GetByLogin retrieve a user from bolt using the logins bucket
+func (us *UserStoreBolt) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	var usr *models.User
+
+	err := us.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		usr, err = getBoltUserByLogin(tx, login)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usr.Password = nil
+
+	return usr, nil
+}
+
+// GetPasswordByLogin retrieve the password for a user using their login
+func (us *UserStoreBolt) GetPasswordByLogin(ctx context.Context, login string) (string, error) {
+	var usr *models.User
+
+	err := us.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		usr, err = getBoltUserByLogin(tx, login)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return models.StringValue(usr.Password), nil
+}
+
+// Create create the user in bolt, the login is checked and reserved in the same
+// transaction so concurrent registrations can't both succeed.
+func (us *UserStoreBolt) Create(ctx context.Context, user *models.User) (*models.User, error) {
+
+	if user.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		user.ID = models.String(id)
+	}
+
+	user.Version = models.Int64(1)
+
+	err := us.update(ctx, func(tx *bolt.Tx) error {
+		id := []byte(models.StringValue(user.ID))
+		login := []byte(models.StringValue(user.Login))
+
+		logins := tx.Bucket(BoltLoginsBucket)
+
+		if logins.Get(login) != nil || tx.Bucket(BoltUsersBucket).Get(id) != nil {
+			return ErrUserAlreadyExists
+		}
+
+		err := logins.Put(login, id)
+		if err != nil {
+			return err
+		}
+
+		return putBoltUser(tx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Update set the masked fields of the user in bolt, a login change is checked and
+// reserved in the same transaction.
+func (us *UserStoreBolt) Update(ctx context.Context, user *models.User, mask []string) error {
+	return us.update(ctx, func(tx *bolt.Tx) error {
+		cusr, err := getBoltUser(tx, models.StringValue(user.ID))
+		if err != nil {
+			return err
+		}
+
+		if user.Version != nil && *user.Version != *cusr.Version {
+			return ErrConflict
+		}
+
+		oldLogin := models.StringValue(cusr.Login)
+
+		cusr.Version = models.Int64(*cusr.Version + 1)
+
+		err = applyMask(cusr, user, mask)
+		if err != nil {
+			return err
+		}
+
+		newLogin := models.StringValue(cusr.Login)
+
+		if oldLogin != newLogin {
+			logins := tx.Bucket(BoltLoginsBucket)
+
+			if logins.Get([]byte(newLogin)) != nil {
+				return ErrUserAlreadyExists
+			}
+
+			err = logins.Delete([]byte(oldLogin))
+			if err != nil {
+				return err
+			}
+
+			err = logins.Put([]byte(newLogin), []byte(models.StringValue(cusr.ID)))
+			if err != nil {
+				return err
+			}
+		}
+
+		err = putBoltUser(tx, cusr)
+		if err != nil {
+			return err
+		}
+
+		user.Version = models.Int64(*cusr.Version)
+
+		return nil
+	})
+}
+
+// Delete soft delete the user in bolt, their login is released unless ReserveDeletedLogins is set.
+func (us *UserStoreBolt) Delete(ctx context.Context, userID string) error {
+	return us.update(ctx, func(tx *bolt.Tx) error {
+		cusr, err := getBoltUser(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		cusr.DeletedAt = &now
+		cusr.Version = models.Int64(*cusr.Version + 1)
+
+		if !ReserveDeletedLogins {
+			err = tx.Bucket(BoltLoginsBucket).Delete([]byte(models.StringValue(cusr.Login)))
+			if err != nil {
+				return err
+			}
+		}
+
+		return putBoltUser(tx, cusr)
+	})
+}
+
+// Restore undo the soft delete of the user in bolt
+func (us *UserStoreBolt) Restore(ctx context.Context, userID string) error {
+	return us.update(ctx, func(tx *bolt.Tx) error {
+		cusr, err := getBoltUserIncludingDeleted(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if cusr.DeletedAt == nil {
+			return ErrUserNotFound
+		}
+
+		logins := tx.Bucket(BoltLoginsBucket)
+		login := []byte(models.StringValue(cusr.Login))
+
+		if id := logins.Get(login); id != nil && string(id) != userID {
+			return ErrUserAlreadyExists
+		}
+
+		err = logins.Put(login, []byte(userID))
+		if err != nil {
+			return err
+		}
+
+		cusr.DeletedAt = nil
+		cusr.Version = models.Int64(*cusr.Version + 1)
+
+		return putBoltUser(tx, cusr)
+	})
+}
+
+// Erase permanently erase the user from bolt and release their login
+func (us *UserStoreBolt) Erase(ctx context.Context, userID string) error {
+	return us.update(ctx, func(tx *bolt.Tx) error {
+		usr, err := getBoltUserIncludingDeleted(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		logins := tx.Bucket(BoltLoginsBucket)
+		login := []byte(models.StringValue(usr.Login))
+
+		if string(logins.Get(login)) == userID {
+			err = logins.Delete(login)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(BoltUsersBucket).Delete([]byte(userID))
+	})
+}
+
+// Purge permanently erase the users deleted before the given time from bolt
+func (us *UserStoreBolt) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	var purged int
+
+	err := us.update(ctx, func(tx *bolt.Tx) error {
+		var expired []*models.User
+
+		err := tx.Bucket(BoltUsersBucket).ForEach(func(k, v []byte) error {
+			usr := new(models.User)
+
+			err := json.Unmarshal(v, usr)
+			if err != nil {
+				return err
+			}
+
+			if usr.DeletedAt != nil && usr.DeletedAt.Before(deletedBefore) {
+				expired = append(expired, usr)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// buckets can't be modified while iterating over them
+		for _, usr := range expired {
+			id := []byte(models.StringValue(usr.ID))
+			login := []byte(models.StringValue(usr.Login))
+
+			logins := tx.Bucket(BoltLoginsBucket)
+
+			if string(logins.Get(login)) == string(id) {
+				err = logins.Delete(login)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = tx.Bucket(BoltUsersBucket).Delete(id)
+			if err != nil {
+				return err
+			}
+		}
+
+		purged = len(expired)
+
+		return nil
+	})
+
+	return purged, err
+}
+
+// Exists check if the login is registered in bolt.
+func (us *UserStoreBolt) Exists(ctx context.Context, login string) (bool, error) {
+	var exists bool
+
+	err := us.view(ctx, func(tx *bolt.Tx) error {
+		exists = tx.Bucket(BoltLoginsBucket).Get([]byte(login)) != nil
+		return nil
+	})
+
+	return exists, err
+}
+
+// Ping check the bolt file is open and can be read
+func (us *UserStoreBolt) Ping(ctx context.Context) error {
+	return us.view(ctx, func(*bolt.Tx) error { return nil })
+}
+
+// RecordLogin update the last login time and IP address of the user in bolt
+func (us *UserStoreBolt) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error {
+	return us.update(ctx, func(tx *bolt.Tx) error {
+		cusr, err := getBoltUser(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		cusr.LastLoginAt = &at
+		cusr.LastLoginIP = models.String(ip)
+
+		return putBoltUser(tx, cusr)
+	})
+}
+
+// getBoltUser lookup the user treating soft deleted users as not found
+func getBoltUser(tx *bolt.Tx, userID string) (*models.User, error) {
+	usr, err := getBoltUserIncludingDeleted(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return usr, nil
+}
+
+func getBoltUserIncludingDeleted(tx *bolt.Tx, userID string) (*models.User, error) {
+	buf := tx.Bucket(BoltUsersBucket).Get([]byte(userID))
+	if buf == nil {
+		return nil, ErrUserNotFound
+	}
+
+	usr := new(models.User)
+
+	err := json.Unmarshal(buf, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	// users stored before versions were added start at version 1
+	if usr.Version == nil {
+		usr.Version = models.Int64(1)
+	}
+
+	return usr, nil
+}
+
+func getBoltUserByLogin(tx *bolt.Tx, login string) (*models.User, error) {
+	id := tx.Bucket(BoltLoginsBucket).Get([]byte(login))
+	if id == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return getBoltUser(tx, string(id))
+}
+
+func putBoltUser(tx *bolt.Tx, usr *models.User) error {
+	buf, err := json.Marshal(usr)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(BoltUsersBucket).Put([]byte(models.StringValue(usr.ID)), buf)
+}
+
+// view runs a read only transaction, bolt can't interrupt a transaction so the context
+// is only checked before it starts.
+func (us *UserStoreBolt) view(ctx context.Context, fn func(*bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return us.db.View(fn)
+}
+
+// update runs a read write transaction once the context has been checked.
+func (us *UserStoreBolt) update(ctx context.Context, fn func(*bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return us.db.Update(fn)
+}
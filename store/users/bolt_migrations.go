@@ -0,0 +1,32 @@
+package users
+
+import (
+	"context"
+
+	"github.com/wolfeidau/authinator/store/migrate"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltMigrations the ordered schema changes for the bolt store. Append new migrations
+// to the end and never modify ones which have been released.
+func BoltMigrations(db *bolt.DB) []migrate.Step {
+	return []migrate.Step{
+		migrate.BoltBucketStep(db, 1, "users and logins buckets", BoltUsersBucket, BoltLoginsBucket),
+		migrate.BoltBucketStep(db, 2, "sessions, login history, access tokens and magic links buckets",
+			BoltSessionsBucket, BoltLoginHistoryBucket, BoltAccessTokensBucket, BoltAccessTokenHashesBucket, BoltMagicLinksBucket),
+	}
+}
+
+// MigrateBolt apply any migrations which haven't been recorded in the
+// schema_migrations bucket.
+func MigrateBolt(db *bolt.DB) (int, error) {
+
+	m, err := migrate.NewMigrator(migrate.NewBoltRecorder(db), BoltMigrations(db))
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := m.Up(context.Background())
+
+	return len(applied), err
+}
@@ -0,0 +1,133 @@
+package users
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+)
+
+func TestCreateAndGetUserBolt(t *testing.T) {
+
+	userStore, cleanup := createUserStoreBolt(t)
+	defer cleanup()
+
+	usr := models.NewUser("", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+	usr.ID = nil
+	usr.Password = models.String("LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP")
+
+	usr, err := userStore.Create(context.Background(), usr)
+
+	if assert.NoError(t, err) {
+
+		cusr, err := userStore.GetByID(context.Background(), models.StringValue(usr.ID))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "mark@wolfe.id.au", models.StringValue(cusr.Email))
+			assert.Nil(t, cusr.Password)
+		}
+
+		cusr, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.Equal(t, models.StringValue(usr.ID), models.StringValue(cusr.ID))
+		}
+
+		pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP", pass)
+		}
+
+		err = userStore.Update(context.Background(), &models.User{ID: usr.ID, Name: models.String("Mark Wolfy")}, []string{FieldName})
+		assert.NoError(t, err)
+
+		err = userStore.RecordLogin(context.Background(), models.StringValue(usr.ID), time.Now(), "127.0.0.1")
+		assert.NoError(t, err)
+
+		cusr, err = userStore.GetByID(context.Background(), models.StringValue(usr.ID))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Mark Wolfy", models.StringValue(cusr.Name))
+			assert.Equal(t, "127.0.0.1", models.StringValue(cusr.LastLoginIP))
+		}
+
+		err = userStore.Delete(context.Background(), models.StringValue(usr.ID))
+		assert.NoError(t, err)
+
+		// the login stays reserved until the user is purged
+		exists, err := userStore.Exists(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.True(t, exists)
+		}
+
+		n, err := userStore.Purge(context.Background(), time.Now().Add(time.Hour))
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1, n)
+		}
+
+		exists, err = userStore.Exists(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.False(t, exists)
+		}
+	}
+
+	_, err = userStore.GetByID(context.Background(), "nothere")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String("nothere"), Name: models.String("Mark Wolfy")}, []string{FieldName})
+	assert.Equal(t, ErrUserNotFound, err)
+}
+
+func TestCreateUniqueLoginBolt(t *testing.T) {
+
+	userStore, cleanup := createUserStoreBolt(t)
+	defer cleanup()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := userStore.Create(context.Background(), &models.User{Login: models.String("wolfeidau"), Email: models.String("mark@wolfe.id.au")})
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+				return
+			}
+
+			assert.Equal(t, ErrUserAlreadyExists, err)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 1, created)
+}
+
+func createUserStoreBolt(t *testing.T) (UserStore, func()) {
+	dir, err := ioutil.TempDir("", "authinator")
+	if err != nil {
+		t.Fatalf("error creating temp dir %v", err)
+	}
+
+	db, err := OpenBolt(filepath.Join(dir, "authinator.db"))
+	if err != nil {
+		t.Fatalf("error opening bolt %v", err)
+	}
+
+	return NewUserStoreBolt(db), func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
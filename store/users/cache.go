@@ -0,0 +1,265 @@
+package users
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ UserStore = &UserStoreCache{}
+
+// CacheStats the hit and miss counters of a user cache
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// UserStoreCache read through cache in front of another user store, it holds at most size
+// users for up to the TTL and is safe for concurrent use.
+//
+// GetByID and GetByLogin are served from the cache, writes through this store invalidate
+// the cached user. Writes made by other replicas aren't seen until the entry expires unless
+// the cache is subscribed to the store's changes, see WatchRethinkDB. Passwords are never
+// cached.
+type UserStoreCache struct {
+	store UserStore
+	size  int
+	ttl   time.Duration
+
+	hits   uint64
+	misses uint64
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	logins  map[string]string
+	// generation is incremented by every invalidation so loads which raced with a write
+	// aren't cached
+	generation uint64
+}
+
+type cacheEntry struct {
+	usr     *models.User
+	expires time.Time
+}
+
+// NewUserStoreCache create a cache of up to size users in front of the user store
+func NewUserStoreCache(store UserStore, size int, ttl time.Duration) *UserStoreCache {
+	return &UserStoreCache{
+		store:   store,
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		logins:  make(map[string]string),
+	}
+}
+
+// Stats return the hit and miss counters
+func (uc *UserStoreCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&uc.hits),
+		Misses: atomic.LoadUint64(&uc.misses),
+	}
+}
+
+// GetByID lookup a user by their Identifier, using the cache if possible
+func (uc *UserStoreCache) GetByID(ctx context.Context, userID string) (*models.User, error) {
+	if usr, ok := uc.get(userID); ok {
+		return usr, nil
+	}
+
+	gen := uc.currentGeneration()
+
+	usr, err := uc.store.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.put(usr, gen)
+
+	return usr, nil
+}
+
+// GetByLogin lookup a user by their login, using the cache if possible
+func (uc *UserStoreCache) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	uc.mu.Lock()
+	userID, ok := uc.logins[login]
+	uc.mu.Unlock()
+
+	if ok {
+		if usr, ok := uc.get(userID); ok {
+			return usr, nil
+		}
+	} else {
+		atomic.AddUint64(&uc.misses, 1)
+	}
+
+	gen := uc.currentGeneration()
+
+	usr, err := uc.store.GetByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	uc.put(usr, gen)
+
+	return usr, nil
+}
+
+// List list users from the underlying store
+func (uc *UserStoreCache) List(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	return uc.store.List(ctx, after, limit)
+}
+
+// GetPasswordByLogin retrieve the users password from the underlying store
+func (uc *UserStoreCache) GetPasswordByLogin(ctx context.Context, login string) (string, error) {
+	return uc.store.GetPasswordByLogin(ctx, login)
+}
+
+// Create create the user in the underlying store
+func (uc *UserStoreCache) Create(ctx context.Context, user *models.User) (*models.User, error) {
+	return uc.store.Create(ctx, user)
+}
+
+// Update update the user and invalidate the cached copy
+func (uc *UserStoreCache) Update(ctx context.Context, user *models.User, mask []string) error {
+	defer uc.Invalidate(models.StringValue(user.ID))
+	return uc.store.Update(ctx, user, mask)
+}
+
+// Delete delete the user and invalidate the cached copy
+func (uc *UserStoreCache) Delete(ctx context.Context, userID string) error {
+	defer uc.Invalidate(userID)
+	return uc.store.Delete(ctx, userID)
+}
+
+// Restore restore the user and invalidate the cached copy
+func (uc *UserStoreCache) Restore(ctx context.Context, userID string) error {
+	defer uc.Invalidate(userID)
+	return uc.store.Restore(ctx, userID)
+}
+
+// Purge purge deleted users from the underlying store, deleted users are never cached
+func (uc *UserStoreCache) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return uc.store.Purge(ctx, deletedBefore)
+}
+
+// Erase erase the user and invalidate the cached copy
+func (uc *UserStoreCache) Erase(ctx context.Context, userID string) error {
+	defer uc.Invalidate(userID)
+	return uc.store.Erase(ctx, userID)
+}
+
+// Exists check if the login exists in the underlying store
+func (uc *UserStoreCache) Exists(ctx context.Context, login string) (bool, error) {
+	return uc.store.Exists(ctx, login)
+}
+
+// Ping check the underlying store can be reached
+func (uc *UserStoreCache) Ping(ctx context.Context) error {
+	return uc.store.Ping(ctx)
+}
+
+// RecordLogin record the login and invalidate the cached copy
+func (uc *UserStoreCache) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error {
+	defer uc.Invalidate(userID)
+	return uc.store.RecordLogin(ctx, userID, at, ip)
+}
+
+// Invalidate remove the user from the cache
+func (uc *UserStoreCache) Invalidate(userID string) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	uc.generation++
+
+	if el, ok := uc.entries[userID]; ok {
+		uc.remove(el)
+	}
+}
+
+// Flush remove every user from the cache
+func (uc *UserStoreCache) Flush() {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	uc.generation++
+
+	uc.lru.Init()
+	uc.entries = make(map[string]*list.Element)
+	uc.logins = make(map[string]string)
+}
+
+func (uc *UserStoreCache) get(userID string) (*models.User, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	el, ok := uc.entries[userID]
+	if ok && time.Now().After(el.Value.(*cacheEntry).expires) {
+		uc.remove(el)
+		ok = false
+	}
+
+	if !ok {
+		atomic.AddUint64(&uc.misses, 1)
+		return nil, false
+	}
+
+	atomic.AddUint64(&uc.hits, 1)
+
+	uc.lru.MoveToFront(el)
+
+	return copyUser(el.Value.(*cacheEntry).usr), true
+}
+
+func (uc *UserStoreCache) currentGeneration() uint64 {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	return uc.generation
+}
+
+// put cache the user unless it has been invalidated since the load started
+func (uc *UserStoreCache) put(usr *models.User, gen uint64) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if uc.size <= 0 || gen != uc.generation {
+		return
+	}
+
+	userID := models.StringValue(usr.ID)
+
+	if el, ok := uc.entries[userID]; ok {
+		uc.remove(el)
+	}
+
+	entry := &cacheEntry{
+		usr:     copyUser(usr),
+		expires: time.Now().Add(uc.ttl),
+	}
+
+	uc.entries[userID] = uc.lru.PushFront(entry)
+	uc.logins[models.StringValue(usr.Login)] = userID
+
+	for uc.lru.Len() > uc.size {
+		uc.remove(uc.lru.Back())
+	}
+}
+
+func (uc *UserStoreCache) remove(el *list.Element) {
+	usr := uc.lru.Remove(el).(*cacheEntry).usr
+
+	userID, login := models.StringValue(usr.ID), models.StringValue(usr.Login)
+
+	delete(uc.entries, userID)
+
+	if uc.logins[login] == userID {
+		delete(uc.logins, login)
+	}
+}
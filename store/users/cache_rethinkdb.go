@@ -0,0 +1,47 @@
+package users
+
+import (
+	"context"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/wolfeidau/authinator/models"
+)
+
+// WatchRethinkDB invalidate cached users when they are changed in RethinkDB, including by
+// other replicas. It blocks until the context is cancelled or the changefeed fails, the
+// cache is flushed when the feed starts as changes may have been missed while it wasn't
+// running.
+func (uc *UserStoreCache) WatchRethinkDB(ctx context.Context, session *r.Session) error {
+
+	res, err := r.DB(DBName).Table(TableName).Changes().Run(session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	defer res.Close()
+
+	uc.Flush()
+
+	var change struct {
+		OldValue *models.User `gorethink:"old_val"`
+		NewValue *models.User `gorethink:"new_val"`
+	}
+
+	for res.Next(&change) {
+		if change.OldValue != nil {
+			uc.Invalidate(models.StringValue(change.OldValue.ID))
+		}
+
+		if change.NewValue != nil {
+			uc.Invalidate(models.StringValue(change.NewValue.ID))
+		}
+
+		change.OldValue, change.NewValue = nil, nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return res.Err()
+}
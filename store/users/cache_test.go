@@ -0,0 +1,142 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+)
+
+func newCachedTestUser(t *testing.T, store UserStore, id, login string) {
+	usr := models.NewUser(id, login, login+"@example.com", "User")
+	usr.Password = models.String("LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP")
+
+	_, err := store.Create(context.Background(), usr)
+	if err != nil {
+		t.Fatalf("error creating user %v", err)
+	}
+}
+
+func TestUserStoreCacheHitsAndMisses(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+	newCachedTestUser(t, backing, "123", "wolfeidau")
+
+	cache := NewUserStoreCache(backing, 10, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		usr, err := cache.GetByID(context.Background(), "123")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "wolfeidau", models.StringValue(usr.Login))
+			assert.Nil(t, usr.Password)
+		}
+	}
+
+	usr, err := cache.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "123", models.StringValue(usr.ID))
+	}
+
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 1}, cache.Stats())
+
+	// mutating the returned user must not change the cached copy
+	*usr.Name = "Someone Else"
+
+	usr, err = cache.GetByID(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "User", models.StringValue(usr.Name))
+	}
+}
+
+func TestUserStoreCacheInvalidation(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+	newCachedTestUser(t, backing, "123", "wolfeidau")
+
+	cache := NewUserStoreCache(backing, 10, time.Minute)
+
+	_, err := cache.GetByID(context.Background(), "123")
+	assert.NoError(t, err)
+
+	err = cache.Update(context.Background(), &models.User{ID: models.String("123"), Login: models.String("markw")}, []string{FieldLogin})
+	assert.NoError(t, err)
+
+	usr, err := cache.GetByID(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "markw", models.StringValue(usr.Login))
+	}
+
+	// the old login is no longer cached
+	_, err = cache.GetByLogin(context.Background(), "wolfeidau")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	err = cache.Delete(context.Background(), "123")
+	assert.NoError(t, err)
+
+	_, err = cache.GetByID(context.Background(), "123")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	// writes which bypass the cache are only seen once the entry is invalidated
+	err = backing.Restore(context.Background(), "123")
+	assert.NoError(t, err)
+
+	_, err = cache.GetByLogin(context.Background(), "markw")
+	assert.NoError(t, err)
+
+	err = backing.Update(context.Background(), &models.User{ID: models.String("123"), Name: models.String("Mark")}, []string{FieldName})
+	assert.NoError(t, err)
+
+	usr, err = cache.GetByID(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "User", models.StringValue(usr.Name))
+	}
+
+	cache.Invalidate("123")
+
+	usr, err = cache.GetByID(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Mark", models.StringValue(usr.Name))
+	}
+}
+
+func TestUserStoreCacheEviction(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+	newCachedTestUser(t, backing, "1", "user1")
+	newCachedTestUser(t, backing, "2", "user2")
+	newCachedTestUser(t, backing, "3", "user3")
+
+	cache := NewUserStoreCache(backing, 2, time.Minute)
+
+	for _, id := range []string{"1", "2", "1", "3"} {
+		_, err := cache.GetByID(context.Background(), id)
+		assert.NoError(t, err)
+	}
+
+	// 2 was the least recently used so it was evicted
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 3}, cache.Stats())
+
+	cache.GetByID(context.Background(), "1")
+	cache.GetByID(context.Background(), "3")
+	cache.GetByID(context.Background(), "2")
+
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 4}, cache.Stats())
+}
+
+func TestUserStoreCacheTTL(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+	newCachedTestUser(t, backing, "123", "wolfeidau")
+
+	cache := NewUserStoreCache(backing, 10, time.Millisecond)
+
+	cache.GetByID(context.Background(), "123")
+
+	time.Sleep(5 * time.Millisecond)
+
+	cache.GetByID(context.Background(), "123")
+
+	assert.Equal(t, CacheStats{Hits: 0, Misses: 2}, cache.Stats())
+}
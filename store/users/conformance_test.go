@@ -0,0 +1,114 @@
+package users_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/wolfeidau/authinator/keyring"
+	"github.com/wolfeidau/authinator/store/pgtest"
+	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/store/users/storetest"
+)
+
+func TestUserStoreLocalConformance(t *testing.T) {
+	storetest.RunUserStoreSuite(t, func(t *testing.T) (users.UserStore, func()) {
+		return users.NewUserStoreLocal(), func() {}
+	})
+}
+
+func TestUserStoreCacheConformance(t *testing.T) {
+	storetest.RunUserStoreSuite(t, func(t *testing.T) (users.UserStore, func()) {
+		return users.NewUserStoreCache(users.NewUserStoreLocal(), 100, time.Minute), func() {}
+	})
+}
+
+func TestUserStoreMetricsConformance(t *testing.T) {
+	storetest.RunUserStoreSuite(t, func(t *testing.T) (users.UserStore, func()) {
+		return users.NewUserStoreMetrics(users.NewUserStoreLocal()), func() {}
+	})
+}
+
+func TestUserStoreEncryptedConformance(t *testing.T) {
+
+	keys, err := keyring.New(map[int][]byte{1: bytes.Repeat([]byte{1}, keyring.KeySize)}, bytes.Repeat([]byte{2}, keyring.KeySize))
+	if err != nil {
+		t.Fatalf("error creating keyring %v", err)
+	}
+
+	storetest.RunUserStoreSuite(t, func(t *testing.T) (users.UserStore, func()) {
+		return users.NewUserStoreEncrypted(users.NewUserStoreLocal(), keys), func() {}
+	})
+}
+
+func TestUserStoreBoltConformance(t *testing.T) {
+	storetest.RunUserStoreSuite(t, func(t *testing.T) (users.UserStore, func()) {
+		dir, err := ioutil.TempDir("", "authinator")
+		if err != nil {
+			t.Fatalf("error creating temp dir %v", err)
+		}
+
+		db, err := users.OpenBolt(filepath.Join(dir, "authinator.db"))
+		if err != nil {
+			t.Fatalf("error opening bolt %v", err)
+		}
+
+		return users.NewUserStoreBolt(db), func() {
+			db.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestUserStorePostgresConformance(t *testing.T) {
+	storetest.RunUserStoreSuite(t, func(t *testing.T) (users.UserStore, func()) {
+		db := pgtest.Open(t)
+
+		_, err := users.MigratePostgres(db)
+		if err != nil {
+			t.Fatalf("error migrating postgres %v", err)
+		}
+
+		return users.NewUserStorePostgres(db), func() {
+			db.Close()
+		}
+	})
+}
+
+func TestUserStoreRethinkDBConformance(t *testing.T) {
+
+	session, err := r.Connect(r.ConnectOpts{
+		Address: "localhost:28015",
+	})
+	if err != nil {
+		t.Skipf("rethinkdb not available %v", err)
+	}
+
+	users.DBName = "authinator_test"
+
+	r.DBCreate(users.DBName).Exec(session)
+	r.DB(users.DBName).TableCreate(users.TableName).Exec(session)
+	r.DB(users.DBName).Table(users.TableName).IndexCreate(users.LoginIndex).Exec(session)
+	r.DB(users.DBName).Table(users.TableName).IndexCreate(users.DeletedAtIndex).Exec(session)
+	r.DB(users.DBName).Table(users.TableName).IndexCreate(users.EmailIndex).Exec(session)
+	r.DB(users.DBName).Table(users.TableName).IndexWait().Exec(session)
+	r.DB(users.DBName).TableCreate(users.LoginsTableName).Exec(session)
+
+	storetest.RunUserStoreSuite(t, func(t *testing.T) (users.UserStore, func()) {
+		err := r.DB(users.DBName).Table(users.TableName).Delete().Exec(session)
+		if err != nil {
+			t.Fatalf("error clearing users table %v", err)
+		}
+
+		err = r.DB(users.DBName).Table(users.LoginsTableName).Delete().Exec(session)
+		if err != nil {
+			t.Fatalf("error clearing logins table %v", err)
+		}
+
+		return users.NewUserStoreRethinkDB(session), func() {}
+	})
+}
@@ -0,0 +1,323 @@
+package users
+
+import (
+	"context"
+	"time"
+
+	"github.com/wolfeidau/authinator/keyring"
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ UserStore = &UserStoreEncrypted{}
+
+// unencryptedPageSize is the number of users read at a time while looking for plaintext users
+const unencryptedPageSize = 100
+
+// UserStoreEncrypted encrypts the login, email and name of users before they reach the
+// underlying store and decrypts them on the way out.
+//
+// The underlying store sees the blind index of the login in place of the login, so lookups
+// and its uniqueness check work without decrypting, while the login itself is kept
+// encrypted in LoginCiphertext. The email also gets a blind index. Users stored before
+// encryption was enabled can't be found by login until they are encrypted with Rewrap,
+// Unencrypted lists them so the server can refuse to start while any remain.
+type UserStoreEncrypted struct {
+	store UserStore
+	keys  *keyring.Keyring
+}
+
+// NewUserStoreEncrypted create a user store which encrypts fields with the keyring
+func NewUserStoreEncrypted(store UserStore, keys *keyring.Keyring) *UserStoreEncrypted {
+	return &UserStoreEncrypted{store, keys}
+}
+
+// GetByID lookup a user by their Identifier
+func (ue *UserStoreEncrypted) GetByID(ctx context.Context, userID string) (*models.User, error) {
+	usr, err := ue.store.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ue.decrypt(usr)
+}
+
+// GetByLogin lookup a user by the blind index of their login
+func (ue *UserStoreEncrypted) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	usr, err := ue.store.GetByLogin(ctx, ue.loginIndex(login))
+	if err != nil {
+		return nil, err
+	}
+
+	return ue.decrypt(usr)
+}
+
+// List list and decrypt users from the underlying store
+func (ue *UserStoreEncrypted) List(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	list, err := ue.store.List(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, usr := range list {
+		list[i], err = ue.decrypt(usr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+// GetPasswordByLogin retrieve the users password using the blind index of their login
+func (ue *UserStoreEncrypted) GetPasswordByLogin(ctx context.Context, login string) (string, error) {
+	return ue.store.GetPasswordByLogin(ctx, ue.loginIndex(login))
+}
+
+// Create encrypt and create the user, the underlying store rejects a duplicate blind index
+// of the login
+func (ue *UserStoreEncrypted) Create(ctx context.Context, user *models.User) (*models.User, error) {
+
+	eusr, err := ue.encrypt(user, []string{FieldLogin, FieldEmail, FieldName})
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := ue.store.Create(ctx, eusr)
+	if err != nil {
+		return nil, err
+	}
+
+	return ue.decrypt(usr)
+}
+
+// Update encrypt the masked fields and update the user, the login ciphertext and blind
+// indexes are updated along with the login and email.
+func (ue *UserStoreEncrypted) Update(ctx context.Context, user *models.User, mask []string) error {
+
+	err := checkMask(mask)
+	if err != nil {
+		return err
+	}
+
+	eusr, err := ue.encrypt(user, mask)
+	if err != nil {
+		return err
+	}
+
+	// copy so the caller's mask isn't modified
+	mask = append([]string{}, mask...)
+
+	if hasField(mask, FieldLogin) {
+		mask = append(mask, FieldLoginCiphertext)
+	}
+
+	if hasField(mask, FieldEmail) {
+		mask = append(mask, FieldEmailIndex)
+	}
+
+	err = ue.store.Update(ctx, eusr, mask)
+	if err != nil {
+		return err
+	}
+
+	user.Version = eusr.Version
+
+	return nil
+}
+
+// Rewrap encrypt the fields of the user again if they are plaintext or were encrypted with
+// an old key, this returns false if the user didn't need rewrapping.
+func (ue *UserStoreEncrypted) Rewrap(ctx context.Context, userID string) (bool, error) {
+
+	cusr, err := ue.store.GetByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	var mask []string
+
+	if cusr.LoginCiphertext == nil || ue.keys.NeedsRewrap(*cusr.LoginCiphertext) {
+		mask = append(mask, FieldLogin)
+	}
+
+	if cusr.Email != nil && (cusr.EmailIndex == nil || ue.keys.NeedsRewrap(*cusr.Email)) {
+		mask = append(mask, FieldEmail)
+	}
+
+	if cusr.Name != nil && ue.keys.NeedsRewrap(*cusr.Name) {
+		mask = append(mask, FieldName)
+	}
+
+	if len(mask) == 0 {
+		return false, nil
+	}
+
+	usr, err := ue.decrypt(cusr)
+	if err != nil {
+		return false, err
+	}
+
+	return true, ue.Update(ctx, usr, mask)
+}
+
+// Delete delete the user from the underlying store
+func (ue *UserStoreEncrypted) Delete(ctx context.Context, userID string) error {
+	return ue.store.Delete(ctx, userID)
+}
+
+// Restore restore the user in the underlying store, a user deleted before encryption was
+// enabled is encrypted so they can sign in again.
+func (ue *UserStoreEncrypted) Restore(ctx context.Context, userID string) error {
+	err := ue.store.Restore(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = ue.Rewrap(ctx, userID)
+
+	return err
+}
+
+// Unencrypted list the IDs of the active users stored before encryption was enabled, they
+// have to be encrypted with Rewrap before they can sign in.
+func (ue *UserStoreEncrypted) Unencrypted(ctx context.Context) ([]string, error) {
+
+	var userIDs []string
+
+	after := ""
+
+	for {
+		page, err := ue.store.List(ctx, after, unencryptedPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, usr := range page {
+			if usr.LoginCiphertext == nil {
+				userIDs = append(userIDs, models.StringValue(usr.ID))
+			}
+		}
+
+		if len(page) < unencryptedPageSize {
+			return userIDs, nil
+		}
+
+		after = models.StringValue(page[len(page)-1].ID)
+	}
+}
+
+// Purge purge deleted users from the underlying store
+func (ue *UserStoreEncrypted) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return ue.store.Purge(ctx, deletedBefore)
+}
+
+// Erase erase the user from the underlying store
+func (ue *UserStoreEncrypted) Erase(ctx context.Context, userID string) error {
+	return ue.store.Erase(ctx, userID)
+}
+
+// Exists check if the login exists using its blind index
+func (ue *UserStoreEncrypted) Exists(ctx context.Context, login string) (bool, error) {
+	return ue.store.Exists(ctx, ue.loginIndex(login))
+}
+
+// Ping check the underlying store can be reached
+func (ue *UserStoreEncrypted) Ping(ctx context.Context) error {
+	return ue.store.Ping(ctx)
+}
+
+// RecordLogin record the login in the underlying store
+func (ue *UserStoreEncrypted) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error {
+	return ue.store.RecordLogin(ctx, userID, at, ip)
+}
+
+func (ue *UserStoreEncrypted) loginIndex(login string) string {
+	return ue.keys.BlindIndex(FieldLogin, login)
+}
+
+// encrypt copy the user encrypting the masked fields
+func (ue *UserStoreEncrypted) encrypt(user *models.User, mask []string) (*models.User, error) {
+	usr := copyUser(user)
+
+	var err error
+
+	if hasField(mask, FieldLogin) && usr.Login != nil {
+		usr.LoginCiphertext, err = ue.encryptField(FieldLogin, usr.Login)
+		if err != nil {
+			return nil, err
+		}
+		usr.Login = models.String(ue.loginIndex(*usr.Login))
+	}
+
+	if hasField(mask, FieldEmail) && usr.Email != nil {
+		usr.EmailIndex = models.String(ue.keys.BlindIndex(FieldEmail, *usr.Email))
+		usr.Email, err = ue.encryptField(FieldEmail, usr.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if hasField(mask, FieldName) {
+		usr.Name, err = ue.encryptField(FieldName, usr.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return usr, nil
+}
+
+func (ue *UserStoreEncrypted) encryptField(field string, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	ciphertext, err := ue.keys.Encrypt(field, *value)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.String(ciphertext), nil
+}
+
+// decrypt decrypt the fields of the user from the underlying store, plaintext values are
+// returned unchanged.
+func (ue *UserStoreEncrypted) decrypt(usr *models.User) (*models.User, error) {
+
+	var err error
+
+	if usr.LoginCiphertext != nil {
+		usr.Login, err = ue.decryptField(FieldLogin, usr.LoginCiphertext)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	usr.Email, err = ue.decryptField(FieldEmail, usr.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	usr.Name, err = ue.decryptField(FieldName, usr.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	usr.LoginCiphertext = nil
+	usr.EmailIndex = nil
+
+	return usr, nil
+}
+
+func (ue *UserStoreEncrypted) decryptField(field string, value *string) (*string, error) {
+	if value == nil || !keyring.IsEncrypted(*value) {
+		return value, nil
+	}
+
+	plaintext, err := ue.keys.Decrypt(field, *value)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.String(plaintext), nil
+}
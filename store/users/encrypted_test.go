@@ -0,0 +1,183 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/keyring"
+	"github.com/wolfeidau/authinator/models"
+)
+
+func newTestKeyring(t *testing.T, versions ...int) *keyring.Keyring {
+	keys := map[int][]byte{}
+
+	for _, v := range versions {
+		keys[v] = bytes.Repeat([]byte{byte(v)}, keyring.KeySize)
+	}
+
+	kr, err := keyring.New(keys, bytes.Repeat([]byte{0xff}, keyring.KeySize))
+	if err != nil {
+		t.Fatalf("error creating keyring %v", err)
+	}
+
+	return kr
+}
+
+func TestUserStoreEncryptedStoresCiphertext(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+	userStore := NewUserStoreEncrypted(backing, newTestKeyring(t, 1))
+
+	usr := models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+
+	nusr, err := userStore.Create(context.Background(), usr)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "wolfeidau", models.StringValue(nusr.Login))
+		assert.Equal(t, "mark@wolfe.id.au", models.StringValue(nusr.Email))
+		assert.Nil(t, nusr.LoginCiphertext)
+	}
+
+	raw, err := backing.GetByID(context.Background(), "123")
+	if assert.NoError(t, err) {
+		for _, v := range []*string{raw.Login, raw.Email, raw.Name, raw.LoginCiphertext} {
+			assert.False(t, strings.Contains(models.StringValue(v), "wolfe"), "plaintext stored %s", models.StringValue(v))
+		}
+		assert.NotNil(t, raw.EmailIndex)
+	}
+
+	cusr, err := userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Mark Wolfe", models.StringValue(cusr.Name))
+		assert.Nil(t, cusr.LoginCiphertext)
+		assert.Nil(t, cusr.EmailIndex)
+	}
+}
+
+func TestUserStoreEncryptedPlaintextUsers(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+
+	_, err := backing.Create(context.Background(), models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	userStore := NewUserStoreEncrypted(backing, newTestKeyring(t, 1))
+
+	// users stored before encryption are found by ID but not by login until rewrapped
+	usr, err := userStore.GetByID(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mark@wolfe.id.au", models.StringValue(usr.Email))
+	}
+
+	_, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+	assert.Equal(t, ErrUserNotFound, err)
+
+	userIDs, err := userStore.Unencrypted(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"123"}, userIDs)
+	}
+
+	rewrapped, err := userStore.Rewrap(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.True(t, rewrapped)
+	}
+
+	raw, _ := backing.GetByID(context.Background(), "123")
+	assert.True(t, keyring.IsEncrypted(models.StringValue(raw.Email)))
+	assert.NotEqual(t, "wolfeidau", models.StringValue(raw.Login))
+	assert.NotNil(t, raw.EmailIndex)
+
+	userIDs, err = userStore.Unencrypted(context.Background())
+	if assert.NoError(t, err) {
+		assert.Empty(t, userIDs)
+	}
+
+	usr, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "123", models.StringValue(usr.ID))
+		assert.Equal(t, "Mark Wolfe", models.StringValue(usr.Name))
+	}
+
+	exists, err := userStore.Exists(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.True(t, exists)
+	}
+
+	// the underlying store rejects the duplicate blind index
+	_, err = userStore.Create(context.Background(), models.NewUser("456", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	assert.Equal(t, ErrUserAlreadyExists, err)
+}
+
+func TestUserStoreEncryptedRestoreEncryptsPlaintextUsers(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+
+	_, err := backing.Create(context.Background(), models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = backing.Delete(context.Background(), "123")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	userStore := NewUserStoreEncrypted(backing, newTestKeyring(t, 1))
+
+	err = userStore.Restore(context.Background(), "123")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	raw, _ := backing.GetByID(context.Background(), "123")
+	assert.NotNil(t, raw.LoginCiphertext)
+	assert.True(t, keyring.IsEncrypted(models.StringValue(raw.Email)))
+
+	usr, err := userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "123", models.StringValue(usr.ID))
+	}
+}
+
+func TestUserStoreEncryptedRewrap(t *testing.T) {
+
+	backing := NewUserStoreLocal()
+
+	_, err := NewUserStoreEncrypted(backing, newTestKeyring(t, 1)).Create(context.Background(), models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	kr := newTestKeyring(t, 1, 2)
+	userStore := NewUserStoreEncrypted(backing, kr)
+
+	// old keys still decrypt after a rotation
+	usr, err := userStore.GetByID(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "wolfeidau", models.StringValue(usr.Login))
+	}
+
+	rewrapped, err := userStore.Rewrap(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.True(t, rewrapped)
+	}
+
+	raw, _ := backing.GetByID(context.Background(), "123")
+	assert.False(t, kr.NeedsRewrap(models.StringValue(raw.LoginCiphertext)))
+	assert.False(t, kr.NeedsRewrap(models.StringValue(raw.Email)))
+	assert.False(t, kr.NeedsRewrap(models.StringValue(raw.Name)))
+
+	rewrapped, err = userStore.Rewrap(context.Background(), "123")
+	if assert.NoError(t, err) {
+		assert.False(t, rewrapped)
+	}
+
+	usr, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mark@wolfe.id.au", models.StringValue(usr.Email))
+	}
+}
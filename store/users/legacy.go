@@ -0,0 +1,145 @@
+package users
+
+import (
+	"context"
+	"time"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ UserStore = &legacyUserStore{}
+
+// LegacyUserStore is the user store interface before contexts were added, it is
+// retained so out of tree stores can be used while they are migrated.
+//
+// Deprecated: implement UserStore instead.
+type LegacyUserStore interface {
+	GetByID(userID string) (*models.User, error)
+	GetByLogin(login string) (*models.User, error)
+	GetPasswordByLogin(login string) (string, error)
+	Create(user *models.User) (*models.User, error)
+	Update(user *models.User) error
+	Delete(userID string) error
+	Exists(login string) (bool, error)
+	RecordLogin(userID string, at time.Time, ip string) error
+}
+
+// Pinger can be implemented by a LegacyUserStore to report whether its backend can be reached
+type Pinger interface {
+	Ping() error
+}
+
+// FromLegacy adapt a LegacyUserStore to the UserStore interface, the legacy store
+// can't be interrupted so the context is only checked before each call.
+func FromLegacy(store LegacyUserStore) UserStore {
+	return &legacyUserStore{store}
+}
+
+type legacyUserStore struct {
+	store LegacyUserStore
+}
+
+func (ls *legacyUserStore) GetByID(ctx context.Context, userID string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ls.store.GetByID(userID)
+}
+
+func (ls *legacyUserStore) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ls.store.GetByLogin(login)
+}
+
+func (ls *legacyUserStore) GetPasswordByLogin(ctx context.Context, login string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return ls.store.GetPasswordByLogin(login)
+}
+
+func (ls *legacyUserStore) Create(ctx context.Context, user *models.User) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ls.store.Create(user)
+}
+
+// Update legacy stores apply the non nil fields so only the masked fields are passed
+func (ls *legacyUserStore) Update(ctx context.Context, user *models.User, mask []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	usr := &models.User{ID: user.ID, Version: user.Version}
+
+	err := applyMask(usr, user, mask)
+	if err != nil {
+		return err
+	}
+
+	err = ls.store.Update(usr)
+	user.Version = usr.Version
+
+	return err
+}
+
+func (ls *legacyUserStore) Delete(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ls.store.Delete(userID)
+}
+
+// Erase legacy stores delete users immediately
+func (ls *legacyUserStore) Erase(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ls.store.Delete(userID)
+}
+
+// List legacy stores can't list users
+func (ls *legacyUserStore) List(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	return nil, ErrNotSupported
+}
+
+// Restore legacy stores can't restore deleted users
+func (ls *legacyUserStore) Restore(ctx context.Context, userID string) error {
+	return ErrNotSupported
+}
+
+// Purge legacy stores delete users immediately so there is nothing to purge
+func (ls *legacyUserStore) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return 0, ErrNotSupported
+}
+
+func (ls *legacyUserStore) Exists(ctx context.Context, login string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return ls.store.Exists(login)
+}
+
+// Ping check the legacy store can be reached if it implements Pinger, otherwise it is
+// reported as reachable
+func (ls *legacyUserStore) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if pinger, ok := ls.store.(Pinger); ok {
+		return pinger.Ping()
+	}
+
+	return nil
+}
+
+func (ls *legacyUserStore) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ls.store.RecordLogin(userID, at, ip)
+}
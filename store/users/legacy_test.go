@@ -0,0 +1,58 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+)
+
+type legacyGetByID struct {
+	LegacyUserStore
+	calls int
+}
+
+func (lg *legacyGetByID) GetByID(userID string) (*models.User, error) {
+	lg.calls++
+	return &models.User{ID: models.String(userID)}, nil
+}
+
+func TestFromLegacy(t *testing.T) {
+
+	legacy := &legacyGetByID{}
+	userStore := FromLegacy(legacy)
+
+	usr, err := userStore.GetByID(context.Background(), "123")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "123", models.StringValue(usr.ID))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = userStore.GetByID(ctx, "123")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, legacy.calls)
+}
+
+type legacyPinger struct {
+	LegacyUserStore
+	err error
+}
+
+func (lp *legacyPinger) Ping() error {
+	return lp.err
+}
+
+func TestFromLegacyPing(t *testing.T) {
+
+	// stores without Ping are reported as reachable without calling them
+	assert.NoError(t, FromLegacy(&legacyGetByID{}).Ping(context.Background()))
+
+	unreachable := errors.New("connection refused")
+
+	assert.Equal(t, unreachable, FromLegacy(&legacyPinger{err: unreachable}).Ping(context.Background()))
+	assert.NoError(t, FromLegacy(&legacyPinger{}).Ping(context.Background()))
+}
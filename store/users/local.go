@@ -1,9 +1,11 @@
 package users
 
 import (
-	"crypto/sha1"
-	"fmt"
-	"reflect"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/wolfeidau/authinator/models"
@@ -11,87 +13,269 @@ import (
 
 var _ UserStore = &UserStoreLocal{}
 
-// UserStoreLocal local user store for testing purposes
+// UserStoreLocal in memory user store for testing purposes and small single node
+// deployments, it is safe for concurrent use.
 //
-// NOTE: This will return passwords because pointers are used.
+// Users are copied on the way in and out so callers never share the stored
+// records, passwords are only returned by GetPasswordByLogin. Operations never block on
+// IO so the context arguments are ignored.
 type UserStoreLocal struct {
-	users map[string]*models.User
+	sync.RWMutex
+	users  map[string]*models.User
+	logins map[string]string
 }
 
 // NewUserStoreLocal create a new local user store
 func NewUserStoreLocal() UserStore {
-	return &UserStoreLocal{users: make(map[string]*models.User)}
+	return &UserStoreLocal{
+		users:  make(map[string]*models.User),
+		logins: make(map[string]string),
+	}
 }
 
 // GetByID lookup a user by thier Identifier
-func (usl *UserStoreLocal) GetByID(userID string) (*models.User, error) {
-	usr, ok := usl.users[userID]
+func (usl *UserStoreLocal) GetByID(ctx context.Context, userID string) (*models.User, error) {
+	usl.RLock()
+	defer usl.RUnlock()
+
+	usr, ok := usl.active(userID)
 
 	if !ok {
 		return nil, ErrUserNotFound
 	}
 
-	return usr, nil
+	return copyUserWithoutPassword(usr), nil
 }
 
 // GetByLogin lookup a user by their login
-func (usl *UserStoreLocal) GetByLogin(login string) (*models.User, error) {
-	for _, v := range usl.users {
-		if reflect.DeepEqual(v.Login, models.String(login)) {
-			return v, nil
-		}
+func (usl *UserStoreLocal) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	usl.RLock()
+	defer usl.RUnlock()
+
+	usr, ok := usl.active(usl.logins[login])
+
+	if !ok {
+		return nil, ErrUserNotFound
 	}
-	return nil, ErrUserNotFound
 
+	return copyUserWithoutPassword(usr), nil
 }
 
 // GetPasswordByLogin retrieve the users password for authentication
-func (usl *UserStoreLocal) GetPasswordByLogin(login string) (string, error) {
-	for _, v := range usl.users {
-		if reflect.DeepEqual(v.Login, models.String(login)) {
-			return models.StringValue(v.Password), nil
+func (usl *UserStoreLocal) GetPasswordByLogin(ctx context.Context, login string) (string, error) {
+	usl.RLock()
+	defer usl.RUnlock()
+
+	usr, ok := usl.active(usl.logins[login])
+
+	if !ok {
+		return "", ErrUserNotFound
+	}
+
+	return models.StringValue(usr.Password), nil
+}
+
+// List list the active users ordered by ID after the given ID
+func (usl *UserStoreLocal) List(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	usl.RLock()
+	defer usl.RUnlock()
+
+	ids := []string{}
+
+	for id, usr := range usl.users {
+		if id > after && usr.DeletedAt == nil {
+			ids = append(ids, id)
 		}
 	}
-	return "", ErrUserNotFound
+
+	sort.Strings(ids)
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	list := []*models.User{}
+
+	for _, id := range ids {
+		list = append(list, copyUserWithoutPassword(usl.users[id]))
+	}
+
+	return list, nil
 }
 
 // Create create a new user in the system with the given information
-func (usl *UserStoreLocal) Create(user *models.User) (*models.User, error) {
+func (usl *UserStoreLocal) Create(ctx context.Context, user *models.User) (*models.User, error) {
+	usl.Lock()
+	defer usl.Unlock()
 
-	var id string
+	login := models.StringValue(user.Login)
 
 	// check for unique login
-	if usl.loginExists(models.StringValue(user.Login)) {
+	if _, ok := usl.logins[login]; ok {
+		return nil, ErrUserAlreadyExists
+	}
+
+	usr := copyUser(user)
+
+	if usr.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		usr.ID = models.String(id)
+	}
+
+	usr.Version = models.Int64(1)
+
+	id := models.StringValue(usr.ID)
+
+	if _, ok := usl.users[id]; ok {
 		return nil, ErrUserAlreadyExists
 	}
 
-	if user.ID == nil {
-		id = newID()
-		user.ID = models.String(id)
-	} else {
-		id = models.StringValue(user.ID)
+	usl.users[id] = usr
+	usl.logins[login] = id
+
+	return copyUser(usr), nil
+}
+
+// Update set the masked fields of the user
+func (usl *UserStoreLocal) Update(ctx context.Context, user *models.User, mask []string) error {
+	usl.Lock()
+	defer usl.Unlock()
+
+	cusr, ok := usl.active(models.StringValue(user.ID))
+
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	if user.Version != nil && *user.Version != models.Int64Value(cusr.Version) {
+		return ErrConflict
+	}
+
+	// replace rather than modify the stored record so copies handed out stay unchanged
+	usr := copyUser(cusr)
+	usr.Version = models.Int64(models.Int64Value(cusr.Version) + 1)
+
+	err := applyMask(usr, user, mask)
+	if err != nil {
+		return err
+	}
+
+	id := models.StringValue(usr.ID)
+	oldLogin, newLogin := models.StringValue(cusr.Login), models.StringValue(usr.Login)
+
+	if oldLogin != newLogin {
+		if _, ok := usl.logins[newLogin]; ok {
+			return ErrUserAlreadyExists
+		}
+
+		delete(usl.logins, oldLogin)
+		usl.logins[newLogin] = id
 	}
 
-	usl.users[id] = user
+	usl.users[id] = usr
 
-	return user, nil
+	user.Version = models.Int64(*usr.Version)
+
+	return nil
 }
 
-// Update the user, this is currently limited to changing the users name.
-func (usl *UserStoreLocal) Update(user *models.User) error {
-	cusr, ok := usl.users[models.StringValue(user.ID)]
+// Delete soft delete the user by user ID
+func (usl *UserStoreLocal) Delete(ctx context.Context, userID string) error {
+	usl.Lock()
+	defer usl.Unlock()
+
+	cusr, ok := usl.active(userID)
 
 	if !ok {
 		return ErrUserNotFound
 	}
 
-	cusr.Name = user.Name
+	now := time.Now()
+
+	usr := copyUser(cusr)
+	usr.DeletedAt = &now
+	usr.Version = models.Int64(models.Int64Value(cusr.Version) + 1)
+
+	if !ReserveDeletedLogins {
+		delete(usl.logins, models.StringValue(usr.Login))
+	}
+
+	usl.users[userID] = usr
+
+	return nil
+}
+
+// Restore undo the soft delete of the user
+func (usl *UserStoreLocal) Restore(ctx context.Context, userID string) error {
+	usl.Lock()
+	defer usl.Unlock()
+
+	cusr, ok := usl.users[userID]
+
+	if !ok || cusr.DeletedAt == nil {
+		return ErrUserNotFound
+	}
+
+	login := models.StringValue(cusr.Login)
+
+	if id, ok := usl.logins[login]; ok && id != userID {
+		return ErrUserAlreadyExists
+	}
+
+	usr := copyUser(cusr)
+	usr.DeletedAt = nil
+	usr.Version = models.Int64(models.Int64Value(cusr.Version) + 1)
+
+	usl.logins[login] = userID
+	usl.users[userID] = usr
 
 	return nil
 }
 
-// Delete delete the user by user ID
-func (usl *UserStoreLocal) Delete(userID string) error {
+// Purge permanently erase the users deleted before the given time
+func (usl *UserStoreLocal) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	usl.Lock()
+	defer usl.Unlock()
+
+	purged := 0
+
+	for id, usr := range usl.users {
+		if usr.DeletedAt == nil || !usr.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		login := models.StringValue(usr.Login)
+
+		if usl.logins[login] == id {
+			delete(usl.logins, login)
+		}
+
+		delete(usl.users, id)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Erase permanently erase the user and release their login
+func (usl *UserStoreLocal) Erase(ctx context.Context, userID string) error {
+	usl.Lock()
+	defer usl.Unlock()
+
+	usr, ok := usl.users[userID]
+
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	login := models.StringValue(usr.Login)
+
+	if usl.logins[login] == userID {
+		delete(usl.logins, login)
+	}
 
 	delete(usl.users, userID)
 
@@ -99,23 +283,111 @@ func (usl *UserStoreLocal) Delete(userID string) error {
 }
 
 // Exists Check if a user exists using the users login
-func (usl *UserStoreLocal) Exists(login string) (bool, error) {
-	return usl.loginExists(login), nil
+func (usl *UserStoreLocal) Exists(ctx context.Context, login string) (bool, error) {
+	usl.RLock()
+	defer usl.RUnlock()
+
+	_, ok := usl.logins[login]
+
+	return ok, nil
 }
 
-func (usl *UserStoreLocal) loginExists(login string) bool {
-	for _, v := range usl.users {
-		if reflect.DeepEqual(v.Login, models.String(login)) {
-			return true
-		}
+// Ping the local store is always reachable
+func (usl *UserStoreLocal) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// RecordLogin update the last login time and IP address of the user
+func (usl *UserStoreLocal) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error {
+	usl.Lock()
+	defer usl.Unlock()
+
+	cusr, ok := usl.active(userID)
+
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	usr := copyUser(cusr)
+
+	usr.LastLoginAt = &at
+	usr.LastLoginIP = models.String(ip)
+
+	usl.users[userID] = usr
+
+	return nil
+}
+
+// active lookup the user by ID ignoring soft deleted users
+func (usl *UserStoreLocal) active(userID string) (*models.User, bool) {
+	usr, ok := usl.users[userID]
+	if !ok || usr.DeletedAt != nil {
+		return nil, false
+	}
+	return usr, true
+}
+
+// copyUser deep copy the user so no pointers are shared with the caller
+func copyUser(usr *models.User) *models.User {
+	cp := &models.User{
+		ID:          copyString(usr.ID),
+		Login:       copyString(usr.Login),
+		Email:       copyString(usr.Email),
+		Name:        copyString(usr.Name),
+		Password:    copyString(usr.Password),
+		LastLoginIP: copyString(usr.LastLoginIP),
+
+		LastLoginAt: copyTime(usr.LastLoginAt),
+		DeletedAt:   copyTime(usr.DeletedAt),
+		DisabledAt:  copyTime(usr.DisabledAt),
+		Roles:       copyStrings(usr.Roles),
+
+		LoginCiphertext: copyString(usr.LoginCiphertext),
+		EmailIndex:      copyString(usr.EmailIndex),
+	}
+
+	if usr.Version != nil {
+		cp.Version = models.Int64(*usr.Version)
+	}
+
+	return cp
+}
+
+func copyUserWithoutPassword(usr *models.User) *models.User {
+	cp := copyUser(usr)
+	cp.Password = nil
+	return cp
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	return models.String(*s)
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
 	}
-	return false
+	ct := *t
+	return &ct
 }
 
-func newID() string {
-	h := sha1.New()
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
 
-	c := []byte(time.Now().String())
+func newID() (string, error) {
+	buf := make([]byte, 20)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
 
-	return fmt.Sprintf("%x", h.Sum(c))
+	return hex.EncodeToString(buf), nil
 }
@@ -0,0 +1,95 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+)
+
+func TestLocalStoreCopiesUsers(t *testing.T) {
+
+	userStore := NewUserStoreLocal()
+
+	usr := models.NewUser("", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+	usr.ID = nil
+	usr.Password = models.String("LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP")
+
+	nusr, err := userStore.Create(context.Background(), usr)
+	if assert.NoError(t, err) {
+
+		// mutating the caller's copies must not change the stored record
+		*usr.Name = "Someone Else"
+		*nusr.Name = "Someone Else"
+
+		cusr, err := userStore.GetByID(context.Background(), models.StringValue(nusr.ID))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Mark Wolfe", models.StringValue(cusr.Name))
+			assert.Nil(t, cusr.Password)
+
+			*cusr.Name = "Someone Else"
+		}
+
+		cusr, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Mark Wolfe", models.StringValue(cusr.Name))
+			assert.Nil(t, cusr.Password)
+		}
+
+		pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP", pass)
+		}
+	}
+}
+
+func TestLocalStoreConcurrentAccess(t *testing.T) {
+
+	userStore := NewUserStoreLocal()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			login := fmt.Sprintf("user%d", i%10)
+
+			// half of these collide on login so only one of each pair is created
+			usr, err := userStore.Create(context.Background(), models.NewUser(fmt.Sprintf("%d", i), login, login+"@example.com", "User"))
+			if err != nil {
+				assert.Equal(t, ErrUserAlreadyExists, err)
+				return
+			}
+
+			for j := 0; j < 50; j++ {
+				id := models.StringValue(usr.ID)
+
+				userStore.Update(context.Background(), &models.User{ID: usr.ID, Name: models.String(fmt.Sprintf("User %d", j))}, []string{FieldName})
+				userStore.GetByID(context.Background(), id)
+				userStore.GetByLogin(context.Background(), login)
+				userStore.Exists(context.Background(), login)
+			}
+
+			userStore.Delete(context.Background(), models.StringValue(usr.ID))
+		}(i)
+	}
+
+	wg.Wait()
+
+	_, err := userStore.Purge(context.Background(), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		exists, err := userStore.Exists(context.Background(), fmt.Sprintf("user%d", i))
+		if assert.NoError(t, err) {
+			assert.False(t, exists)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package users
+
+import (
+	"context"
+	"time"
+
+	"github.com/wolfeidau/authinator/metrics"
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ UserStore = &UserStoreMetrics{}
+
+// UserStoreMetrics records the latency and result of each operation on another user store
+type UserStoreMetrics struct {
+	store UserStore
+}
+
+// NewUserStoreMetrics create a user store which records metrics for the store
+func NewUserStoreMetrics(store UserStore) *UserStoreMetrics {
+	return &UserStoreMetrics{store}
+}
+
+func observeOperation(operation string, start time.Time, err error) {
+	metrics.ObserveStoreOperation("users", operation, start, err, ErrUserNotFound)
+}
+
+// GetByID lookup a user by their Identifier
+func (um *UserStoreMetrics) GetByID(ctx context.Context, userID string) (usr *models.User, err error) {
+	defer func(start time.Time) { observeOperation("get_by_id", start, err) }(time.Now())
+	return um.store.GetByID(ctx, userID)
+}
+
+// GetByLogin lookup a user by their login
+func (um *UserStoreMetrics) GetByLogin(ctx context.Context, login string) (usr *models.User, err error) {
+	defer func(start time.Time) { observeOperation("get_by_login", start, err) }(time.Now())
+	return um.store.GetByLogin(ctx, login)
+}
+
+// GetPasswordByLogin retrieve the users password
+func (um *UserStoreMetrics) GetPasswordByLogin(ctx context.Context, login string) (pass string, err error) {
+	defer func(start time.Time) { observeOperation("get_password_by_login", start, err) }(time.Now())
+	return um.store.GetPasswordByLogin(ctx, login)
+}
+
+// List a page of users
+func (um *UserStoreMetrics) List(ctx context.Context, after string, limit int) (list []*models.User, err error) {
+	defer func(start time.Time) { observeOperation("list", start, err) }(time.Now())
+	return um.store.List(ctx, after, limit)
+}
+
+// Create create the user
+func (um *UserStoreMetrics) Create(ctx context.Context, user *models.User) (usr *models.User, err error) {
+	defer func(start time.Time) { observeOperation("create", start, err) }(time.Now())
+	return um.store.Create(ctx, user)
+}
+
+// Update update the masked fields of the user
+func (um *UserStoreMetrics) Update(ctx context.Context, user *models.User, mask []string) (err error) {
+	defer func(start time.Time) { observeOperation("update", start, err) }(time.Now())
+	return um.store.Update(ctx, user, mask)
+}
+
+// Delete soft delete the user
+func (um *UserStoreMetrics) Delete(ctx context.Context, userID string) (err error) {
+	defer func(start time.Time) { observeOperation("delete", start, err) }(time.Now())
+	return um.store.Delete(ctx, userID)
+}
+
+// Restore restore a deleted user
+func (um *UserStoreMetrics) Restore(ctx context.Context, userID string) (err error) {
+	defer func(start time.Time) { observeOperation("restore", start, err) }(time.Now())
+	return um.store.Restore(ctx, userID)
+}
+
+// Purge erase the users deleted before the time
+func (um *UserStoreMetrics) Purge(ctx context.Context, deletedBefore time.Time) (n int, err error) {
+	defer func(start time.Time) { observeOperation("purge", start, err) }(time.Now())
+	return um.store.Purge(ctx, deletedBefore)
+}
+
+// Erase permanently erase the user
+func (um *UserStoreMetrics) Erase(ctx context.Context, userID string) (err error) {
+	defer func(start time.Time) { observeOperation("erase", start, err) }(time.Now())
+	return um.store.Erase(ctx, userID)
+}
+
+// Exists check if the login exists
+func (um *UserStoreMetrics) Exists(ctx context.Context, login string) (exists bool, err error) {
+	defer func(start time.Time) { observeOperation("exists", start, err) }(time.Now())
+	return um.store.Exists(ctx, login)
+}
+
+// RecordLogin record the login of the user
+func (um *UserStoreMetrics) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) (err error) {
+	defer func(start time.Time) { observeOperation("record_login", start, err) }(time.Now())
+	return um.store.RecordLogin(ctx, userID, at, ip)
+}
+
+// Ping check the store can be reached
+func (um *UserStoreMetrics) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { observeOperation("ping", start, err) }(time.Now())
+	return um.store.Ping(ctx)
+}
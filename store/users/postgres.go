@@ -0,0 +1,377 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/wolfeidau/authinator/models"
+)
+
+var _ UserStore = &UserStorePostgres{}
+
+const (
+	// pgUniqueViolation is the PostgreSQL error code raised by unique indexes
+	pgUniqueViolation = "23505"
+
+	userColumns = "id, login, email, name, last_login_at, last_login_ip, version, login_ciphertext, email_index, disabled_at, roles"
+)
+
+// UserStorePostgres PostgreSQL based user store
+type UserStorePostgres struct {
+	db *sql.DB
+}
+
+// NewUserStorePostgres create a new PostgreSQL backed user store, the schema is
+// created using MigratePostgres.
+func NewUserStorePostgres(db *sql.DB) UserStore {
+	return &UserStorePostgres{db}
+}
+
+// GetByID retrieve a user from PostgreSQL
+func (us *UserStorePostgres) GetByID(ctx context.Context, userID string) (*models.User, error) {
+	row := us.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 AND deleted_at IS NULL", userID)
+	return scanUser(row)
+}
+
+// GetByLogin retrieve a user from PostgreSQL using their login
+func (us *UserStorePostgres) GetByLogin(ctx context.Context, login string) (*models.User, error) {
+	row := us.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE login = $1 AND deleted_at IS NULL", login)
+	return scanUser(row)
+}
+
+// GetPasswordByLogin retrieve the password for a user using their login
+func (us *UserStorePostgres) GetPasswordByLogin(ctx context.Context, login string) (string, error) {
+	var password sql.NullString
+
+	err := us.db.QueryRowContext(ctx, "SELECT password FROM users WHERE login = $1 AND deleted_at IS NULL", login).Scan(&password)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return password.String, nil
+}
+
+// List list the active users from PostgreSQL ordered by ID after the given ID
+func (us *UserStorePostgres) List(ctx context.Context, after string, limit int) ([]*models.User, error) {
+	rows, err := us.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE id > $1 AND deleted_at IS NULL ORDER BY id LIMIT $2",
+		after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []*models.User{}
+
+	for rows.Next() {
+		usr, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, usr)
+	}
+
+	return list, rows.Err()
+}
+
+// Create create the user in PostgreSQL, the unique index on login rejects duplicates
+// among active users while logins of deleted users are checked by the insert.
+func (us *UserStorePostgres) Create(ctx context.Context, user *models.User) (*models.User, error) {
+
+	if user.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		user.ID = models.String(id)
+	}
+
+	user.Version = models.Int64(1)
+
+	res, err := us.db.ExecContext(ctx, `INSERT INTO users (id, login, email, name, password, version, login_ciphertext, email_index, roles)
+		SELECT $1, $2, $3, $4, $5, $6, $8, $9, $10
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE login = $2 AND deleted_at IS NOT NULL AND $7)`,
+		models.StringValue(user.ID), models.StringValue(user.Login), models.StringValue(user.Email),
+		nullString(user.Name), models.StringValue(user.Password), *user.Version, ReserveDeletedLogins,
+		nullString(user.LoginCiphertext), nullString(user.EmailIndex), nullStrings(user.Roles))
+	if err != nil {
+		return nil, mapPostgresError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// the login is reserved by a deleted user
+	if n == 0 {
+		return nil, ErrUserAlreadyExists
+	}
+
+	return user, nil
+}
+
+// Update set the masked fields of the user in PostgreSQL, the unique index on login
+// rejects a login which is already taken by an active user and the update only matches
+// if no deleted user holds the new login.
+func (us *UserStorePostgres) Update(ctx context.Context, user *models.User, mask []string) error {
+
+	err := checkMask(mask)
+	if err != nil {
+		return err
+	}
+
+	set := []string{"version = version + 1"}
+	where := "id = $1 AND deleted_at IS NULL AND ($2::BIGINT IS NULL OR version = $2)"
+	args := []interface{}{models.StringValue(user.ID), nullInt64(user.Version)}
+
+	for _, f := range mask {
+		switch v := maskField(user, f).(type) {
+		case *string:
+			args = append(args, nullString(v))
+		case *time.Time:
+			args = append(args, nullTime(v))
+		case []string:
+			args = append(args, nullStrings(v))
+		}
+		// the column names match the mask fields which have been checked above
+		set = append(set, fmt.Sprintf("%s = $%d", f, len(args)))
+
+		// the login of a deleted user is checked in the same statement as the update
+		if f == FieldLogin && ReserveDeletedLogins {
+			where += fmt.Sprintf(" AND NOT EXISTS (SELECT 1 FROM users d WHERE d.login = $%d AND d.deleted_at IS NOT NULL AND d.id <> $1)", len(args))
+		}
+	}
+
+	var version int64
+
+	err = us.db.QueryRowContext(ctx, "UPDATE users SET "+strings.Join(set, ", ")+
+		" WHERE "+where+" RETURNING version", args...).Scan(&version)
+	if err == sql.ErrNoRows {
+		return us.updateFailure(ctx, user, mask)
+	}
+	if err != nil {
+		return mapPostgresError(err)
+	}
+
+	user.Version = models.Int64(version)
+
+	return nil
+}
+
+// updateFailure find why an update matched no rows, the user is missing, the login is
+// reserved by a deleted user or the version is stale
+func (us *UserStorePostgres) updateFailure(ctx context.Context, user *models.User, mask []string) error {
+
+	_, err := us.GetByID(ctx, models.StringValue(user.ID))
+	if err != nil {
+		return err
+	}
+
+	if hasField(mask, FieldLogin) && ReserveDeletedLogins {
+		var reserved bool
+
+		err = us.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE login = $1 AND deleted_at IS NOT NULL AND id <> $2)",
+			models.StringValue(user.Login), models.StringValue(user.ID)).Scan(&reserved)
+		if err != nil {
+			return err
+		}
+
+		if reserved {
+			return ErrUserAlreadyExists
+		}
+	}
+
+	return ErrConflict
+}
+
+// Delete soft delete the user in the PostgreSQL database.
+func (us *UserStorePostgres) Delete(ctx context.Context, userID string) error {
+	res, err := us.db.ExecContext(ctx, "UPDATE users SET deleted_at = $2, version = version + 1 WHERE id = $1 AND deleted_at IS NULL",
+		userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Restore undo the soft delete of the user in the PostgreSQL database, the unique
+// index on login rejects the restore if another user has taken the login.
+func (us *UserStorePostgres) Restore(ctx context.Context, userID string) error {
+	res, err := us.db.ExecContext(ctx, "UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL",
+		userID)
+	if err != nil {
+		return mapPostgresError(err)
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Purge permanently erase the users deleted before the given time from PostgreSQL
+func (us *UserStorePostgres) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	res, err := us.db.ExecContext(ctx, "DELETE FROM users WHERE deleted_at < $1", deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return int(n), err
+}
+
+// Erase permanently erase the user from the PostgreSQL database.
+func (us *UserStorePostgres) Erase(ctx context.Context, userID string) error {
+	res, err := us.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// Exists check if the user exists in the PostgreSQL database.
+func (us *UserStorePostgres) Exists(ctx context.Context, login string) (bool, error) {
+	var exists bool
+
+	err := us.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE login = $1 AND (deleted_at IS NULL OR $2))",
+		login, ReserveDeletedLogins).Scan(&exists)
+
+	return exists, err
+}
+
+// Ping check the PostgreSQL database can be reached
+func (us *UserStorePostgres) Ping(ctx context.Context) error {
+	return us.db.PingContext(ctx)
+}
+
+// RecordLogin update the last login time and IP address of the user in PostgreSQL
+func (us *UserStorePostgres) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error {
+
+	res, err := us.db.ExecContext(ctx, "UPDATE users SET last_login_at = $2, last_login_ip = $3 WHERE id = $1 AND deleted_at IS NULL", userID, at, ip)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res)
+}
+
+// scanner is implemented by sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var (
+		id, login, email  string
+		name, lastLoginIP sql.NullString
+		loginCiphertext   sql.NullString
+		emailIndex        sql.NullString
+		lastLoginAt       pq.NullTime
+		disabledAt        pq.NullTime
+		roles             pq.StringArray
+		version           int64
+	)
+
+	err := row.Scan(&id, &login, &email, &name, &lastLoginAt, &lastLoginIP, &version, &loginCiphertext, &emailIndex, &disabledAt, &roles)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	usr := &models.User{
+		ID:      models.String(id),
+		Login:   models.String(login),
+		Email:   models.String(email),
+		Version: models.Int64(version),
+	}
+
+	if name.Valid {
+		usr.Name = models.String(name.String)
+	}
+
+	if lastLoginAt.Valid {
+		usr.LastLoginAt = &lastLoginAt.Time
+	}
+
+	if lastLoginIP.Valid {
+		usr.LastLoginIP = models.String(lastLoginIP.String)
+	}
+
+	if loginCiphertext.Valid {
+		usr.LoginCiphertext = models.String(loginCiphertext.String)
+	}
+
+	if emailIndex.Valid {
+		usr.EmailIndex = models.String(emailIndex.String)
+	}
+
+	if disabledAt.Valid {
+		usr.DisabledAt = &disabledAt.Time
+	}
+
+	if len(roles) != 0 {
+		usr.Roles = []string(roles)
+	}
+
+	return usr, nil
+}
+
+func checkRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// mapPostgresError map driver errors to the store errors
+func mapPostgresError(err error) error {
+	if pqerr, ok := err.(*pq.Error); ok && pqerr.Code == pgUniqueViolation {
+		return ErrUserAlreadyExists
+	}
+	return err
+}
+
+func nullInt64(i *int64) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *i, Valid: true}
+}
+
+func nullTime(t *time.Time) pq.NullTime {
+	if t == nil {
+		return pq.NullTime{}
+	}
+	return pq.NullTime{Time: *t, Valid: true}
+}
+
+func nullStrings(s []string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return pq.Array(s)
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
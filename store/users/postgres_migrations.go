@@ -0,0 +1,111 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/wolfeidau/authinator/store/migrate"
+)
+
+// PostgresMigrations the ordered schema changes for the PostgreSQL store. Append new
+// migrations to the end and never modify ones which have been released.
+func PostgresMigrations(db *sql.DB) []migrate.Step {
+	return []migrate.Step{
+		migrate.PostgresStep(db, 1, "users table with a unique index on login",
+			`CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				login TEXT NOT NULL,
+				email TEXT NOT NULL,
+				name TEXT,
+				password TEXT NOT NULL,
+				last_login_at TIMESTAMPTZ,
+				last_login_ip TEXT
+			);
+			CREATE UNIQUE INDEX IF NOT EXISTS users_login_idx ON users (login);`,
+			`DROP TABLE IF EXISTS users;`),
+		migrate.PostgresStep(db, 2, "user version for optimistic concurrency",
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;`,
+			`ALTER TABLE users DROP COLUMN IF EXISTS version;`),
+		migrate.PostgresStep(db, 3, "soft delete of users, login only unique among active users",
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+			DROP INDEX IF EXISTS users_login_idx;
+			CREATE UNIQUE INDEX IF NOT EXISTS users_active_login_idx ON users (login) WHERE deleted_at IS NULL;`,
+			`DO $$ BEGIN
+				IF EXISTS (SELECT 1 FROM users WHERE deleted_at IS NOT NULL) THEN
+					RAISE EXCEPTION 'users have been soft deleted, restore or purge them before reverting soft delete';
+				END IF;
+			END $$;
+			DROP INDEX IF EXISTS users_active_login_idx;
+			CREATE UNIQUE INDEX IF NOT EXISTS users_login_idx ON users (login);
+			ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;`),
+		migrate.PostgresStep(db, 4, "encrypted login and email blind index columns",
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS login_ciphertext TEXT;
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS email_index TEXT;`,
+			`ALTER TABLE users DROP COLUMN IF EXISTS login_ciphertext;
+			ALTER TABLE users DROP COLUMN IF EXISTS email_index;`),
+		migrate.PostgresStep(db, 5, "disabled users and roles",
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[];`,
+			`ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
+			ALTER TABLE users DROP COLUMN IF EXISTS roles;`),
+		migrate.PostgresStep(db, 6, "sessions table",
+			`CREATE TABLE IF NOT EXISTS sessions (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				last_seen_at TIMESTAMPTZ NOT NULL,
+				ip TEXT,
+				user_agent TEXT
+			);
+			CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);`,
+			`DROP TABLE IF EXISTS sessions;`),
+		migrate.PostgresStep(db, 7, "login history table",
+			`CREATE TABLE IF NOT EXISTS login_history (
+				id BIGSERIAL PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				success BOOLEAN NOT NULL,
+				reason TEXT,
+				ip TEXT,
+				user_agent TEXT,
+				created_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS login_history_user_id_idx ON login_history (user_id, created_at);`,
+			`DROP TABLE IF EXISTS login_history;`),
+		migrate.PostgresStep(db, 8, "access tokens table with a unique index on hash",
+			`CREATE TABLE IF NOT EXISTS access_tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				name TEXT NOT NULL,
+				scopes TEXT[],
+				hash TEXT NOT NULL,
+				created_at TIMESTAMPTZ,
+				expires_at TIMESTAMPTZ,
+				last_used_at TIMESTAMPTZ
+			);
+			CREATE INDEX IF NOT EXISTS access_tokens_user_id_idx ON access_tokens (user_id);
+			CREATE UNIQUE INDEX IF NOT EXISTS access_tokens_hash_idx ON access_tokens (hash);`,
+			`DROP TABLE IF EXISTS access_tokens;`),
+		migrate.PostgresStep(db, 9, "magic links table",
+			`CREATE TABLE IF NOT EXISTS magic_links (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS magic_links_expires_at_idx ON magic_links (expires_at);`,
+			`DROP TABLE IF EXISTS magic_links;`),
+	}
+}
+
+// MigratePostgres apply any migrations which haven't been recorded in the
+// schema_migrations table, each migration is applied in its own transaction.
+func MigratePostgres(db *sql.DB) (int, error) {
+
+	m, err := migrate.NewMigrator(migrate.NewPostgresRecorder(db), PostgresMigrations(db))
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := m.Up(context.Background())
+
+	return len(applied), err
+}
@@ -0,0 +1,141 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/migrate"
+	"github.com/wolfeidau/authinator/store/pgtest"
+)
+
+func TestCreateAndGetUserPostgres(t *testing.T) {
+
+	userStore := createUserStorePostgres(t)
+
+	usr, err := userStore.Create(context.Background(), models.NewUser("", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+
+	if assert.NoError(t, err) {
+
+		cusr, err := userStore.GetByID(context.Background(), models.StringValue(usr.ID))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "mark@wolfe.id.au", models.StringValue(cusr.Email))
+		}
+
+		cusr, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.Equal(t, models.StringValue(usr.ID), models.StringValue(cusr.ID))
+		}
+	}
+
+	_, err = userStore.Create(context.Background(), models.NewUser("456", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	assert.Equal(t, ErrUserAlreadyExists, err)
+
+	_, err = userStore.GetByID(context.Background(), "nothere")
+	assert.Equal(t, ErrUserNotFound, err)
+}
+
+func TestUpdateUserPostgres(t *testing.T) {
+
+	userStore := createUserStorePostgres(t)
+
+	usr := models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+	usr.Password = models.String("LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP")
+
+	_, err := userStore.Create(context.Background(), usr)
+
+	if assert.NoError(t, err) {
+
+		err = userStore.Update(context.Background(), &models.User{ID: models.String("123"), Name: models.String("Mark Wolfy")}, []string{FieldName})
+		assert.NoError(t, err)
+
+		err = userStore.RecordLogin(context.Background(), "123", time.Now(), "127.0.0.1")
+		assert.NoError(t, err)
+
+		cusr, err := userStore.GetByID(context.Background(), "123")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Mark Wolfy", models.StringValue(cusr.Name))
+			assert.Equal(t, "127.0.0.1", models.StringValue(cusr.LastLoginIP))
+		}
+
+		pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP", pass)
+		}
+
+		err = userStore.Update(context.Background(), &models.User{ID: models.String("nothere"), Name: models.String("Mark Wolfy")}, []string{FieldName})
+		assert.Equal(t, ErrUserNotFound, err)
+	}
+}
+
+func TestUpdateLoginOfDeletedUserPostgres(t *testing.T) {
+
+	userStore := createUserStorePostgres(t)
+
+	_, err := userStore.Create(context.Background(), models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	assert.NoError(t, err)
+
+	_, err = userStore.Create(context.Background(), models.NewUser("456", "markwolfe", "mark@wolfe.id.au", "Mark Wolfe"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, userStore.Delete(context.Background(), "123"))
+
+	// the login of the deleted user stays reserved
+	err = userStore.Update(context.Background(), &models.User{ID: models.String("456"), Login: models.String("wolfeidau")}, []string{FieldLogin})
+	assert.Equal(t, ErrUserAlreadyExists, err)
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String("456"), Login: models.String("wolfeidau"), Version: models.Int64(5)}, []string{FieldLogin})
+	assert.Equal(t, ErrUserAlreadyExists, err)
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String("456"), Name: models.String("Mark"), Version: models.Int64(5)}, []string{FieldName})
+	assert.Equal(t, ErrConflict, err)
+}
+
+func TestMigrateDownKeepsDeletedUsersPostgres(t *testing.T) {
+
+	db := pgtest.Open(t)
+
+	_, err := MigratePostgres(db)
+	if err != nil {
+		t.Fatalf("error migrating postgres %v", err)
+	}
+
+	userStore := NewUserStorePostgres(db)
+
+	_, err = userStore.Create(context.Background(), models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	assert.NoError(t, err)
+	assert.NoError(t, userStore.Delete(context.Background(), "123"))
+
+	m, err := migrate.NewMigrator(migrate.NewPostgresRecorder(db), PostgresMigrations(db))
+	if assert.NoError(t, err) {
+		_, err = m.Down(context.Background(), 2)
+		assert.Error(t, err)
+	}
+
+	// the newer migrations are reverted but the soft deleted user is kept
+	var deleted int
+
+	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE deleted_at IS NOT NULL").Scan(&deleted)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, deleted)
+	}
+}
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+// createUserStorePostgres create a store in an empty database on the test server
+func createUserStorePostgres(t *testing.T) UserStore {
+
+	db := pgtest.Open(t)
+
+	_, err := MigratePostgres(db)
+	if err != nil {
+		t.Fatalf("error migrating postgres %v", err)
+	}
+
+	return NewUserStorePostgres(db)
+}
@@ -0,0 +1,70 @@
+package users
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Purger periodically erases users which were soft deleted longer ago than the retention,
+// and expired magic links if PurgeExpiredLinks is set.
+type Purger struct {
+	store UserStore
+
+	// Retention how long deleted users are kept before they are purged
+	Retention time.Duration
+	// Interval how often deleted users are purged
+	Interval time.Duration
+	// PurgeExpiredLinks erase the magic links which expired before the time, this is a
+	// function as the magic links store depends on this package
+	PurgeExpiredLinks func(expiredBefore time.Time) (int, error)
+}
+
+// NewPurger create a new purger for the user store
+func NewPurger(store UserStore, retention, interval time.Duration) *Purger {
+	return &Purger{
+		store:     store,
+		Retention: retention,
+		Interval:  interval,
+	}
+}
+
+// PurgeOnce erase the users deleted before the retention period
+func (p *Purger) PurgeOnce(ctx context.Context) (int, error) {
+	return p.store.Purge(ctx, time.Now().Add(-p.Retention))
+}
+
+// Run purge deleted users and expired magic links every interval until the context is cancelled, failures are
+// logged and retried at the next interval.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.PurgeOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("purging deleted users failed: %s", err)
+		}
+
+		if n > 0 {
+			log.Printf("purged %d deleted users", n)
+		}
+
+		if p.PurgeExpiredLinks != nil {
+			n, err = p.PurgeExpiredLinks(time.Now())
+			if err != nil {
+				log.Printf("purging expired magic links failed: %s", err)
+			}
+
+			if n > 0 {
+				log.Printf("purged %d expired magic links", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
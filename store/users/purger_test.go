@@ -0,0 +1,79 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+)
+
+func TestPurgerPurgeOnce(t *testing.T) {
+
+	userStore := NewUserStoreLocal()
+
+	usr, err := userStore.Create(context.Background(), models.NewUser("", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = userStore.Delete(context.Background(), models.StringValue(usr.ID))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// still within the retention period
+	n, err := NewPurger(userStore, time.Hour, time.Hour).PurgeOnce(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, n)
+	}
+
+	n, err = NewPurger(userStore, -time.Hour, time.Hour).PurgeOnce(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, n)
+	}
+}
+
+func TestPurgerRunStops(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		NewPurger(NewUserStoreLocal(), time.Hour, time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purger didn't stop when the context was cancelled")
+	}
+}
+
+func TestPurgerRunPurgesExpiredLinks(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	purged := make(chan time.Time, 1)
+
+	purger := NewPurger(NewUserStoreLocal(), time.Hour, time.Hour)
+	purger.PurgeExpiredLinks = func(expiredBefore time.Time) (int, error) {
+		purged <- expiredBefore
+		return 1, nil
+	}
+
+	go purger.Run(ctx)
+
+	select {
+	case expiredBefore := <-purged:
+		assert.WithinDuration(t, time.Now(), expiredBefore, time.Second)
+	case <-time.After(time.Second):
+		t.Fatal("purger didn't purge the expired magic links")
+	}
+}
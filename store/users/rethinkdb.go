@@ -1,7 +1,13 @@
 package users
 
 import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
 	r "github.com/dancannon/gorethink"
+	"github.com/dancannon/gorethink/encoding"
 	"github.com/wolfeidau/authinator/models"
 )
 
@@ -12,6 +18,16 @@ var (
 	DBName = "authinator"
 	// TableName is the name of users table in the RethinkDB database
 	TableName = "users"
+	// LoginsTableName is the name of the table reserving each login, it is keyed by login
+	// so the primary key constraint stops two users registering the same login
+	LoginsTableName = "user_logins"
+	// LoginIndex is the name of the secondary index on login
+	LoginIndex = "login"
+	// EmailIndex is the name of the secondary index on email
+	EmailIndex = "email"
+	// DeletedAtIndex is the name of the secondary index on deleted_at, only soft deleted
+	// users have the field so the index holds just them
+	DeletedAtIndex = "deleted_at"
 )
 
 // UserStoreRethinkDB RethinkDB based user store
@@ -25,9 +41,9 @@ func NewUserStoreRethinkDB(session *r.Session) UserStore {
 }
 
 // GetByID retrieve a user from RethinkDB
-func (us *UserStoreRethinkDB) GetByID(userID string) (*models.User, error) {
+func (us *UserStoreRethinkDB) GetByID(ctx context.Context, userID string) (*models.User, error) {
 
-	res, err := r.DB(DBName).Table(TableName).Get(userID).Run(us.session)
+	res, err := r.DB(DBName).Table(TableName).Get(userID).Run(us.session, r.RunOpts{Context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -44,15 +60,59 @@ func (us *UserStoreRethinkDB) GetByID(userID string) (*models.User, error) {
 		return nil, err
 	}
 
+	if usr.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	usr.Password = nil
+
+	// users stored before versions were added start at version 1
+	if usr.Version == nil {
+		usr.Version = models.Int64(1)
+	}
+
 	return usr, nil
 }
 
+// List list the active users from RethinkDB ordered by ID after the given ID
+func (us *UserStoreRethinkDB) List(ctx context.Context, after string, limit int) ([]*models.User, error) {
+
+	res, err := r.DB(DBName).Table(TableName).
+		Between(after, r.MaxVal, r.BetweenOpts{LeftBound: "open"}).
+		OrderBy(r.OrderByOpts{Index: "id"}).
+		Filter(func(usr r.Term) r.Term {
+			return isDeleted(usr).Not()
+		}).
+		Limit(limit).
+		Without("password").
+		Run(us.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	list := []*models.User{}
+
+	err = res.All(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, usr := range list {
+		// users stored before versions were added start at version 1
+		if usr.Version == nil {
+			usr.Version = models.Int64(1)
+		}
+	}
+
+	return list, nil
+}
+
 // GetByLogin retrieve a user from RethinkDB filtering by their login
-func (us *UserStoreRethinkDB) GetByLogin(login string) (*models.User, error) {
+func (us *UserStoreRethinkDB) GetByLogin(ctx context.Context, login string) (*models.User, error) {
 
-	res, err := r.DB(DBName).Table(TableName).Filter(map[string]interface{}{
-		"login": login,
-	}).Run(us.session)
+	res, err := us.activeByLogin(login).Run(us.session, r.RunOpts{Context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -69,14 +129,19 @@ func (us *UserStoreRethinkDB) GetByLogin(login string) (*models.User, error) {
 		return nil, err
 	}
 
+	usr.Password = nil
+
+	// users stored before versions were added start at version 1
+	if usr.Version == nil {
+		usr.Version = models.Int64(1)
+	}
+
 	return usr, nil
 }
 
 // GetPasswordByLogin retrieve the password for a user using their login
-func (us *UserStoreRethinkDB) GetPasswordByLogin(login string) (string, error) {
-	res, err := r.DB(DBName).Table(TableName).Filter(map[string]interface{}{
-		"login": login,
-	}).Run(us.session)
+func (us *UserStoreRethinkDB) GetPasswordByLogin(ctx context.Context, login string) (string, error) {
+	res, err := us.activeByLogin(login).Run(us.session, r.RunOpts{Context: ctx})
 	if err != nil {
 		return "", err
 	}
@@ -96,59 +161,317 @@ func (us *UserStoreRethinkDB) GetPasswordByLogin(login string) (string, error) {
 	return models.StringValue(usr.Password), nil
 }
 
-// Create create the user in RethinkDB
-func (us *UserStoreRethinkDB) Create(user *models.User) (*models.User, error) {
+// activeByLogin select the users with the login which haven't been deleted
+func (us *UserStoreRethinkDB) activeByLogin(login string) r.Term {
+	return r.DB(DBName).Table(TableName).GetAllByIndex(LoginIndex, login).Filter(func(usr r.Term) r.Term {
+		return isDeleted(usr).Not()
+	})
+}
+
+// Create create the user in RethinkDB, the login is reserved in the logins table first so
+// concurrent registrations for the same login can't both succeed.
+func (us *UserStoreRethinkDB) Create(ctx context.Context, user *models.User) (*models.User, error) {
+
+	if user.ID == nil {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		user.ID = models.String(id)
+	}
 
-	resp, err := r.DB(DBName).Table(TableName).Insert(user).RunWrite(us.session)
+	user.Version = models.Int64(1)
 
+	res, err := r.DB(DBName).Table(LoginsTableName).Insert(map[string]interface{}{
+		"id":      models.StringValue(user.Login),
+		"user_id": models.StringValue(user.ID),
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
+	if isDuplicateKey(res) {
+		return nil, ErrUserAlreadyExists
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	user.ID = models.String(resp.GeneratedKeys[0])
+	res, err = r.DB(DBName).Table(TableName).Insert(user).RunWrite(us.session, r.RunOpts{Context: ctx})
+	if err == nil {
+		return user, nil
+	}
+
+	// release the login so it can be registered again
+	us.releaseLogin(models.StringValue(user.Login), models.StringValue(user.ID))
+
+	if isDuplicateKey(res) {
+		return nil, ErrUserAlreadyExists
+	}
 
-	return user, nil
+	return nil, err
 }
 
-// Update the user in RethinkDB
-func (us *UserStoreRethinkDB) Update(user *models.User) error {
+// Update set the masked fields of the user in RethinkDB, the version is checked and
+// incremented in the same atomic update. A new login is reserved before the update and
+// the old one released after it.
+func (us *UserStoreRethinkDB) Update(ctx context.Context, user *models.User, mask []string) error {
+
+	err := checkMask(mask)
+	if err != nil {
+		return err
+	}
 
 	userID := models.StringValue(user.ID)
 
-	if user.Name == nil {
+	changes := map[string]interface{}{}
+
+	for _, f := range mask {
+		changes[f] = maskField(user, f)
+	}
+
+	reserved := false
+
+	if hasField(mask, FieldLogin) {
+		reserved, err = us.reserveLogin(ctx, models.StringValue(user.Login), userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := r.DB(DBName).Table(TableName).Get(userID).Update(func(usr r.Term) interface{} {
+		version := usr.Field("version").Default(1)
+		update := r.Expr(changes).Merge(map[string]interface{}{"version": version.Add(1)})
+
+		if user.Version != nil {
+			update = r.Branch(version.Eq(*user.Version), update, r.Error(ErrConflict.Error()))
+		}
+
+		return r.Branch(isDeleted(usr), r.Error(ErrUserNotFound.Error()), update)
+	}, r.UpdateOpts{
+		ReturnChanges: true,
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
+
+	switch {
+	case res.Errors > 0 && strings.Contains(res.FirstError, ErrConflict.Error()):
+		err = ErrConflict
+	case res.Errors > 0 && strings.Contains(res.FirstError, ErrUserNotFound.Error()):
+		err = ErrUserNotFound
+	case err == nil && (res.Replaced != 1 || len(res.Changes) != 1):
+		err = ErrUserNotFound
+	}
+
+	if err != nil {
+		if reserved {
+			us.releaseLogin(models.StringValue(user.Login), userID)
+		}
+		return err
+	}
+
+	oldUsr, newUsr := new(models.User), new(models.User)
+
+	err = encoding.Decode(oldUsr, res.Changes[0].OldValue)
+	if err != nil {
+		return err
+	}
+
+	err = encoding.Decode(newUsr, res.Changes[0].NewValue)
+	if err != nil {
+		return err
+	}
+
+	user.Version = newUsr.Version
+
+	// the update is applied so release the old login even if the request was cancelled
+	if reserved {
+		return us.releaseLoginHeldBy(context.Background(), models.StringValue(oldUsr.Login), userID)
+	}
+
+	return nil
+}
+
+// reserveLogin reserve the login for the user, false is returned if the user already holds it
+func (us *UserStoreRethinkDB) reserveLogin(ctx context.Context, login, userID string) (bool, error) {
+
+	res, err := r.DB(DBName).Table(LoginsTableName).Insert(map[string]interface{}{
+		"id":      login,
+		"user_id": userID,
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
+	if !isDuplicateKey(res) {
+		return err == nil, err
+	}
+
+	var holder string
+
+	err = r.DB(DBName).Table(LoginsTableName).Get(login).Field("user_id").ReadOne(&holder, us.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return false, err
+	}
+
+	if holder != userID {
+		return false, ErrUserAlreadyExists
+	}
+
+	return false, nil
+}
+
+// releaseLogin remove the reservation made for the user after their write failed, this isn't
+// bound to the request context so it runs even if the request was cancelled. The caller
+// returns the error of the write so a failure here is logged, the login stays reserved
+// until its row is removed from the logins table.
+func (us *UserStoreRethinkDB) releaseLogin(login, userID string) {
+	err := us.releaseLoginHeldBy(context.Background(), login, userID)
+	if err != nil {
+		log.Printf("releasing login reserved for user %s failed: %s", userID, err)
+	}
+}
+
+// Delete soft delete the user in the RethinkDB database, their login is released unless
+// ReserveDeletedLogins is set.
+func (us *UserStoreRethinkDB) Delete(ctx context.Context, userID string) error {
+	res, err := r.DB(DBName).Table(TableName).Get(userID).Update(func(usr r.Term) interface{} {
+		return r.Branch(isDeleted(usr), r.Error(ErrUserNotFound.Error()), map[string]interface{}{
+			"deleted_at": time.Now(),
+			"version":    usr.Field("version").Default(1).Add(1),
+		})
+	}, r.UpdateOpts{
+		ReturnChanges: true,
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
+
+	switch {
+	case res.Errors > 0 && strings.Contains(res.FirstError, ErrUserNotFound.Error()):
+		return ErrUserNotFound
+	case err != nil:
+		return err
+	case res.Replaced != 1 || len(res.Changes) != 1:
+		return ErrUserNotFound
+	}
+
+	if ReserveDeletedLogins {
 		return nil
 	}
 
-	res, err := r.DB(DBName).Table(TableName).Get(userID).Update(map[string]interface{}{
-		"name": models.StringValue(user.Name),
-	}).RunWrite(us.session)
+	usr := new(models.User)
+
+	err = encoding.Decode(usr, res.Changes[0].OldValue)
 	if err != nil {
 		return err
 	}
 
-	if res.Replaced != 1 {
+	return us.releaseLoginHeldBy(ctx, models.StringValue(usr.Login), userID)
+}
+
+// Restore undo the soft delete of the user in the RethinkDB database, the login is
+// reserved again before the user is restored.
+func (us *UserStoreRethinkDB) Restore(ctx context.Context, userID string) error {
+
+	res, err := r.DB(DBName).Table(TableName).Get(userID).Run(us.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	defer res.Close()
+
+	if res.IsNil() {
 		return ErrUserNotFound
 	}
 
-	return nil
+	usr := new(models.User)
+	err = res.One(&usr)
+	if err != nil {
+		return err
+	}
+
+	if usr.DeletedAt == nil {
+		return ErrUserNotFound
+	}
+
+	login := models.StringValue(usr.Login)
+
+	reserved, err := us.reserveLogin(ctx, login, userID)
+	if err != nil {
+		return err
+	}
+
+	wres, err := r.DB(DBName).Table(TableName).Get(userID).Replace(func(usr r.Term) interface{} {
+		return r.Branch(isDeleted(usr),
+			usr.Without("deleted_at").Merge(map[string]interface{}{"version": usr.Field("version").Default(1).Add(1)}),
+			r.Error(ErrUserNotFound.Error()))
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
+
+	switch {
+	case wres.Errors > 0 && strings.Contains(wres.FirstError, ErrUserNotFound.Error()):
+		err = ErrUserNotFound
+	case err == nil && wres.Replaced != 1:
+		err = ErrUserNotFound
+	}
+
+	if err != nil && reserved {
+		us.releaseLogin(login, userID)
+	}
+
+	return err
 }
 
-// Delete delete the user from the RethinkDB database.
-func (us *UserStoreRethinkDB) Delete(userID string) error {
-	_, err := r.DB(DBName).Table(TableName).Get(userID).Delete().RunWrite(us.session)
+// Purge permanently erase the users deleted before the given time from RethinkDB and
+// release any logins they still hold, the deleted users are found with the deleted_at index.
+func (us *UserStoreRethinkDB) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	res, err := r.DB(DBName).Table(TableName).Between(r.MinVal, deletedBefore, r.BetweenOpts{
+		Index: DeletedAtIndex,
+	}).Delete(r.DeleteOpts{
+		ReturnChanges: true,
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, change := range res.Changes {
+		usr := new(models.User)
+
+		err = encoding.Decode(usr, change.OldValue)
+		if err != nil {
+			return res.Deleted, err
+		}
+
+		err = us.releaseLoginHeldBy(ctx, models.StringValue(usr.Login), models.StringValue(usr.ID))
+		if err != nil {
+			return res.Deleted, err
+		}
+	}
+
+	return res.Deleted, nil
+}
+
+// Erase permanently erase the user from RethinkDB and release their login.
+func (us *UserStoreRethinkDB) Erase(ctx context.Context, userID string) error {
+	res, err := r.DB(DBName).Table(TableName).Get(userID).Delete(r.DeleteOpts{
+		ReturnChanges: true,
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if res.Deleted != 1 || len(res.Changes) != 1 {
+		return ErrUserNotFound
+	}
+
+	usr := new(models.User)
+
+	err = encoding.Decode(usr, res.Changes[0].OldValue)
+	if err != nil {
+		return err
+	}
+
+	return us.releaseLoginHeldBy(ctx, models.StringValue(usr.Login), userID)
+}
+
+// releaseLoginHeldBy remove the reservation of the login if it is held by the user
+func (us *UserStoreRethinkDB) releaseLoginHeldBy(ctx context.Context, login, userID string) error {
+	return r.DB(DBName).Table(LoginsTableName).GetAll(login).Filter(map[string]interface{}{
+		"user_id": userID,
+	}).Delete().Exec(us.session, r.ExecOpts{Context: ctx})
 }
 
-// Exists check if the user exists in the RethinkDB database.
-func (us *UserStoreRethinkDB) Exists(login string) (bool, error) {
+// Exists check if the login is reserved in the RethinkDB database.
+func (us *UserStoreRethinkDB) Exists(ctx context.Context, login string) (bool, error) {
 
-	res, err := r.DB(DBName).Table(TableName).Filter(map[string]interface{}{
-		"login": login,
-	}).Run(us.session)
+	res, err := r.DB(DBName).Table(LoginsTableName).Get(login).Run(us.session, r.RunOpts{Context: ctx})
 	if err != nil {
 		return false, err
 	}
@@ -161,3 +484,47 @@ func (us *UserStoreRethinkDB) Exists(login string) (bool, error) {
 
 	return true, nil
 }
+
+// Ping check the users table in RethinkDB can be read
+func (us *UserStoreRethinkDB) Ping(ctx context.Context) error {
+
+	res, err := r.DB(DBName).Table(TableName).Limit(1).Count().Run(us.session, r.RunOpts{Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	return res.Close()
+}
+
+// RecordLogin update the last login time and IP address of the user in RethinkDB
+func (us *UserStoreRethinkDB) RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error {
+
+	res, err := r.DB(DBName).Table(TableName).Get(userID).Update(func(usr r.Term) interface{} {
+		return r.Branch(isDeleted(usr), r.Error(ErrUserNotFound.Error()), map[string]interface{}{
+			"last_login_at": at,
+			"last_login_ip": ip,
+		})
+	}).RunWrite(us.session, r.RunOpts{Context: ctx})
+	if res.Errors > 0 && strings.Contains(res.FirstError, ErrUserNotFound.Error()) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if res.Replaced != 1 && res.Unchanged != 1 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// isDuplicateKey check if a write failed because the primary key is already in use
+func isDuplicateKey(res r.WriteResponse) bool {
+	return res.Errors > 0 && strings.HasPrefix(res.FirstError, "Duplicate primary key")
+}
+
+// isDeleted check if the user has been soft deleted
+func isDeleted(usr r.Term) r.Term {
+	return usr.HasFields("deleted_at")
+}
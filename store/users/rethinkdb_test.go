@@ -1,9 +1,11 @@
 package users
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	r "github.com/dancannon/gorethink"
 	"github.com/stretchr/testify/assert"
@@ -16,7 +18,7 @@ func TestGetUserRethinkDB(t *testing.T) {
 
 	if assert.NoError(t, err, "connecting to rethinkdb") {
 
-		usr, err := userStore.GetByID(userID)
+		usr, err := userStore.GetByID(context.Background(), userID)
 		if assert.NoError(t, err, "getting user from rethinkdb") {
 
 			if assert.NotNil(t, usr) {
@@ -24,7 +26,7 @@ func TestGetUserRethinkDB(t *testing.T) {
 			}
 		}
 
-		usr, err = userStore.GetByID("123")
+		usr, err = userStore.GetByID(context.Background(), "123")
 
 		if assert.Error(t, err) {
 			assert.Equal(t, err, ErrUserNotFound)
@@ -39,14 +41,14 @@ func TestGetUserByLoginRethinkDB(t *testing.T) {
 
 	if assert.NoError(t, err, "connecting to rethinkdb") {
 
-		usr, err := userStore.GetByLogin("wolfeidau")
+		usr, err := userStore.GetByLogin(context.Background(), "wolfeidau")
 
 		if assert.Nil(t, err) {
 			assert.Equal(t, "mark@wolfe.id.au", models.StringValue(usr.Email))
 			assert.Equal(t, userID, models.StringValue(usr.ID))
 		}
 
-		usr, err = userStore.GetByLogin("nothere")
+		usr, err = userStore.GetByLogin(context.Background(), "nothere")
 
 		if assert.Error(t, err) {
 			assert.Equal(t, err, ErrUserNotFound)
@@ -60,13 +62,13 @@ func TestGetPasswordByLoginRethinkDB(t *testing.T) {
 
 	if assert.NoError(t, err, "connecting to rethinkdb") {
 
-		pass, err := userStore.GetPasswordByLogin("wolfeidau")
+		pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
 
 		if assert.NoError(t, err) {
 			assert.Equal(t, "LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP", pass)
 		}
 
-		pass, err = userStore.GetPasswordByLogin("nothere")
+		pass, err = userStore.GetPasswordByLogin(context.Background(), "nothere")
 
 		if assert.Error(t, err) {
 			assert.Equal(t, err, ErrUserNotFound)
@@ -81,9 +83,9 @@ func TestCreateUserRethinkDB(t *testing.T) {
 
 	if assert.NoError(t, err, "connecting to rethinkdb") {
 
-		usr, err := userStore.Create(&models.User{
-			Email:    models.String("mark@wolfe.id.au"),
-			Login:    models.String("wolfeidau"),
+		usr, err := userStore.Create(context.Background(), &models.User{
+			Email:    models.String("mark@example.com"),
+			Login:    models.String("markw"),
 			Name:     models.String("Mark Wolfe"),
 			Password: models.String("LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP"),
 		})
@@ -91,6 +93,14 @@ func TestCreateUserRethinkDB(t *testing.T) {
 		if assert.Nil(t, err) {
 			assert.NotNil(t, usr.ID)
 		}
+
+		_, err = userStore.Create(context.Background(), &models.User{
+			Email:    models.String("mark@wolfe.id.au"),
+			Login:    models.String("wolfeidau"),
+			Name:     models.String("Mark Wolfe"),
+			Password: models.String("LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP"),
+		})
+		assert.Equal(t, ErrUserAlreadyExists, err)
 	}
 }
 
@@ -100,16 +110,16 @@ func TestUpdateUserRethinkDB(t *testing.T) {
 
 	if assert.NoError(t, err, "connecting to rethinkdb") {
 
-		err = userStore.Update(&models.User{
+		err = userStore.Update(context.Background(), &models.User{
 			ID:   models.String(userID),
 			Name: models.String("Mark Wolfy"),
-		})
+		}, []string{FieldName})
 
 		assert.NoError(t, err, "updating user in rethinkdb")
 
-		err = userStore.Update(&models.User{
+		err = userStore.Update(context.Background(), &models.User{
 			Name: models.String("Mark Wolfy"),
-		})
+		}, []string{FieldName})
 
 		if assert.Error(t, err) {
 			assert.Equal(t, err, ErrUserNotFound)
@@ -124,7 +134,7 @@ func TestDeleteUserRethinkDB(t *testing.T) {
 
 	if assert.NoError(t, err, "connecting to rethinkdb") {
 
-		err = userStore.Delete(userID)
+		err = userStore.Delete(context.Background(), userID)
 		assert.Nil(t, err, "deleting user in rethinkdb")
 	}
 }
@@ -135,13 +145,13 @@ func TestUserExistsRethinkDB(t *testing.T) {
 
 	if assert.NoError(t, err, "connecting to rethinkdb") {
 
-		exists, err := userStore.Exists("wolfeidau")
+		exists, err := userStore.Exists(context.Background(), "wolfeidau")
 
 		if assert.Nil(t, err, "checking if user exists in rethinkdb") {
 			assert.True(t, exists)
 		}
 
-		exists, err = userStore.Exists("nothere")
+		exists, err = userStore.Exists(context.Background(), "nothere")
 
 		if assert.NoError(t, err, "checking if user exists in rethinkdb") {
 			assert.False(t, exists)
@@ -149,6 +159,32 @@ func TestUserExistsRethinkDB(t *testing.T) {
 	}
 }
 
+func TestRecordLoginRethinkDB(t *testing.T) {
+
+	_, userStore, userID, err := createUserStoreAndSession()
+
+	if assert.NoError(t, err, "connecting to rethinkdb") {
+
+		err = userStore.RecordLogin(context.Background(), userID, time.Now(), "127.0.0.1")
+
+		if assert.NoError(t, err, "recording login in rethinkdb") {
+
+			usr, err := userStore.GetByID(context.Background(), userID)
+
+			if assert.NoError(t, err) {
+				assert.NotNil(t, usr.LastLoginAt)
+				assert.Equal(t, "127.0.0.1", models.StringValue(usr.LastLoginIP))
+			}
+		}
+
+		err = userStore.RecordLogin(context.Background(), "123", time.Now(), "127.0.0.1")
+
+		if assert.Error(t, err) {
+			assert.Equal(t, err, ErrUserNotFound)
+		}
+	}
+}
+
 func createUserDB(session *r.Session) {
 	DBName = "authinator_test"
 
@@ -160,6 +196,11 @@ func createUserDB(session *r.Session) {
 	fmt.Printf("%d DB created\n", resp.DBsCreated)
 
 	r.DB(DBName).TableCreate(TableName).Exec(session)
+	r.DB(DBName).Table(TableName).IndexCreate(LoginIndex).Exec(session)
+	r.DB(DBName).Table(TableName).IndexCreate(DeletedAtIndex).Exec(session)
+	r.DB(DBName).Table(TableName).IndexCreate(EmailIndex).Exec(session)
+	r.DB(DBName).Table(TableName).IndexWait().Exec(session)
+	r.DB(DBName).TableCreate(LoginsTableName).Exec(session)
 
 	fmt.Printf("Table created\n")
 
@@ -169,6 +210,8 @@ func createUserDB(session *r.Session) {
 	}
 
 	fmt.Printf("%d rows deleted\n", dresp.Deleted)
+
+	r.DB(DBName).Table(LoginsTableName).Delete().Exec(session)
 }
 
 func createUserStoreAndSession() (*r.Session, UserStore, string, error) {
@@ -210,5 +253,13 @@ func createUser(session *r.Session) (string, error) {
 		return "", errors.New("Key not generated")
 	}
 
+	err = r.DB(DBName).Table(LoginsTableName).Insert(map[string]interface{}{
+		"id":      "wolfeidau",
+		"user_id": resp.GeneratedKeys[0],
+	}).Exec(session)
+	if err != nil {
+		return "", err
+	}
+
 	return resp.GeneratedKeys[0], nil
 }
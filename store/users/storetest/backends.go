@@ -0,0 +1,122 @@
+package storetest
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	r "github.com/dancannon/gorethink"
+	"github.com/wolfeidau/authinator/store/pgtest"
+	"github.com/wolfeidau/authinator/store/users"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Backend a store the side store tests run against, only the connection of its kind is
+// set and none are set for the memory store
+type Backend struct {
+	Name      string
+	Bolt      *bolt.DB
+	Postgres  *sql.DB
+	RethinkDB *r.Session
+}
+
+// RunBackends run the test against the memory, bolt, PostgreSQL and RethinkDB stores, the
+// PostgreSQL and RethinkDB tests are skipped when their server isn't available. The package
+// must call pgtest.Main from TestMain.
+func RunBackends(t *testing.T, test func(t *testing.T, b *Backend)) {
+
+	t.Run("Local", func(t *testing.T) {
+		test(t, &Backend{Name: "Local"})
+	})
+
+	t.Run("Bolt", func(t *testing.T) {
+		db, cleanup := OpenBolt(t)
+		defer cleanup()
+
+		test(t, &Backend{Name: "Bolt", Bolt: db})
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		db, cleanup := OpenPostgres(t)
+		defer cleanup()
+
+		test(t, &Backend{Name: "Postgres", Postgres: db})
+	})
+
+	t.Run("RethinkDB", func(t *testing.T) {
+		session, cleanup := OpenRethinkDB(t)
+		defer cleanup()
+
+		test(t, &Backend{Name: "RethinkDB", RethinkDB: session})
+	})
+}
+
+// OpenBolt open a migrated bolt database in a temporary directory and return a function
+// which closes and removes it
+func OpenBolt(t *testing.T) (*bolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "authinator")
+	if err != nil {
+		t.Fatalf("error creating temp dir %v", err)
+	}
+
+	db, err := users.OpenBolt(filepath.Join(dir, "authinator.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("error opening bolt %v", err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// OpenPostgres open a migrated database on the pgtest server and return a function which
+// closes it, the package must call pgtest.Main from TestMain.
+func OpenPostgres(t *testing.T) (*sql.DB, func()) {
+	db := pgtest.Open(t)
+
+	_, err := users.MigratePostgres(db)
+	if err != nil {
+		db.Close()
+		t.Fatalf("error migrating postgres %v", err)
+	}
+
+	return db, func() { db.Close() }
+}
+
+// OpenRethinkDB connect to the RethinkDB server on localhost and create the test database,
+// the test is skipped if the server isn't available
+func OpenRethinkDB(t *testing.T) (*r.Session, func()) {
+	session, err := r.Connect(r.ConnectOpts{
+		Address: "localhost:28015",
+	})
+	if err != nil {
+		t.Skipf("rethinkdb not available %v", err)
+	}
+
+	users.DBName = "authinator_test"
+
+	r.DBCreate(users.DBName).Exec(session)
+
+	return session, func() { session.Close() }
+}
+
+// RethinkDBTable create the table and its secondary indexes in the test database if they
+// are missing, and remove the rows left by earlier tests
+func RethinkDBTable(t *testing.T, session *r.Session, table string, indexes ...string) {
+	r.DB(users.DBName).TableCreate(table).Exec(session)
+
+	for _, index := range indexes {
+		r.DB(users.DBName).Table(table).IndexCreate(index).Exec(session)
+	}
+
+	r.DB(users.DBName).Table(table).IndexWait().Exec(session)
+
+	err := r.DB(users.DBName).Table(table).Delete().Exec(session)
+	if err != nil {
+		t.Fatalf("error clearing %s table %v", table, err)
+	}
+}
@@ -0,0 +1,616 @@
+// Package storetest provides a conformance test suite which every UserStore
+// implementation must pass.
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+)
+
+const testPasswordHash = "LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP"
+
+// UserStoreFactory returns an empty user store and a function which cleans up after it
+type UserStoreFactory func(t *testing.T) (users.UserStore, func())
+
+// RunUserStoreSuite run the user store contract against stores created by the factory,
+// each test is given a new empty store.
+func RunUserStoreSuite(t *testing.T, factory UserStoreFactory) {
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, userStore users.UserStore)
+	}{
+		{"NotFound", testNotFound},
+		{"Create", testCreate},
+		{"CreateUniqueLogin", testCreateUniqueLogin},
+		{"CreateConcurrent", testCreateConcurrent},
+		{"Update", testUpdate},
+		{"UpdatePassword", testUpdatePassword},
+		{"UpdateVersion", testUpdateVersion},
+		{"UpdateMask", testUpdateMask},
+		{"UpdateLogin", testUpdateLogin},
+		{"UpdateDisabledAndRoles", testUpdateDisabledAndRoles},
+		{"Delete", testDelete},
+		{"DeleteReleaseLogin", testDeleteReleaseLogin},
+		{"Restore", testRestore},
+		{"RestoreLoginTaken", testRestoreLoginTaken},
+		{"Purge", testPurge},
+		{"Erase", testErase},
+		{"List", testList},
+		{"Exists", testExists},
+		{"PasswordNotReturned", testPasswordNotReturned},
+		{"RecordLogin", testRecordLogin},
+		{"Ping", testPing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userStore, cleanup := factory(t)
+			defer cleanup()
+
+			tt.test(t, userStore)
+		})
+	}
+}
+
+func newTestUser() *models.User {
+	return &models.User{
+		Login:    models.String("wolfeidau"),
+		Email:    models.String("mark@wolfe.id.au"),
+		Name:     models.String("Mark Wolfe"),
+		Password: models.String(testPasswordHash),
+	}
+}
+
+func createTestUser(t *testing.T, userStore users.UserStore) string {
+	usr, err := userStore.Create(context.Background(), newTestUser())
+	if err != nil {
+		t.Fatalf("error creating user %v", err)
+	}
+
+	return models.StringValue(usr.ID)
+}
+
+func testNotFound(t *testing.T, userStore users.UserStore) {
+
+	_, err := userStore.GetByID(context.Background(), "nothere")
+	assert.Equal(t, users.ErrUserNotFound, err, "GetByID")
+
+	_, err = userStore.GetByLogin(context.Background(), "nothere")
+	assert.Equal(t, users.ErrUserNotFound, err, "GetByLogin")
+
+	_, err = userStore.GetPasswordByLogin(context.Background(), "nothere")
+	assert.Equal(t, users.ErrUserNotFound, err, "GetPasswordByLogin")
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String("nothere"), Name: models.String("Mark Wolfy")}, []string{users.FieldName})
+	assert.Equal(t, users.ErrUserNotFound, err, "Update")
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String("nothere")}, nil)
+	assert.Equal(t, users.ErrUserNotFound, err, "Update without changes")
+
+	err = userStore.Delete(context.Background(), "nothere")
+	assert.Equal(t, users.ErrUserNotFound, err, "Delete")
+
+	err = userStore.Restore(context.Background(), "nothere")
+	assert.Equal(t, users.ErrUserNotFound, err, "Restore")
+
+	err = userStore.Erase(context.Background(), "nothere")
+	assert.Equal(t, users.ErrUserNotFound, err, "Erase")
+
+	err = userStore.RecordLogin(context.Background(), "nothere", time.Now(), "127.0.0.1")
+	assert.Equal(t, users.ErrUserNotFound, err, "RecordLogin")
+}
+
+func testCreate(t *testing.T, userStore users.UserStore) {
+
+	usr, err := userStore.Create(context.Background(), newTestUser())
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, models.StringValue(usr.ID), "an ID is assigned")
+
+		cusr, err := userStore.GetByID(context.Background(), models.StringValue(usr.ID))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "wolfeidau", models.StringValue(cusr.Login))
+			assert.Equal(t, "mark@wolfe.id.au", models.StringValue(cusr.Email))
+			assert.Equal(t, "Mark Wolfe", models.StringValue(cusr.Name))
+		}
+
+		cusr, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+		if assert.NoError(t, err) {
+			assert.Equal(t, models.StringValue(usr.ID), models.StringValue(cusr.ID))
+		}
+	}
+
+	// a supplied ID is used as is
+	usr = newTestUser()
+	usr.ID = models.String("123")
+	usr.Login = models.String("wolfeidau2")
+
+	usr, err = userStore.Create(context.Background(), usr)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "123", models.StringValue(usr.ID))
+
+		_, err = userStore.GetByID(context.Background(), "123")
+		assert.NoError(t, err)
+	}
+}
+
+func testCreateUniqueLogin(t *testing.T, userStore users.UserStore) {
+
+	createTestUser(t, userStore)
+
+	usr := newTestUser()
+	usr.Email = models.String("someone@example.com")
+
+	_, err := userStore.Create(context.Background(), usr)
+	assert.Equal(t, users.ErrUserAlreadyExists, err)
+}
+
+func testCreateConcurrent(t *testing.T, userStore users.UserStore) {
+
+	const registrations = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, registrations)
+
+	for i := 0; i < registrations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := userStore.Create(context.Background(), newTestUser())
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.Equal(t, users.ErrUserAlreadyExists, err)
+	}
+
+	assert.Equal(t, 1, created)
+}
+
+func testUpdate(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Update(context.Background(), &models.User{ID: models.String(userID), Name: models.String("Mark Wolfy")}, []string{users.FieldName})
+	assert.NoError(t, err)
+
+	cusr, err := userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Mark Wolfy", models.StringValue(cusr.Name))
+	}
+
+	// updating with the same values isn't an error
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID), Name: models.String("Mark Wolfy")}, []string{users.FieldName})
+	assert.NoError(t, err)
+
+	// an empty mask leaves every field unchanged
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID)}, nil)
+	assert.NoError(t, err)
+
+	cusr, err = userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Mark Wolfy", models.StringValue(cusr.Name))
+		assert.Equal(t, "wolfeidau", models.StringValue(cusr.Login))
+		assert.Equal(t, "mark@wolfe.id.au", models.StringValue(cusr.Email))
+	}
+}
+
+func testUpdatePassword(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Update(context.Background(), &models.User{ID: models.String(userID), Password: models.String("newhash")}, []string{users.FieldPassword})
+	assert.NoError(t, err)
+
+	pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "newhash", pass)
+	}
+
+	cusr, err := userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Mark Wolfe", models.StringValue(cusr.Name))
+	}
+}
+
+func testUpdateVersion(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	cusr, err := userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), models.Int64Value(cusr.Version))
+	}
+
+	usr := &models.User{ID: models.String(userID), Name: models.String("Mark Wolfy"), Version: models.Int64(1)}
+
+	err = userStore.Update(context.Background(), usr, []string{users.FieldName})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), models.Int64Value(usr.Version))
+	}
+
+	// a stale version is rejected and the user is unchanged
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID), Name: models.String("Stale"), Version: models.Int64(1)}, []string{users.FieldName})
+	assert.Equal(t, users.ErrConflict, err)
+
+	cusr, err = userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Mark Wolfy", models.StringValue(cusr.Name))
+		assert.Equal(t, int64(2), models.Int64Value(cusr.Version))
+	}
+
+	// updates without a version aren't checked but still increment it
+	usr = &models.User{ID: models.String(userID), Name: models.String("Mark Wolfe")}
+
+	err = userStore.Update(context.Background(), usr, []string{users.FieldName})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3), models.Int64Value(usr.Version))
+	}
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String("nothere"), Name: models.String("Mark Wolfy"), Version: models.Int64(1)}, []string{users.FieldName})
+	assert.Equal(t, users.ErrUserNotFound, err)
+}
+
+func testUpdateMask(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	// only the masked fields are updated and a nil value clears the field
+	err := userStore.Update(context.Background(), &models.User{
+		ID:    models.String(userID),
+		Email: models.String("mark@example.com"),
+	}, []string{users.FieldEmail, users.FieldName})
+	assert.NoError(t, err)
+
+	cusr, err := userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mark@example.com", models.StringValue(cusr.Email))
+		assert.Nil(t, cusr.Name)
+		assert.Equal(t, "wolfeidau", models.StringValue(cusr.Login))
+	}
+
+	pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, testPasswordHash, pass)
+	}
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID)}, []string{"id"})
+	assert.Equal(t, users.ErrUnknownField, err)
+}
+
+func testUpdateDisabledAndRoles(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	disabledAt := time.Now().UTC().Truncate(time.Second)
+
+	err := userStore.Update(context.Background(), &models.User{
+		ID:         models.String(userID),
+		DisabledAt: &disabledAt,
+		Roles:      []string{"admin", "support"},
+	}, []string{users.FieldDisabledAt, users.FieldRoles})
+	assert.NoError(t, err)
+
+	cusr, err := userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		if assert.NotNil(t, cusr.DisabledAt) {
+			assert.True(t, disabledAt.Equal(*cusr.DisabledAt))
+		}
+		assert.Equal(t, []string{"admin", "support"}, cusr.Roles)
+		assert.Equal(t, "mark@wolfe.id.au", models.StringValue(cusr.Email))
+	}
+
+	// clearing the fields enables the user and removes the roles
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID)}, []string{users.FieldDisabledAt, users.FieldRoles})
+	assert.NoError(t, err)
+
+	cusr, err = userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.Nil(t, cusr.DisabledAt)
+		assert.Empty(t, cusr.Roles)
+	}
+}
+
+func testUpdateLogin(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	usr := newTestUser()
+	usr.Login = models.String("markw")
+	usr.Email = models.String("mark@example.com")
+
+	_, err := userStore.Create(context.Background(), usr)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the login is held by another user
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID), Login: models.String("markw")}, []string{users.FieldLogin})
+	assert.Equal(t, users.ErrUserAlreadyExists, err)
+
+	// setting the login to its current value isn't a change
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID), Login: models.String("wolfeidau")}, []string{users.FieldLogin})
+	assert.NoError(t, err)
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID), Login: models.String("wolfeidau2")}, []string{users.FieldLogin})
+	assert.NoError(t, err)
+
+	cusr, err := userStore.GetByLogin(context.Background(), "wolfeidau2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, userID, models.StringValue(cusr.ID))
+	}
+
+	// the old login is released
+	exists, err := userStore.Exists(context.Background(), "wolfeidau")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = userStore.Create(context.Background(), newTestUser())
+	assert.NoError(t, err)
+}
+
+func testDelete(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Delete(context.Background(), userID)
+	assert.NoError(t, err)
+
+	_, err = userStore.GetByID(context.Background(), userID)
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	_, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	_, err = userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	err = userStore.Update(context.Background(), &models.User{ID: models.String(userID), Name: models.String("Mark Wolfy")}, []string{users.FieldName})
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	err = userStore.RecordLogin(context.Background(), userID, time.Now(), "127.0.0.1")
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	err = userStore.Delete(context.Background(), userID)
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	// the login stays reserved until the user is purged
+	exists, err := userStore.Exists(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.True(t, exists)
+	}
+
+	_, err = userStore.Create(context.Background(), newTestUser())
+	assert.Equal(t, users.ErrUserAlreadyExists, err)
+}
+
+func testDeleteReleaseLogin(t *testing.T, userStore users.UserStore) {
+
+	users.ReserveDeletedLogins = false
+	defer func() { users.ReserveDeletedLogins = true }()
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Delete(context.Background(), userID)
+	assert.NoError(t, err)
+
+	exists, err := userStore.Exists(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.False(t, exists)
+	}
+
+	// the login is released
+	createTestUser(t, userStore)
+}
+
+func testRestore(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Restore(context.Background(), userID)
+	assert.Equal(t, users.ErrUserNotFound, err, "restoring an active user")
+
+	err = userStore.Delete(context.Background(), userID)
+	assert.NoError(t, err)
+
+	err = userStore.Restore(context.Background(), userID)
+	assert.NoError(t, err)
+
+	usr, err := userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, userID, models.StringValue(usr.ID))
+		assert.Nil(t, usr.DeletedAt)
+		assert.Equal(t, int64(3), models.Int64Value(usr.Version))
+	}
+
+	pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, testPasswordHash, pass)
+	}
+}
+
+func testRestoreLoginTaken(t *testing.T, userStore users.UserStore) {
+
+	users.ReserveDeletedLogins = false
+	defer func() { users.ReserveDeletedLogins = true }()
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Delete(context.Background(), userID)
+	assert.NoError(t, err)
+
+	otherID := createTestUser(t, userStore)
+
+	err = userStore.Restore(context.Background(), userID)
+	assert.Equal(t, users.ErrUserAlreadyExists, err)
+
+	usr, err := userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, otherID, models.StringValue(usr.ID))
+	}
+}
+
+func testPurge(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Delete(context.Background(), userID)
+	assert.NoError(t, err)
+
+	// only users deleted before the cutoff are purged
+	n, err := userStore.Purge(context.Background(), time.Now().Add(-time.Hour))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, n)
+	}
+
+	n, err = userStore.Purge(context.Background(), time.Now().Add(time.Hour))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, n)
+	}
+
+	err = userStore.Restore(context.Background(), userID)
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	// the login is released
+	createTestUser(t, userStore)
+}
+
+func testExists(t *testing.T, userStore users.UserStore) {
+
+	createTestUser(t, userStore)
+
+	exists, err := userStore.Exists(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.True(t, exists)
+	}
+
+	exists, err = userStore.Exists(context.Background(), "nothere")
+	if assert.NoError(t, err) {
+		assert.False(t, exists)
+	}
+}
+
+func testPasswordNotReturned(t *testing.T, userStore users.UserStore) {
+
+	usr, err := userStore.Create(context.Background(), newTestUser())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cusr, err := userStore.GetByID(context.Background(), models.StringValue(usr.ID))
+	if assert.NoError(t, err) {
+		assert.Nil(t, cusr.Password, "GetByID")
+	}
+
+	cusr, err = userStore.GetByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Nil(t, cusr.Password, "GetByLogin")
+	}
+
+	pass, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, testPasswordHash, pass)
+	}
+}
+
+func testRecordLogin(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	at := time.Now().Truncate(time.Second)
+
+	err := userStore.RecordLogin(context.Background(), userID, at, "127.0.0.1")
+	assert.NoError(t, err)
+
+	cusr, err := userStore.GetByID(context.Background(), userID)
+	if assert.NoError(t, err) && assert.NotNil(t, cusr.LastLoginAt) {
+		assert.True(t, at.Equal(*cusr.LastLoginAt), "expected %s got %s", at, cusr.LastLoginAt)
+		assert.Equal(t, "127.0.0.1", models.StringValue(cusr.LastLoginIP))
+	}
+}
+
+func testErase(t *testing.T, userStore users.UserStore) {
+
+	userID := createTestUser(t, userStore)
+
+	err := userStore.Erase(context.Background(), userID)
+	assert.NoError(t, err)
+
+	err = userStore.Restore(context.Background(), userID)
+	assert.Equal(t, users.ErrUserNotFound, err)
+
+	// the login is released straight away
+	userID = createTestUser(t, userStore)
+
+	// deleted users can be erased as well
+	err = userStore.Delete(context.Background(), userID)
+	assert.NoError(t, err)
+
+	err = userStore.Erase(context.Background(), userID)
+	assert.NoError(t, err)
+
+	exists, err := userStore.Exists(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.False(t, exists)
+	}
+}
+
+func testList(t *testing.T, userStore users.UserStore) {
+
+	list, err := userStore.List(context.Background(), "", 10)
+	if assert.NoError(t, err) {
+		assert.Empty(t, list)
+	}
+
+	for _, id := range []string{"c", "a", "b", "d"} {
+		usr := newTestUser()
+		usr.ID = models.String(id)
+		usr.Login = models.String("user-" + id)
+
+		_, err = userStore.Create(context.Background(), usr)
+		if err != nil {
+			t.Fatalf("error creating user %v", err)
+		}
+	}
+
+	err = userStore.Delete(context.Background(), "b")
+	assert.NoError(t, err)
+
+	list, err = userStore.List(context.Background(), "", 2)
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, "a", models.StringValue(list[0].ID))
+		assert.Equal(t, "c", models.StringValue(list[1].ID))
+		assert.Equal(t, "user-a", models.StringValue(list[0].Login))
+		assert.Nil(t, list[0].Password)
+	}
+
+	list, err = userStore.List(context.Background(), "c", 2)
+	if assert.NoError(t, err) && assert.Len(t, list, 1) {
+		assert.Equal(t, "d", models.StringValue(list[0].ID))
+	}
+}
+
+func testPing(t *testing.T, userStore users.UserStore) {
+
+	assert.NoError(t, userStore.Ping(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Error(t, userStore.Ping(ctx))
+}
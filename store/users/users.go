@@ -1,7 +1,9 @@
 package users
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/wolfeidau/authinator/models"
 )
@@ -9,15 +11,146 @@ import (
 var (
 	ErrUserNotFound      = errors.New("User not found.")
 	ErrUserAlreadyExists = errors.New("User already exists.")
+	ErrConflict          = errors.New("User was modified by another request.")
+	ErrUnknownField      = errors.New("Unknown user field.")
+	ErrNotSupported      = errors.New("Operation not supported.")
 )
 
-// UserStore user store interface
+var (
+	// ReserveDeletedLogins keep the logins of soft deleted users reserved until they are
+	// purged, otherwise the login can be registered again and restoring the user fails
+	// with ErrUserAlreadyExists if it has been.
+	ReserveDeletedLogins = true
+)
+
+// Field names accepted in an update mask, these match the JSON names of the user fields.
+const (
+	FieldLogin    = "login"
+	FieldEmail    = "email"
+	FieldName     = "name"
+	FieldPassword = "password"
+
+	// FieldLoginCiphertext and FieldEmailIndex are written by UserStoreEncrypted alongside
+	// the login and email, they can't be updated through the API.
+	FieldLoginCiphertext = "login_ciphertext"
+	FieldEmailIndex      = "email_index"
+
+	// FieldDisabledAt and FieldRoles are set by administrators using the CLI, they can't
+	// be updated through the API.
+	FieldDisabledAt = "disabled_at"
+	FieldRoles      = "roles"
+)
+
+// UpdatableFields the fields which can be named in an update mask
+var UpdatableFields = []string{FieldLogin, FieldEmail, FieldName, FieldPassword}
+
+// UserStore user store interface, the context passed to each operation is used to
+// cancel queries and carry request deadlines through to the backend.
+//
+// Update sets only the fields named in the mask to their values in the user, a nil value
+// clears the field. Changing the login is subject to the same uniqueness check as Create.
+//
+// Delete soft deletes the user, after which every operation treats them as not found
+// until they are restored. Purge permanently erases the users deleted before a time and
+// Erase permanently erases a single user whether or not they have been deleted.
+//
+// List returns up to limit users ordered by ID starting after the given ID, an empty ID
+// starts from the beginning. Deleted users aren't listed and passwords aren't returned.
+//
+// Ping checks the store can be reached, it is used to report whether the server is ready.
+//
+// Users are created with version 1 and each Update increments it. If the user passed to
+// Update has a version it must match the stored one otherwise ErrConflict is returned,
+// on success the user is given the new version.
 type UserStore interface {
-	GetByID(userID string) (*models.User, error)
-	GetByLogin(login string) (*models.User, error)
-	GetPasswordByLogin(login string) (string, error)
-	Create(user *models.User) (*models.User, error)
-	Update(user *models.User) error
-	Delete(userID string) error
-	Exists(login string) (bool, error)
+	GetByID(ctx context.Context, userID string) (*models.User, error)
+	GetByLogin(ctx context.Context, login string) (*models.User, error)
+	GetPasswordByLogin(ctx context.Context, login string) (string, error)
+	List(ctx context.Context, after string, limit int) ([]*models.User, error)
+	Create(ctx context.Context, user *models.User) (*models.User, error)
+	Update(ctx context.Context, user *models.User, mask []string) error
+	Delete(ctx context.Context, userID string) error
+	Restore(ctx context.Context, userID string) error
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)
+	Erase(ctx context.Context, userID string) error
+	Exists(ctx context.Context, login string) (bool, error)
+	RecordLogin(ctx context.Context, userID string, at time.Time, ip string) error
+	Ping(ctx context.Context) error
+}
+
+// checkMask ensure every field in the mask can be updated
+func checkMask(mask []string) error {
+	for _, f := range mask {
+		if maskValue(&models.User{}, f) == nil {
+			return ErrUnknownField
+		}
+	}
+	return nil
+}
+
+// applyMask copy the masked fields from src to dst
+func applyMask(dst, src *models.User, mask []string) error {
+	err := checkMask(mask)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range mask {
+		switch v := maskValue(dst, f).(type) {
+		case **string:
+			*v = copyString(*maskValue(src, f).(**string))
+		case **time.Time:
+			*v = copyTime(*maskValue(src, f).(**time.Time))
+		case *[]string:
+			*v = copyStrings(*maskValue(src, f).(*[]string))
+		}
+	}
+
+	return nil
+}
+
+// maskField return the value of the named field, a *string, *time.Time or []string
+func maskField(usr *models.User, name string) interface{} {
+	switch v := maskValue(usr, name).(type) {
+	case **string:
+		return *v
+	case **time.Time:
+		return *v
+	case *[]string:
+		return *v
+	}
+	return nil
+}
+
+// maskValue return the address of the named field or nil if it can't be updated, this
+// is a **string, **time.Time or *[]string depending on the field.
+func maskValue(usr *models.User, name string) interface{} {
+	switch name {
+	case FieldLogin:
+		return &usr.Login
+	case FieldEmail:
+		return &usr.Email
+	case FieldName:
+		return &usr.Name
+	case FieldPassword:
+		return &usr.Password
+	case FieldLoginCiphertext:
+		return &usr.LoginCiphertext
+	case FieldEmailIndex:
+		return &usr.EmailIndex
+	case FieldDisabledAt:
+		return &usr.DisabledAt
+	case FieldRoles:
+		return &usr.Roles
+	}
+	return nil
+}
+
+func hasField(mask []string, name string) bool {
+	for _, f := range mask {
+		if f == name {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,293 @@
+// Package tlsconfig builds the TLS configuration of the server, the certificate and key are
+// reloaded when their files change so certificates can be renewed without a restart.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ClientAuthRequest verify client certificates when they are sent
+	ClientAuthRequest = "request"
+
+	// ClientAuthRequire reject connections without a verified client certificate
+	ClientAuthRequire = "require"
+)
+
+var (
+	ErrNoClientCAs = errors.New("Client CA file has no certificates.")
+
+	versions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+// Options the TLS settings of the server
+type Options struct {
+	CertFile string
+	KeyFile  string
+
+	// MinVersion the lowest TLS version accepted, 1.0, 1.1, 1.2 or 1.3
+	MinVersion string
+
+	// CipherSuites the names of the TLS 1.0 to 1.2 cipher suites accepted, if empty the Go
+	// defaults are used. TLS 1.3 suites aren't configurable.
+	CipherSuites []string
+
+	// ClientCAFile a PEM bundle of the CAs which issue client certificates, if empty client
+	// certificates aren't requested
+	ClientCAFile string
+
+	// ClientAuth either ClientAuthRequest or ClientAuthRequire
+	ClientAuth string
+}
+
+// New build the TLS configuration, the reloader serves the certificate and must be
+// watched for it to be reloaded.
+func New(opts Options) (*tls.Config, *Reloader, error) {
+
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	suites, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reloader, err := NewReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if opts.ClientCAFile != "" {
+		cfg.ClientCAs, err = LoadClientCAs(opts.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if opts.ClientAuth == ClientAuthRequire {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return cfg, reloader, nil
+}
+
+// ParseVersion parse a TLS version such as 1.2, empty defaults to 1.2
+func ParseVersion(version string) (uint16, error) {
+
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+
+	v, ok := versions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, must be 1.0, 1.1, 1.2 or 1.3", version)
+	}
+
+	return v, nil
+}
+
+// ParseCipherSuites parse the names of cipher suites such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, only the suites without known security issues are
+// accepted.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := map[string]uint16{}
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	var ids []uint16
+
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			valid := make([]string, 0, len(known))
+			for k := range known {
+				valid = append(valid, k)
+			}
+			sort.Strings(valid)
+
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q, valid suites are %s", name, strings.Join(valid, ", "))
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// LoadClientCAs load a PEM bundle of CA certificates
+func LoadClientCAs(file string) (*x509.CertPool, error) {
+
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, ErrNoClientCAs
+	}
+
+	return pool, nil
+}
+
+// Identities the names in a client certificate which can be mapped to users or service
+// clients, cn:<common name>, dns:<name>, email:<address> and uri:<uri> for each SAN.
+func Identities(cert *x509.Certificate) []string {
+
+	var ids []string
+
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, "cn:"+cert.Subject.CommonName)
+	}
+
+	for _, name := range cert.DNSNames {
+		ids = append(ids, "dns:"+name)
+	}
+
+	for _, addr := range cert.EmailAddresses {
+		ids = append(ids, "email:"+addr)
+	}
+
+	for _, u := range cert.URIs {
+		ids = append(ids, "uri:"+u.String())
+	}
+
+	return ids
+}
+
+// Reloader serves a certificate and key pair which is loaded again when either file is
+// modified.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader load the certificate and key pair
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+
+	rl := &Reloader{certFile: certFile, keyFile: keyFile}
+
+	_, err := rl.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return rl, nil
+}
+
+// GetCertificate return the current certificate, for use as tls.Config.GetCertificate
+func (rl *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	return rl.cert, nil
+}
+
+// Reload load the certificate and key if either file was modified since they were last
+// loaded, returning true if they were. If they can't be loaded the current certificate
+// is kept.
+func (rl *Reloader) Reload() (bool, error) {
+
+	modTime, err := latestModTime(rl.certFile, rl.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	rl.mu.RLock()
+	unchanged := rl.cert != nil && modTime.Equal(rl.modTime)
+	rl.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(rl.certFile, rl.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	rl.mu.Lock()
+	rl.cert = &cert
+	rl.modTime = modTime
+	rl.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch check the files for changes every interval until the context is done
+func (rl *Reloader) Watch(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := rl.Reload()
+		if err != nil {
+			// the files may be part way through being replaced, try again next time
+			log.Printf("reloading TLS certificate failed, keeping the current one: %s", err)
+			continue
+		}
+
+		if reloaded {
+			log.Printf("reloaded TLS certificate %s", rl.certFile)
+		}
+	}
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+
+	var latest time.Time
+
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
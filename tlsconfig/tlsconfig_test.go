@@ -0,0 +1,160 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert write a self signed certificate and key for the common name to the directory
+func writeCert(t *testing.T, dir, cn string) (string, string) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, rl *Reloader) string {
+	cert, _ := rl.GetCertificate(nil)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "first")
+
+	rl, err := NewReloader(certFile, keyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "first", commonName(t, rl))
+
+	reloaded, err := rl.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+
+	writeCert(t, dir, "second")
+
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	reloaded, err = rl.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", commonName(t, rl))
+
+	// a broken key keeps the current certificate
+	ioutil.WriteFile(keyFile, []byte("not a key"), 0600)
+
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+
+	_, err = rl.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "second", commonName(t, rl))
+}
+
+func TestNew(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "server")
+
+	cfg, _, err := New(Options{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		ClientCAFile: certFile,
+		ClientAuth:   ClientAuthRequire,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, cfg.CipherSuites)
+		assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+		assert.NotNil(t, cfg.ClientCAs)
+	}
+
+	_, _, err = New(Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile})
+	assert.Equal(t, ErrNoClientCAs, err)
+
+	_, err = ParseVersion("1.4")
+	assert.Error(t, err)
+
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err)
+}
+
+func TestIdentities(t *testing.T) {
+
+	u, _ := url.Parse("spiffe://example.org/ci")
+
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "ops"},
+		DNSNames:       []string{"ci.example.org"},
+		EmailAddresses: []string{"mark@wolfe.id.au"},
+		URIs:           []*url.URL{u},
+	}
+
+	assert.Equal(t, []string{"cn:ops", "dns:ci.example.org", "email:mark@wolfe.id.au", "uri:spiffe://example.org/ci"}, Identities(cert))
+}
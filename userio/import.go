@@ -0,0 +1,204 @@
+package userio
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/util"
+	"github.com/wolfeidau/authinator/validation"
+)
+
+// exportPageSize is the number of users read from the store at a time when exporting
+const exportPageSize = 100
+
+// RowError is a row which couldn't be imported
+type RowError struct {
+	Row   int    `json:"row"`
+	Login string `json:"login,omitempty"`
+	Error string `json:"error"`
+}
+
+// Report is the outcome of an import, in a dry run Imported counts the rows which
+// would have been imported.
+type Report struct {
+	Rows     int         `json:"rows"`
+	Imported int         `json:"imported"`
+	DryRun   bool        `json:"dry_run"`
+	Errors   []*RowError `json:"errors"`
+}
+
+// WriteCSV write the row errors as CSV
+func (rp *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"row", "login", "error"}); err != nil {
+		return err
+	}
+
+	for _, re := range rp.Errors {
+		if err := cw.Write([]string{strconv.Itoa(re.Row), re.Login, re.Error}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (rp *Report) fail(row int, usr *models.User, err error) {
+	re := &RowError{Row: row, Error: err.Error()}
+
+	if usr != nil {
+		re.Login = models.StringValue(usr.Login)
+	}
+
+	rp.Errors = append(rp.Errors, re)
+}
+
+// Import create the users read from r in the store, each row is validated like a
+// registration and the password must already be hashed in one of the formats accepted by
+// util.CompareHashPassword, passwords which aren't scrypt are hashed again on first login.
+//
+// Invalid rows are added to the report and skipped, an error is only returned if the input
+// can't be read at all or the store fails. A dry run validates the rows and checks the logins
+// are free without creating any users.
+func Import(ctx context.Context, userStore users.UserStore, r Reader, dryRun bool) (*Report, error) {
+
+	report := &Report{DryRun: dryRun, Errors: []*RowError{}}
+
+	// logins seen earlier in this file, a dry run doesn't create them in the store
+	seen := map[string]int{}
+
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Rows++
+
+		if rec.Err != nil {
+			report.fail(rec.Row, nil, rec.Err)
+			continue
+		}
+
+		usr := rec.User
+
+		if err := validateRecord(usr); err != nil {
+			report.fail(rec.Row, usr, err)
+			continue
+		}
+
+		login := models.StringValue(usr.Login)
+
+		if prev, ok := seen[login]; ok {
+			report.fail(rec.Row, usr, fmt.Errorf("login duplicates row %d", prev))
+			continue
+		}
+
+		seen[login] = rec.Row
+
+		if dryRun {
+			exists, err := userStore.Exists(ctx, login)
+			if err != nil {
+				return report, err
+			}
+
+			if exists {
+				report.fail(rec.Row, usr, users.ErrUserAlreadyExists)
+				continue
+			}
+
+			report.Imported++
+			continue
+		}
+
+		_, err = userStore.Create(ctx, usr)
+		if err == users.ErrUserAlreadyExists {
+			report.fail(rec.Row, usr, err)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Imported++
+	}
+}
+
+// validateRecord validate the user as a registration, the ID is allowed so exported
+// users keep their IDs when imported into another store.
+func validateRecord(usr *models.User) error {
+
+	id := usr.ID
+	usr.ID = nil
+
+	allErrs := validation.ValidateUserRegister(usr)
+
+	usr.ID = id
+
+	if len(allErrs) != 0 {
+		msgs := make([]string, len(allErrs))
+		for i, err := range allErrs {
+			msgs[i] = err.Error()
+		}
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	// plain passwords are rejected, they would never match when compared as a hash
+	if _, err := util.HashFormat(models.StringValue(usr.Password)); err != nil {
+		return fmt.Errorf("User.Password: %s", err)
+	}
+
+	return nil
+}
+
+// Export write every user in the store to w, ordered by ID. Password hashes are only
+// included when withPasswords is set.
+func Export(ctx context.Context, userStore users.UserStore, w Writer, withPasswords bool) (int, error) {
+
+	count := 0
+	after := ""
+
+	for {
+		page, err := userStore.List(ctx, after, exportPageSize)
+		if err != nil {
+			return count, err
+		}
+
+		for _, usr := range page {
+
+			// only the fields accepted by Import are written so exports can be imported again
+			eusr := &models.User{ID: usr.ID, Login: usr.Login, Email: usr.Email, Name: usr.Name}
+
+			if withPasswords {
+				phash, err := userStore.GetPasswordByLogin(ctx, models.StringValue(usr.Login))
+				if err != nil {
+					return count, err
+				}
+				eusr.Password = models.String(phash)
+			}
+
+			if err := w.Write(eusr); err != nil {
+				return count, err
+			}
+
+			count++
+		}
+
+		if len(page) < exportPageSize {
+			return count, w.Flush()
+		}
+
+		after = models.StringValue(page[len(page)-1].ID)
+	}
+}
@@ -0,0 +1,251 @@
+// Package userio reads and writes users as CSV or NDJSON so they can be moved in bulk
+// between authinator and other systems.
+package userio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wolfeidau/authinator/models"
+)
+
+// Formats supported by the readers and writers
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var (
+	ErrUnknownFormat = errors.New("Unknown format.")
+	ErrMissingHeader = errors.New("Missing CSV header.")
+)
+
+// Columns are the CSV columns, in the order they are written
+var Columns = []string{"id", "login", "email", "name", "password"}
+
+// Record is a user read from a file, Err is set when the row couldn't be parsed and the
+// reader has moved on to the next one.
+type Record struct {
+	Row  int
+	User *models.User
+	Err  error
+}
+
+// Reader reads users one record at a time, returning io.EOF at the end of the input
+type Reader interface {
+	Read() (*Record, error)
+}
+
+// Writer writes users, Flush must be called once all the users are written
+type Writer interface {
+	Write(usr *models.User) error
+	Flush() error
+}
+
+// NewReader create a reader for the format
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r), nil
+	case FormatNDJSON:
+		return newNDJSONReader(r), nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// NewWriter create a writer for the format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// csvReader reads users from CSV with a header row naming the columns, the columns can be
+// in any order and only login, email and password are required.
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	return &csvReader{r: cr}
+}
+
+func (cr *csvReader) Read() (*Record, error) {
+
+	if cr.header == nil {
+		header, err := cr.r.Read()
+		if err == io.EOF {
+			return nil, ErrMissingHeader
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for i, col := range header {
+			col = strings.ToLower(strings.TrimSpace(col))
+			if !isColumn(col) {
+				return nil, fmt.Errorf("Unknown CSV column %q.", col)
+			}
+			header[i] = col
+		}
+
+		cr.header = header
+	}
+
+	fields, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+
+	if err != nil {
+		if perr, ok := err.(*csv.ParseError); ok {
+			return &Record{Row: perr.StartLine, Err: perr.Err}, nil
+		}
+		return nil, err
+	}
+
+	row, _ := cr.r.FieldPos(0)
+
+	if len(fields) != len(cr.header) {
+		return &Record{Row: row, Err: fmt.Errorf("expected %d columns got %d", len(cr.header), len(fields))}, nil
+	}
+
+	usr := &models.User{}
+
+	for i, col := range cr.header {
+		if fields[i] == "" {
+			continue
+		}
+
+		v := models.String(fields[i])
+
+		switch col {
+		case "id":
+			usr.ID = v
+		case "login":
+			usr.Login = v
+		case "email":
+			usr.Email = v
+		case "name":
+			usr.Name = v
+		case "password":
+			usr.Password = v
+		}
+	}
+
+	return &Record{Row: row, User: usr}, nil
+}
+
+func isColumn(col string) bool {
+	for _, c := range Columns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (cw *csvWriter) Write(usr *models.User) error {
+
+	if !cw.wroteHeader {
+		if err := cw.w.Write(Columns); err != nil {
+			return err
+		}
+		cw.wroteHeader = true
+	}
+
+	return cw.w.Write([]string{
+		models.StringValue(usr.ID),
+		models.StringValue(usr.Login),
+		models.StringValue(usr.Email),
+		models.StringValue(usr.Name),
+		models.StringValue(usr.Password),
+	})
+}
+
+func (cw *csvWriter) Flush() error {
+
+	// an empty export still gets a header so it can be imported again
+	if !cw.wroteHeader {
+		if err := cw.w.Write(Columns); err != nil {
+			return err
+		}
+		cw.wroteHeader = true
+	}
+
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ndjsonReader reads a user JSON object per line, using the same field names as the REST API
+type ndjsonReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	return &ndjsonReader{r: bufio.NewReader(r)}
+}
+
+func (nr *ndjsonReader) Read() (*Record, error) {
+
+	for {
+		line, err := nr.r.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		nr.line++
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		usr := &models.User{}
+
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(usr); err != nil {
+			return &Record{Row: nr.line, Err: err}, nil
+		}
+
+		return &Record{Row: nr.line, User: usr}, nil
+	}
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(usr *models.User) error {
+	return nw.enc.Encode(usr)
+}
+
+func (nw *ndjsonWriter) Flush() error {
+	return nil
+}
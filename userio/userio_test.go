@@ -0,0 +1,190 @@
+package userio
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/store/users"
+	"github.com/wolfeidau/authinator/util"
+)
+
+const (
+	scryptHash = "LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP"
+	djangoHash = "pbkdf2_sha256$260000$saltysalt$z39lMrYWXjoS323Go+jB+HUVR1HS77NmmJC1UrXQcOA="
+	apr1Hash   = "$apr1$saltsalt$JlxKsEGK5mnlqk8yvMql4/"
+)
+
+func TestImportCSV(t *testing.T) {
+
+	userStore := users.NewUserStoreLocal()
+
+	_, err := userStore.Create(context.Background(), &models.User{Login: models.String("taken"), Email: models.String("taken@wolfe.id.au"), Password: models.String(scryptHash)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	input := `login,email,name,password
+wolfeidau,mark@wolfe.id.au,Mark Wolfe,` + djangoHash + `
+markw,markw@wolfe.id.au,,` + apr1Hash + `
+taken,taken@wolfe.id.au,,` + scryptHash + `
+plainpass,plain@wolfe.id.au,,Somewh3r3 there is a cow!
+wolfeidau,other@wolfe.id.au,,` + scryptHash + `
+abc,,,` + scryptHash + `
+`
+
+	r, _ := NewReader(FormatCSV, strings.NewReader(input))
+
+	report, err := Import(context.Background(), userStore, r, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 6, report.Rows)
+	assert.Equal(t, 2, report.Imported)
+
+	if assert.Len(t, report.Errors, 4) {
+		assert.Equal(t, &RowError{Row: 4, Login: "taken", Error: users.ErrUserAlreadyExists.Error()}, report.Errors[0])
+		assert.Equal(t, 5, report.Errors[1].Row)
+		assert.Contains(t, report.Errors[1].Error, util.ErrUnknownHashFormat.Error())
+		assert.Equal(t, "login duplicates row 2", report.Errors[2].Error)
+		assert.Equal(t, 7, report.Errors[3].Row)
+		assert.Contains(t, report.Errors[3].Error, "User.Email")
+	}
+
+	// imported hashes are kept as is and verified on login
+	phash, err := userStore.GetPasswordByLogin(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.Equal(t, djangoHash, phash)
+
+		ok, err := util.CompareHashPassword("Somewh3r3 there is a cow!", phash)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	var buf bytes.Buffer
+
+	if assert.NoError(t, report.WriteCSV(&buf)) {
+		assert.True(t, strings.HasPrefix(buf.String(), "row,login,error\n4,taken,"))
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+
+	userStore := users.NewUserStoreLocal()
+
+	input := `{"login":"wolfeidau","email":"mark@wolfe.id.au","password":"` + scryptHash + `"}
+
+{"login":"markw","email":"markw@wolfe.id.au","password":"` + apr1Hash + `","admin":true}
+{"login":"wolfeidau","email":"mark@wolfe.id.au","password":"` + scryptHash + `"}`
+
+	r, _ := NewReader(FormatNDJSON, strings.NewReader(input))
+
+	report, err := Import(context.Background(), userStore, r, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 3, report.Rows)
+	assert.Equal(t, 1, report.Imported)
+
+	if assert.Len(t, report.Errors, 2) {
+		assert.Equal(t, 3, report.Errors[0].Row)
+		assert.Equal(t, 4, report.Errors[1].Row)
+		assert.Equal(t, "login duplicates row 1", report.Errors[1].Error)
+	}
+
+	exists, err := userStore.Exists(context.Background(), "wolfeidau")
+	if assert.NoError(t, err) {
+		assert.False(t, exists)
+	}
+}
+
+func TestImportInvalidCSV(t *testing.T) {
+
+	r, _ := NewReader(FormatCSV, strings.NewReader("login,email,admin\n"))
+
+	_, err := Import(context.Background(), users.NewUserStoreLocal(), r, true)
+	assert.EqualError(t, err, `Unknown CSV column "admin".`)
+
+	r, _ = NewReader(FormatCSV, strings.NewReader(""))
+
+	_, err = Import(context.Background(), users.NewUserStoreLocal(), r, true)
+	assert.Equal(t, ErrMissingHeader, err)
+
+	_, err = NewReader("xml", strings.NewReader(""))
+	assert.Equal(t, ErrUnknownFormat, err)
+}
+
+func TestExportImport(t *testing.T) {
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+
+		source := users.NewUserStoreLocal()
+
+		for _, login := range []string{"wolfeidau", "markw", "mwolfe"} {
+			_, err := source.Create(context.Background(), &models.User{Login: models.String(login), Email: models.String(login + "@wolfe.id.au"), Password: models.String(apr1Hash)})
+			if !assert.NoError(t, err) {
+				return
+			}
+		}
+
+		var buf bytes.Buffer
+
+		w, _ := NewWriter(format, &buf)
+
+		count, err := Export(context.Background(), source, w, true)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, 3, count)
+
+		target := users.NewUserStoreLocal()
+
+		r, _ := NewReader(format, &buf)
+
+		report, err := Import(context.Background(), target, r, false)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, 3, report.Imported, format)
+		assert.Empty(t, report.Errors, format)
+
+		susr, _ := source.GetByLogin(context.Background(), "markw")
+		tusr, err := target.GetByLogin(context.Background(), "markw")
+		if assert.NoError(t, err) {
+			assert.Equal(t, susr.ID, tusr.ID)
+			assert.Equal(t, susr.Email, tusr.Email)
+		}
+
+		phash, err := target.GetPasswordByLogin(context.Background(), "markw")
+		if assert.NoError(t, err) {
+			assert.Equal(t, apr1Hash, phash)
+		}
+	}
+}
+
+func TestExportWithoutPasswords(t *testing.T) {
+
+	source := users.NewUserStoreLocal()
+
+	_, err := source.Create(context.Background(), &models.User{ID: models.String("123"), Login: models.String("wolfeidau"), Email: models.String("mark@wolfe.id.au"), Password: models.String(scryptHash)})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var buf bytes.Buffer
+
+	w, _ := NewWriter(FormatCSV, &buf)
+
+	_, err = Export(context.Background(), source, w, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id,login,email,name,password\n123,wolfeidau,mark@wolfe.id.au,,\n", buf.String())
+	}
+}
@@ -0,0 +1,280 @@
+package util
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Password hash formats accepted by CompareHashPassword, only FormatScrypt is produced by
+// HashPassword, the others are accepted so users can be imported from other systems.
+const (
+	FormatScrypt       = "scrypt"
+	FormatBcrypt       = "bcrypt"
+	FormatDjangoPBKDF2 = "django-pbkdf2"
+	FormatHtpasswdSHA  = "htpasswd-sha"
+	FormatHtpasswdMD5  = "htpasswd-apr1"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("Unknown password hash format.")
+	ErrMalformedHash     = errors.New("Malformed password hash.")
+)
+
+const (
+	scryptHashSize = 16 + 32
+	scryptPrefix   = "$scrypt$"
+	apr1Magic      = "$apr1$"
+	itoa64         = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// the scrypt parameters of hashes stored without them
+	defaultN = 16384
+	defaultR = 8
+	defaultP = 1
+)
+
+// HashFormat identify the format of the password hash and check it is well formed
+func HashFormat(phash string) (string, error) {
+	switch {
+	case strings.HasPrefix(phash, "$2a$"), strings.HasPrefix(phash, "$2b$"), strings.HasPrefix(phash, "$2y$"):
+		_, err := bcrypt.Cost([]byte(phash))
+		if err != nil {
+			return "", ErrMalformedHash
+		}
+		return FormatBcrypt, nil
+
+	case strings.HasPrefix(phash, "pbkdf2_"):
+		_, _, _, _, err := parseDjangoPBKDF2(phash)
+		if err != nil {
+			return "", err
+		}
+		return FormatDjangoPBKDF2, nil
+
+	case strings.HasPrefix(phash, "{SHA}"):
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(phash, "{SHA}"))
+		if err != nil || len(sum) != sha1.Size {
+			return "", ErrMalformedHash
+		}
+		return FormatHtpasswdSHA, nil
+
+	case strings.HasPrefix(phash, scryptPrefix):
+		_, _, _, _, _, err := parseScrypt(phash)
+		if err != nil {
+			return "", err
+		}
+		return FormatScrypt, nil
+
+	case strings.HasPrefix(phash, apr1Magic):
+		if strings.Count(phash, "$") != 3 {
+			return "", ErrMalformedHash
+		}
+		return FormatHtpasswdMD5, nil
+	}
+
+	rhash, err := base64.StdEncoding.DecodeString(phash)
+	if err != nil {
+		return "", ErrUnknownHashFormat
+	}
+
+	if len(rhash) != scryptHashSize {
+		return "", ErrMalformedHash
+	}
+
+	return FormatScrypt, nil
+}
+
+// NeedsRehash check if the password hash isn't in the format produced by HashPassword, or
+// used different scrypt parameters, the password should be hashed again once it has been
+// verified.
+func NeedsRehash(phash string) bool {
+	format, err := HashFormat(phash)
+	if err != nil || format != FormatScrypt {
+		return true
+	}
+
+	n, r, p, _, _, _ := parseScrypt(phash)
+
+	return n != int(N) || r != int(R) || p != int(P)
+}
+
+// parseScrypt parse the scrypt parameters, salt and key from a hash in either of the
+// formats produced by HashPassword
+func parseScrypt(phash string) (n, r, p int, salt, dk []byte, err error) {
+
+	if !strings.HasPrefix(phash, scryptPrefix) {
+		rhash, err := base64.StdEncoding.DecodeString(phash)
+		if err != nil || len(rhash) != scryptHashSize {
+			return 0, 0, 0, nil, nil, ErrMalformedHash
+		}
+		return defaultN, defaultR, defaultP, rhash[:16], rhash[16:], nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(phash, scryptPrefix), "$")
+	if len(parts) != 3 {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	_, err = fmt.Sscanf(parts[0], "N=%d,r=%d,p=%d", &n, &r, &p)
+	if err != nil || n < 2 || n&(n-1) != 0 || r < 1 || p < 1 {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	salt, err = base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(salt) == 0 {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	dk, err = base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(dk) == 0 {
+		return 0, 0, 0, nil, nil, ErrMalformedHash
+	}
+
+	return n, r, p, salt, dk, nil
+}
+
+// compareForeignHash compare the password against a hash in one of the imported formats
+func compareForeignHash(format, password, phash string) (bool, error) {
+	switch format {
+	case FormatBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(phash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+
+	case FormatDjangoPBKDF2:
+		h, iterations, salt, odk, err := parseDjangoPBKDF2(phash)
+		if err != nil {
+			return false, err
+		}
+		dk := pbkdf2.Key([]byte(password), []byte(salt), iterations, len(odk), h)
+		return subtle.ConstantTimeCompare(dk, odk) == 1, nil
+
+	case FormatHtpasswdSHA:
+		sum := sha1.Sum([]byte(password))
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(phash)) == 1, nil
+
+	case FormatHtpasswdMD5:
+		salt := strings.SplitN(strings.TrimPrefix(phash, apr1Magic), "$", 2)[0]
+		return subtle.ConstantTimeCompare([]byte(apr1(password, salt)), []byte(phash)) == 1, nil
+	}
+
+	return false, ErrUnknownHashFormat
+}
+
+// parseDjangoPBKDF2 parse a Django hash, pbkdf2_sha256$<iterations>$<salt>$<base64 hash>
+func parseDjangoPBKDF2(phash string) (func() hash.Hash, int, string, []byte, error) {
+	parts := strings.Split(phash, "$")
+	if len(parts) != 4 {
+		return nil, 0, "", nil, ErrMalformedHash
+	}
+
+	var h func() hash.Hash
+
+	switch parts[0] {
+	case "pbkdf2_sha256":
+		h = sha256.New
+	case "pbkdf2_sha1":
+		h = sha1.New
+	default:
+		return nil, 0, "", nil, ErrUnknownHashFormat
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return nil, 0, "", nil, ErrMalformedHash
+	}
+
+	dk, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(dk) == 0 {
+		return nil, 0, "", nil, ErrMalformedHash
+	}
+
+	return h, iterations, parts[2], dk, nil
+}
+
+// apr1 the Apache variant of the MD5 crypt algorithm used by htpasswd -m
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+
+	ctx := md5.New()
+	ctx.Write([]byte(password + apr1Magic + salt))
+
+	for i := len(pw); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		ctx.Write(alt[:n])
+	}
+
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+
+		final = round.Sum(nil)
+	}
+
+	out := []byte(apr1Magic + salt + "$")
+
+	to64 := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint(final[g[0]])<<16|uint(final[g[1]])<<8|uint(final[g[2]]), 4)
+	}
+
+	to64(uint(final[11]), 2)
+
+	return string(out)
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCompareForeignHashes(t *testing.T) {
+
+	pass := "Somewh3r3 there is a cow!"
+
+	bhash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("error generating bcrypt hash %v", err)
+	}
+
+	testCases := []struct {
+		hash   string
+		format string
+	}{
+		{"LkSquwzxdgzSTqqc7Rku5NF8/uR7TBFO1IRF1Yj2c0sM4HEVGgp0bJadWtRAaINP", FormatScrypt},
+		{string(bhash), FormatBcrypt},
+		{"pbkdf2_sha256$260000$saltysalt$z39lMrYWXjoS323Go+jB+HUVR1HS77NmmJC1UrXQcOA=", FormatDjangoPBKDF2},
+		{"{SHA}k0oLwcW0vixQ8ji3/6rquym1V6Y=", FormatHtpasswdSHA},
+		{"$apr1$saltsalt$JlxKsEGK5mnlqk8yvMql4/", FormatHtpasswdMD5},
+	}
+
+	for _, tc := range testCases {
+		format, err := HashFormat(tc.hash)
+		if err != nil || format != tc.format {
+			t.Errorf("expected format %s got %s %v", tc.format, format, err)
+		}
+
+		if NeedsRehash(tc.hash) != (tc.format != FormatScrypt) {
+			t.Errorf("unexpected rehash for %s", tc.format)
+		}
+
+		ok, err := CompareHashPassword(pass, tc.hash)
+		if err != nil || !ok {
+			t.Errorf("expected %s hash to match got %v %v", tc.format, ok, err)
+		}
+
+		ok, err = CompareHashPassword("wrong", tc.hash)
+		if err != nil || ok {
+			t.Errorf("expected %s hash not to match got %v %v", tc.format, ok, err)
+		}
+	}
+}
+
+func TestHashFormatInvalid(t *testing.T) {
+
+	testCases := []struct {
+		hash string
+		err  error
+	}{
+		{"not a hash!", ErrUnknownHashFormat},
+		{"c2hvcnQ=", ErrMalformedHash},
+		{"$2a$xx$nope", ErrMalformedHash},
+		{"pbkdf2_md5$1$salt$aGFzaA==", ErrUnknownHashFormat},
+		{"pbkdf2_sha256$many$salt$aGFzaA==", ErrMalformedHash},
+		{"{SHA}c2hvcnQ=", ErrMalformedHash},
+		{"$apr1$salt", ErrMalformedHash},
+	}
+
+	for _, tc := range testCases {
+		_, err := HashFormat(tc.hash)
+		if err != tc.err {
+			t.Errorf("expected %v for %q got %v", tc.err, tc.hash, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// HashConcurrency how many passwords can be hashed or compared at once, scrypt uses
+	// 128*N*R bytes of memory for each so this bounds the memory used by sign ins. It must
+	// be set before the first password is hashed.
+	HashConcurrency = runtime.NumCPU()
+
+	hashSlots     chan struct{}
+	hashSlotsOnce sync.Once
+	hashWaiting   int64
+)
+
+// HashPoolStats the usage of the pool of password hashing slots
+type HashPoolStats struct {
+	Size    int `json:"size"`
+	InUse   int `json:"in_use"`
+	Waiting int `json:"waiting"`
+}
+
+// Saturated true when at least as many hashes are waiting as can run at once
+func (s HashPoolStats) Saturated() bool {
+	return s.Waiting >= s.Size
+}
+
+// HashPoolUsage return the current usage of the hashing slots
+func HashPoolUsage() HashPoolStats {
+	slots := hashPool()
+
+	return HashPoolStats{
+		Size:    cap(slots),
+		InUse:   len(slots),
+		Waiting: int(atomic.LoadInt64(&hashWaiting)),
+	}
+}
+
+// acquireHashSlot wait for a hashing slot, the returned function releases it
+func acquireHashSlot() func() {
+	slots := hashPool()
+
+	atomic.AddInt64(&hashWaiting, 1)
+	slots <- struct{}{}
+	atomic.AddInt64(&hashWaiting, -1)
+
+	return func() { <-slots }
+}
+
+func hashPool() chan struct{} {
+	hashSlotsOnce.Do(func() {
+		size := HashConcurrency
+		if size < 1 {
+			size = 1
+		}
+		hashSlots = make(chan struct{}, size)
+	})
+	return hashSlots
+}
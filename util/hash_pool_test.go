@@ -0,0 +1,23 @@
+package util
+
+import "testing"
+
+func TestHashPoolUsage(t *testing.T) {
+
+	release := acquireHashSlot()
+
+	stats := HashPoolUsage()
+	if stats.Size < 1 || stats.InUse != 1 || stats.Waiting != 0 {
+		t.Errorf("expected one slot in use got %+v", stats)
+	}
+
+	release()
+
+	if stats = HashPoolUsage(); stats.InUse != 0 {
+		t.Errorf("expected no slots in use got %+v", stats)
+	}
+
+	if !(HashPoolStats{Size: 2, Waiting: 2}).Saturated() || (HashPoolStats{Size: 2, InUse: 2, Waiting: 1}).Saturated() {
+		t.Errorf("unexpected saturation")
+	}
+}
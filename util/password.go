@@ -4,7 +4,10 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"fmt"
+	"time"
 
+	"github.com/wolfeidau/authinator/metrics"
 	"golang.org/x/crypto/scrypt"
 )
 
@@ -19,18 +22,29 @@ var (
 
 // HashPassword returns a password has created using scrypt.
 // return [salt] + scrypt([salt], [credential], N=16384, r=8, p=1, keyLen=32);
+//
+// If N, R or P have been changed from their defaults the parameters are stored with the
+// hash as $scrypt$N=<N>,r=<R>,p=<P>$<base64 salt>$<base64 hash>.
 func HashPassword(password string) (string, error) {
 	var hash string
 
+	defer metrics.ObservePasswordHash("hash", time.Now())
+	defer acquireHashSlot()()
+
 	salt, err := generateSalt()
 	if err != nil {
 		return hash, err
 	}
-	dk, err := scrypt.Key([]byte(password), salt, 16384, 8, 1, 32)
+	dk, err := scrypt.Key([]byte(password), salt, int(N), int(R), int(P), 32)
 	if err != nil {
 		return hash, err
 	}
 
+	if N != defaultN || R != defaultR || P != defaultP {
+		enc := base64.StdEncoding
+		return fmt.Sprintf("%sN=%d,r=%d,p=%d$%s$%s", scryptPrefix, N, R, P, enc.EncodeToString(salt), enc.EncodeToString(dk)), nil
+	}
+
 	rhash := append(salt, dk...)
 
 	hash = base64.StdEncoding.EncodeToString(rhash)
@@ -40,17 +54,29 @@ func HashPassword(password string) (string, error) {
 
 // CompareHashPassword compares password hash by decoding and extracting the seed
 // then calculating the hash and using constant time comparison to compare then.
+//
+// Hashes imported in the other formats listed by HashFormat are also accepted, use
+// NeedsRehash to check if the password should be hashed again after it is verified.
 func CompareHashPassword(password, hash string) (bool, error) {
 
-	rhash, err := base64.StdEncoding.DecodeString(hash)
+	format, err := HashFormat(hash)
 	if err != nil {
 		return false, err
 	}
 
-	salt := rhash[:16]
-	odk := rhash[16:]
+	defer metrics.ObservePasswordHash("compare", time.Now())
+	defer acquireHashSlot()()
+
+	if format != FormatScrypt {
+		return compareForeignHash(format, password, hash)
+	}
+
+	n, r, p, salt, odk, err := parseScrypt(hash)
+	if err != nil {
+		return false, err
+	}
 
-	dk, err := scrypt.Key([]byte(password), salt, 16384, 8, 1, 32)
+	dk, err := scrypt.Key([]byte(password), salt, n, r, p, len(odk))
 	if err != nil {
 		return false, err
 	}
@@ -21,3 +21,49 @@ func TestCompareHashPassword(t *testing.T) {
 		t.Errorf("expected true got %v", ok)
 	}
 }
+
+func TestHashPasswordCost(t *testing.T) {
+
+	pass := "Somewh3r3 there is a cow!"
+
+	legacy, err := HashPassword(pass)
+	if err != nil {
+		t.Fatalf("error hashing pass %v", err)
+	}
+
+	defer func(n int32) { N = n }(N)
+	N = 1024
+
+	phash, err := HashPassword(pass)
+	if err != nil {
+		t.Fatalf("error hashing pass %v", err)
+	}
+
+	if format, err := HashFormat(phash); err != nil || format != FormatScrypt {
+		t.Errorf("expected format %s got %s %v", FormatScrypt, format, err)
+	}
+
+	ok, err := CompareHashPassword(pass, phash)
+	if err != nil || !ok {
+		t.Errorf("expected true got %v %v", ok, err)
+	}
+
+	if NeedsRehash(phash) {
+		t.Errorf("expected hash with the current cost to not need rehashing")
+	}
+
+	// hashes with the old cost are still accepted but should be hashed again
+	ok, err = CompareHashPassword(pass, legacy)
+	if err != nil || !ok {
+		t.Errorf("expected true got %v %v", ok, err)
+	}
+
+	if !NeedsRehash(legacy) {
+		t.Errorf("expected hash with a different cost to need rehashing")
+	}
+
+	_, err = HashFormat("$scrypt$N=1000,r=8,p=1$c2FsdA==$a2V5")
+	if err != ErrMalformedHash {
+		t.Errorf("expected %v got %v", ErrMalformedHash, err)
+	}
+}
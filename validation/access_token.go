@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wolfeidau/authinator/auth"
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/validation/field"
+)
+
+var scopeRegexp = regexp.MustCompile(`^[a-z][a-z0-9_:.-]*$`)
+
+// ValidateAccessTokenCreate validate personal access token creation requests
+func ValidateAccessTokenCreate(newToken *models.AccessToken) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	path := field.NewPath("AccessToken")
+
+	allErrs = append(allErrs, validateInvalidFields(newToken, path, []string{"ID", "UserID", "CreatedAt", "LastUsedAt", "Token"})...)
+	allErrs = append(allErrs, validateRequiredFields(newToken, path, []string{"Name"})...)
+
+	allErrs = append(allErrs, validateFieldLength(newToken.Name, path, 1, 255, "Name")...)
+
+	for i, scope := range newToken.Scopes {
+		if !auth.ValidScope(scope) {
+			allErrs = append(allErrs, field.Invalid(path.Child("Scopes").Index(i), scope, fmt.Sprintf("%s: Scopes must be one of %s", path.String(), strings.Join(auth.Scopes, ", "))))
+		}
+	}
+
+	if newToken.ExpiresAt != nil && !newToken.ExpiresAt.After(time.Now()) {
+		allErrs = append(allErrs, field.Invalid(path.Child("ExpiresAt"), newToken.ExpiresAt, fmt.Sprintf("%s: ExpiresAt must be in the future", path.String())))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wolfeidau/authinator/models"
+	"github.com/wolfeidau/authinator/validation/field"
+)
+
+func TestValidateAccessTokenCreate(t *testing.T) {
+	testCases := []struct {
+		newToken *models.AccessToken
+		expected field.ErrorList
+	}{
+		{
+			newToken: &models.AccessToken{
+				Name:   models.String("ci"),
+				Scopes: []string{"users:read"},
+			},
+			expected: field.ErrorList{},
+		},
+		{
+			newToken: &models.AccessToken{
+				UserID: models.String("123"),
+				Scopes: []string{"Users Read"},
+			},
+			expected: field.ErrorList{
+				&field.Error{Type: field.ErrorTypeForbidden, Field: field.NewPath("AccessToken", "UserID").String(), BadValue: "", Detail: "AccessToken updates must not supply UserID"},
+				&field.Error{Type: field.ErrorTypeRequired, Field: field.NewPath("AccessToken", "Name").String(), BadValue: "", Detail: "AccessToken updates must supply Name"},
+				&field.Error{Type: field.ErrorTypeInvalid, Field: field.NewPath("AccessToken", "Name").String(), BadValue: "", Detail: "AccessToken: Name must be between 1 and 255 characters"},
+				&field.Error{Type: field.ErrorTypeInvalid, Field: field.NewPath("AccessToken").Child("Scopes").Index(0).String(), BadValue: "Users Read", Detail: "AccessToken: Scopes must be one of users:read, users:write, sessions:read, sessions:write, history:read, tokens:read"},
+			},
+		},
+		{
+			newToken: &models.AccessToken{
+				Name:   models.String("ci"),
+				Scopes: []string{"users:admin"},
+			},
+			expected: field.ErrorList{
+				&field.Error{Type: field.ErrorTypeInvalid, Field: field.NewPath("AccessToken").Child("Scopes").Index(0).String(), BadValue: "users:admin", Detail: "AccessToken: Scopes must be one of users:read, users:write, sessions:read, sessions:write, history:read, tokens:read"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		errList := ValidateAccessTokenCreate(testCase.newToken)
+
+		if !reflect.DeepEqual(errList, testCase.expected) {
+			t.Errorf("expected\n%s\ngot\n%s\n", toJSON(testCase.expected), toJSON(errList))
+		}
+	}
+}
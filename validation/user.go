@@ -15,8 +15,20 @@ func ValidateUserUpdate(newUser, oldUser *models.User) field.ErrorList {
 
 	path := field.NewPath("User")
 
-	allErrs = append(allErrs, validateImmutibleFields(newUser, oldUser, path, []string{"ID", "Email", "Login"})...)
-	allErrs = append(allErrs, validateInvalidFields(newUser, path, []string{"Password"})...)
+	allErrs = append(allErrs, validateImmutibleFields(newUser, oldUser, path, []string{"ID", "Email", "Login", "Version", "DeletedAt", "DisabledAt", "Roles"})...)
+	allErrs = append(allErrs, validateInvalidFields(newUser, path, []string{"Password", "LastLoginAt", "LastLoginIP", "LoginCiphertext", "EmailIndex"})...)
+
+	return allErrs
+}
+
+// ValidateUserPatch validate user patch requests, changes holds only the fields which
+// the patch changed and patched is the whole user after the patch was applied.
+func ValidateUserPatch(changes, patched, oldUser *models.User) field.ErrorList {
+	allErrs := ValidateUserUpdate(changes, oldUser)
+
+	path := field.NewPath("User")
+
+	allErrs = append(allErrs, validateRequiredFields(patched, path, []string{"Email", "Login"})...)
 
 	return allErrs
 }
@@ -27,7 +39,7 @@ func ValidateUserRegister(newUser *models.User) field.ErrorList {
 
 	path := field.NewPath("User")
 
-	allErrs = append(allErrs, validateInvalidFields(newUser, path, []string{"ID"})...)
+	allErrs = append(allErrs, validateInvalidFields(newUser, path, []string{"ID", "LastLoginAt", "LastLoginIP", "Version", "DeletedAt", "DisabledAt", "Roles", "LoginCiphertext", "EmailIndex"})...)
 	allErrs = append(allErrs, validateRequiredFields(newUser, path, []string{"Email", "Login", "Password"})...)
 
 	allErrs = append(allErrs, validateFieldLength(newUser.Email, path, 5, 255, "Email")...)
@@ -37,6 +49,27 @@ func ValidateUserRegister(newUser *models.User) field.ErrorList {
 	return allErrs
 }
 
+// ValidateUserPassword validate a new password set for an existing user
+func ValidateUserPassword(password string) field.ErrorList {
+	return validateFieldLength(&password, field.NewPath("User"), 5, 255, "Password")
+}
+
+// ValidateUserRoles validate the roles granted to a user, they have the same format as
+// access token scopes
+func ValidateUserRoles(roles []string) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	path := field.NewPath("User")
+
+	for i, role := range roles {
+		if !scopeRegexp.MatchString(role) {
+			allErrs = append(allErrs, field.Invalid(path.Child("Roles").Index(i), role, fmt.Sprintf("%s: Roles must match %s", path.String(), scopeRegexp.String())))
+		}
+	}
+
+	return allErrs
+}
+
 func validateImmutibleFields(new, old interface{}, fldPath *field.Path, fields []string) field.ErrorList {
 	allErrs := field.ErrorList{}
 
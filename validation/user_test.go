@@ -37,6 +37,26 @@ func TestValidateUpdateUser(t *testing.T) {
 				&field.Error{Type: field.ErrorTypeForbidden, Field: field.NewPath("User", "Password").String(), BadValue: "", Detail: "User updates must not supply Password"},
 			},
 		},
+		{
+			newUser: &models.User{
+				Name:        models.String("Mark Wolf"),
+				LastLoginIP: models.String("127.0.0.1"),
+			},
+			oldUser: models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe"),
+			expected: field.ErrorList{
+				&field.Error{Type: field.ErrorTypeForbidden, Field: field.NewPath("User", "LastLoginIP").String(), BadValue: "", Detail: "User updates must not supply LastLoginIP"},
+			},
+		},
+		{
+			newUser: &models.User{
+				Name:    models.String("Mark Wolf"),
+				Version: models.Int64(2),
+			},
+			oldUser: &models.User{ID: models.String("123"), Version: models.Int64(3)},
+			expected: field.ErrorList{
+				&field.Error{Type: field.ErrorTypeForbidden, Field: field.NewPath("User", "Version").String(), BadValue: "", Detail: "User updates must not change Version"},
+			},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -48,6 +68,33 @@ func TestValidateUpdateUser(t *testing.T) {
 	}
 }
 
+func TestValidateUserPatch(t *testing.T) {
+
+	oldUser := models.NewUser("123", "wolfeidau", "mark@wolfe.id.au", "Mark Wolfe")
+
+	// removing the email is caught by the patched user
+	errList := ValidateUserPatch(&models.User{}, &models.User{ID: models.String("123"), Login: models.String("wolfeidau")}, oldUser)
+
+	expected := field.ErrorList{
+		&field.Error{Type: field.ErrorTypeRequired, Field: field.NewPath("User", "Email").String(), BadValue: "", Detail: "User updates must supply Email"},
+	}
+
+	if !reflect.DeepEqual(errList, expected) {
+		t.Errorf("expected\n%s\ngot\n%s\n", toJSON(expected), toJSON(errList))
+	}
+
+	// changing the login is caught by the changes
+	errList = ValidateUserPatch(&models.User{Login: models.String("markw")}, models.NewUser("123", "markw", "mark@wolfe.id.au", "Mark Wolfe"), oldUser)
+
+	expected = field.ErrorList{
+		&field.Error{Type: field.ErrorTypeForbidden, Field: field.NewPath("User", "Login").String(), BadValue: "", Detail: "User updates must not change Login"},
+	}
+
+	if !reflect.DeepEqual(errList, expected) {
+		t.Errorf("expected\n%s\ngot\n%s\n", toJSON(expected), toJSON(errList))
+	}
+}
+
 func TestValidateUserRegister(t *testing.T) {
 	testCases := []struct {
 		newUser  *models.User
@@ -74,6 +121,17 @@ func TestValidateUserRegister(t *testing.T) {
 				&field.Error{Type: field.ErrorTypeForbidden, Field: field.NewPath("User", "ID").String(), BadValue: "", Detail: "User updates must not supply ID"},
 			},
 		},
+		{
+			newUser: &models.User{
+				Login:    models.String("wolfeidau"),
+				Email:    models.String("mark@wolfe.id.au"),
+				Password: models.String("Somewh3r3 there is a cow!"),
+				Version:  models.Int64(3),
+			},
+			expected: field.ErrorList{
+				&field.Error{Type: field.ErrorTypeForbidden, Field: field.NewPath("User", "Version").String(), BadValue: "", Detail: "User updates must not supply Version"},
+			},
+		},
 		{
 			newUser: &models.User{
 				ID:    models.String("123"),
@@ -99,6 +157,24 @@ func TestValidateUserRegister(t *testing.T) {
 	}
 }
 
+func TestValidateUserRoles(t *testing.T) {
+
+	errList := ValidateUserRoles([]string{"admin", "support:read"})
+	if len(errList) != 0 {
+		t.Errorf("expected no errors got %s", toJSON(errList))
+	}
+
+	errList = ValidateUserRoles([]string{"admin", "Bad Role"})
+
+	expected := field.ErrorList{
+		&field.Error{Type: field.ErrorTypeInvalid, Field: field.NewPath("User", "Roles").Index(1).String(), BadValue: "Bad Role", Detail: "User: Roles must match ^[a-z][a-z0-9_:.-]*$"},
+	}
+
+	if !reflect.DeepEqual(errList, expected) {
+		t.Errorf("expected\n%s\ngot\n%s\n", toJSON(expected), toJSON(errList))
+	}
+}
+
 func toJSON(o interface{}) string {
 	buf, err := json.Marshal(o)
 